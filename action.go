@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is the terraform operation a request runs.
+type Action string
+
+const (
+	ActionPlan     Action = "plan"
+	ActionApply    Action = "apply"
+	ActionDestroy  Action = "destroy"
+	ActionGraph    Action = "graph"    // Dependency graph of the code, without changing anything
+	ActionValidate Action = "validate" // Syntax and consistency checks, without calling provider APIs
+	ActionFmt      Action = "fmt"      // Rewrite the code in canonical format
+	ActionImport   Action = "import"   // Bring an existing resource into the state, then plan
+	ActionRefresh  Action = "refresh"  // Report resources changed outside terraform, without changing anything
+)
+
+var validActions = []Action{ActionPlan, ActionApply, ActionDestroy, ActionGraph, ActionValidate, ActionFmt, ActionImport, ActionRefresh}
+
+// defaultActionTimeouts are the executor call timeouts, in seconds, used for
+// actions action_timeout_seconds doesn't set.
+var defaultActionTimeouts = map[Action]int{
+	ActionPlan:     10 * 60,
+	ActionApply:    30 * 60,
+	ActionDestroy:  30 * 60,
+	ActionGraph:    2 * 60,
+	ActionValidate: 2 * 60,
+	ActionFmt:      60,
+	ActionImport:   10 * 60,
+	ActionRefresh:  10 * 60,
+}
+
+// parseAction validates an action from a request. An empty action is a plan.
+func parseAction(s string) (Action, error) {
+	if s == "" {
+		return ActionPlan, nil
+	}
+	for _, action := range validActions {
+		if Action(s) == action {
+			return action, nil
+		}
+	}
+
+	names := make([]string, len(validActions))
+	for i, action := range validActions {
+		names[i] = string(action)
+	}
+	return "", fmt.Errorf("unknown action %q, valid actions are: %s", s, strings.Join(names, ", "))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Action
+		wantErr bool
+	}{
+		{"", ActionPlan, false},
+		{"plan", ActionPlan, false},
+		{"apply", ActionApply, false},
+		{"destroy", ActionDestroy, false},
+		{"refresh", ActionRefresh, false},
+		{"Apply", "", true}, // Case-sensitive
+		{"deploy", "", true},
+		{" plan", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseAction(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseAction(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseActionListsValidActions(t *testing.T) {
+	_, err := parseAction("deploy")
+	if err == nil {
+		t.Fatal("parseAction(deploy) succeeded")
+	}
+	for _, action := range validActions {
+		if !strings.Contains(err.Error(), string(action)) {
+			t.Errorf("error %q doesn't list %q", err, action)
+		}
+	}
+}
+
+func TestUnknownActionRejected(t *testing.T) {
+	s := newTestService(nil)
+	w := httptest.NewRecorder()
+	s.handleTerraformRequest(w, httptest.NewRequest(http.MethodPost, "/terraform", strings.NewReader(`{"action":"deploy","workspace":"ws"}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), APIErrorUnknownAction) {
+		t.Errorf("status = %d, body = %s; want 400 %s", w.Code, w.Body, APIErrorUnknownAction)
+	}
+}
+
+func TestDefaultActionTimeouts(t *testing.T) {
+	for _, action := range validActions {
+		if defaultActionTimeouts[action] <= 0 {
+			t.Errorf("action %s has no default timeout", action)
+		}
+	}
+}
@@ -19,23 +19,40 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Executor_AppendCode_FullMethodName      = "/executor.Executor/AppendCode"
-	Executor_Plan_FullMethodName            = "/executor.Executor/Plan"
-	Executor_Apply_FullMethodName           = "/executor.Executor/Apply"
-	Executor_Destroy_FullMethodName         = "/executor.Executor/Destroy"
-	Executor_GetStateList_FullMethodName    = "/executor.Executor/GetStateList"
-	Executor_ClearCode_FullMethodName       = "/executor.Executor/ClearCode"
-	Executor_CreateContext_FullMethodName   = "/executor.Executor/CreateContext"
-	Executor_DeleteContext_FullMethodName   = "/executor.Executor/DeleteContext"
-	Executor_CreateWorkspace_FullMethodName = "/executor.Executor/CreateWorkspace"
-	Executor_DeleteWorkspace_FullMethodName = "/executor.Executor/DeleteWorkspace"
-	Executor_AddProviders_FullMethodName    = "/executor.Executor/AddProviders"
-	Executor_AddSecretEnv_FullMethodName    = "/executor.Executor/AddSecretEnv"
-	Executor_AddSecretVar_FullMethodName    = "/executor.Executor/AddSecretVar"
-	Executor_ClearProviders_FullMethodName  = "/executor.Executor/ClearProviders"
-	Executor_ClearWorkspace_FullMethodName  = "/executor.Executor/ClearWorkspace"
-	Executor_ClearSecretVars_FullMethodName = "/executor.Executor/ClearSecretVars"
-	Executor_GetMainTf_FullMethodName       = "/executor.Executor/GetMainTf"
+	Executor_AppendCode_FullMethodName       = "/executor.Executor/AppendCode"
+	Executor_Plan_FullMethodName             = "/executor.Executor/Plan"
+	Executor_Apply_FullMethodName            = "/executor.Executor/Apply"
+	Executor_StreamApply_FullMethodName      = "/executor.Executor/StreamApply"
+	Executor_Destroy_FullMethodName          = "/executor.Executor/Destroy"
+	Executor_GetStateList_FullMethodName     = "/executor.Executor/GetStateList"
+	Executor_ClearCode_FullMethodName        = "/executor.Executor/ClearCode"
+	Executor_CreateContext_FullMethodName    = "/executor.Executor/CreateContext"
+	Executor_DeleteContext_FullMethodName    = "/executor.Executor/DeleteContext"
+	Executor_CreateWorkspace_FullMethodName  = "/executor.Executor/CreateWorkspace"
+	Executor_DeleteWorkspace_FullMethodName  = "/executor.Executor/DeleteWorkspace"
+	Executor_AddProviders_FullMethodName     = "/executor.Executor/AddProviders"
+	Executor_AddSecretEnv_FullMethodName     = "/executor.Executor/AddSecretEnv"
+	Executor_AddSecretVar_FullMethodName     = "/executor.Executor/AddSecretVar"
+	Executor_ClearProviders_FullMethodName   = "/executor.Executor/ClearProviders"
+	Executor_ClearWorkspace_FullMethodName   = "/executor.Executor/ClearWorkspace"
+	Executor_ClearSecretVars_FullMethodName  = "/executor.Executor/ClearSecretVars"
+	Executor_GetMainTf_FullMethodName        = "/executor.Executor/GetMainTf"
+	Executor_GetLockFile_FullMethodName      = "/executor.Executor/GetLockFile"
+	Executor_SetLockFile_FullMethodName      = "/executor.Executor/SetLockFile"
+	Executor_GetSecretHashes_FullMethodName  = "/executor.Executor/GetSecretHashes"
+	Executor_UpgradeTerraform_FullMethodName = "/executor.Executor/UpgradeTerraform"
+	Executor_ListVariables_FullMethodName    = "/executor.Executor/ListVariables"
+	Executor_Graph_FullMethodName            = "/executor.Executor/Graph"
+	Executor_Health_FullMethodName           = "/executor.Executor/Health"
+	Executor_Validate_FullMethodName         = "/executor.Executor/Validate"
+	Executor_Fmt_FullMethodName              = "/executor.Executor/Fmt"
+	Executor_SetVariables_FullMethodName     = "/executor.Executor/SetVariables"
+	Executor_GetVariables_FullMethodName     = "/executor.Executor/GetVariables"
+	Executor_Output_FullMethodName           = "/executor.Executor/Output"
+	Executor_ListWorkspaces_FullMethodName   = "/executor.Executor/ListWorkspaces"
+	Executor_ListContexts_FullMethodName     = "/executor.Executor/ListContexts"
+	Executor_Import_FullMethodName           = "/executor.Executor/Import"
+	Executor_Refresh_FullMethodName          = "/executor.Executor/Refresh"
 )
 
 // ExecutorClient is the client API for Executor service.
@@ -50,6 +67,8 @@ type ExecutorClient interface {
 	Plan(ctx context.Context, in *PlanRequest, opts ...grpc.CallOption) (*PlanResponse, error)
 	// Applies the Terraform plan and returns the execution result.
 	Apply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (*ApplyResponse, error)
+	// Applies the Terraform plan, streaming output as it is written and the result last.
+	StreamApply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ApplyChunk], error)
 	// Destroys the Terraform-managed infrastructure and returns the result.
 	Destroy(ctx context.Context, in *DestroyRequest, opts ...grpc.CallOption) (*DestroyResponse, error)
 	// Retrieves the Terraform state list.
@@ -78,6 +97,40 @@ type ExecutorClient interface {
 	ClearSecretVars(ctx context.Context, in *ClearSecretVarsRequest, opts ...grpc.CallOption) (*ClearSecretVarsResponse, error)
 	// Gets the content of main.tf file
 	GetMainTf(ctx context.Context, in *GetMainTfRequest, opts ...grpc.CallOption) (*GetMainTfResponse, error)
+	// Gets the content of the .terraform.lock.hcl file
+	GetLockFile(ctx context.Context, in *GetLockFileRequest, opts ...grpc.CallOption) (*GetLockFileResponse, error)
+	// Replaces the content of the .terraform.lock.hcl file
+	SetLockFile(ctx context.Context, in *SetLockFileRequest, opts ...grpc.CallOption) (*SetLockFileResponse, error)
+	// Gets hashes of the secret values injected into a workspace, so callers can mask them.
+	GetSecretHashes(ctx context.Context, in *GetSecretHashesRequest, opts ...grpc.CallOption) (*GetSecretHashesResponse, error)
+	// Upgrades the Terraform binary used for a workspace to at least the given version.
+	UpgradeTerraform(ctx context.Context, in *UpgradeTerraformRequest, opts ...grpc.CallOption) (*UpgradeTerraformResponse, error)
+	// Lists the variables declared in a workspace's base configuration.
+	ListVariables(ctx context.Context, in *ListVariablesRequest, opts ...grpc.CallOption) (*ListVariablesResponse, error)
+	// Runs `terraform graph` and returns the dependency graph.
+	Graph(ctx context.Context, in *GraphRequest, opts ...grpc.CallOption) (*GraphResponse, error)
+	// Reports whether the executor is ready. Must be cheap; used by probes.
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	// Runs `terraform validate`, which checks the configuration without calling provider APIs.
+	Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*ValidateResponse, error)
+	// Runs `terraform fmt` on the workspace and returns the formatted main.tf.
+	Fmt(ctx context.Context, in *FmtRequest, opts ...grpc.CallOption) (*FmtResponse, error)
+	// Writes the values to the workspace's terraform.tfvars, replacing any set
+	// before, and declares as strings the variables the base configuration does not.
+	SetVariables(ctx context.Context, in *SetVariablesRequest, opts ...grpc.CallOption) (*SetVariablesResponse, error)
+	// Returns the values in the workspace's terraform.tfvars, as set by SetVariables.
+	GetVariables(ctx context.Context, in *GetVariablesRequest, opts ...grpc.CallOption) (*GetVariablesResponse, error)
+	// Returns the outputs in the workspace's state as `terraform output -json`.
+	Output(ctx context.Context, in *OutputRequest, opts ...grpc.CallOption) (*OutputResponse, error)
+	// Lists the workspaces of a context.
+	ListWorkspaces(ctx context.Context, in *ListWorkspacesRequest, opts ...grpc.CallOption) (*ListWorkspacesResponse, error)
+	// Lists the contexts.
+	ListContexts(ctx context.Context, in *ListContextsRequest, opts ...grpc.CallOption) (*ListContextsResponse, error)
+	// Runs `terraform import` for one resource of the workspace's configuration.
+	Import(ctx context.Context, in *ImportRequest, opts ...grpc.CallOption) (*ImportResponse, error)
+	// Runs `terraform plan -refresh-only`, which compares the state with the
+	// real resources without changing either.
+	Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error)
 }
 
 type executorClient struct {
@@ -118,6 +171,25 @@ func (c *executorClient) Apply(ctx context.Context, in *ApplyRequest, opts ...gr
 	return out, nil
 }
 
+func (c *executorClient) StreamApply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ApplyChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Executor_ServiceDesc.Streams[0], Executor_StreamApply_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ApplyRequest, ApplyChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Executor_StreamApplyClient = grpc.ServerStreamingClient[ApplyChunk]
+
 func (c *executorClient) Destroy(ctx context.Context, in *DestroyRequest, opts ...grpc.CallOption) (*DestroyResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(DestroyResponse)
@@ -258,6 +330,166 @@ func (c *executorClient) GetMainTf(ctx context.Context, in *GetMainTfRequest, op
 	return out, nil
 }
 
+func (c *executorClient) GetLockFile(ctx context.Context, in *GetLockFileRequest, opts ...grpc.CallOption) (*GetLockFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetLockFileResponse)
+	err := c.cc.Invoke(ctx, Executor_GetLockFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) SetLockFile(ctx context.Context, in *SetLockFileRequest, opts ...grpc.CallOption) (*SetLockFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetLockFileResponse)
+	err := c.cc.Invoke(ctx, Executor_SetLockFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) GetSecretHashes(ctx context.Context, in *GetSecretHashesRequest, opts ...grpc.CallOption) (*GetSecretHashesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSecretHashesResponse)
+	err := c.cc.Invoke(ctx, Executor_GetSecretHashes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) UpgradeTerraform(ctx context.Context, in *UpgradeTerraformRequest, opts ...grpc.CallOption) (*UpgradeTerraformResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpgradeTerraformResponse)
+	err := c.cc.Invoke(ctx, Executor_UpgradeTerraform_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) ListVariables(ctx context.Context, in *ListVariablesRequest, opts ...grpc.CallOption) (*ListVariablesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVariablesResponse)
+	err := c.cc.Invoke(ctx, Executor_ListVariables_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) Graph(ctx context.Context, in *GraphRequest, opts ...grpc.CallOption) (*GraphResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GraphResponse)
+	err := c.cc.Invoke(ctx, Executor_Graph_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, Executor_Health_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*ValidateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ValidateResponse)
+	err := c.cc.Invoke(ctx, Executor_Validate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) Fmt(ctx context.Context, in *FmtRequest, opts ...grpc.CallOption) (*FmtResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FmtResponse)
+	err := c.cc.Invoke(ctx, Executor_Fmt_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) SetVariables(ctx context.Context, in *SetVariablesRequest, opts ...grpc.CallOption) (*SetVariablesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetVariablesResponse)
+	err := c.cc.Invoke(ctx, Executor_SetVariables_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) GetVariables(ctx context.Context, in *GetVariablesRequest, opts ...grpc.CallOption) (*GetVariablesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetVariablesResponse)
+	err := c.cc.Invoke(ctx, Executor_GetVariables_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) Output(ctx context.Context, in *OutputRequest, opts ...grpc.CallOption) (*OutputResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OutputResponse)
+	err := c.cc.Invoke(ctx, Executor_Output_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) ListWorkspaces(ctx context.Context, in *ListWorkspacesRequest, opts ...grpc.CallOption) (*ListWorkspacesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWorkspacesResponse)
+	err := c.cc.Invoke(ctx, Executor_ListWorkspaces_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) ListContexts(ctx context.Context, in *ListContextsRequest, opts ...grpc.CallOption) (*ListContextsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListContextsResponse)
+	err := c.cc.Invoke(ctx, Executor_ListContexts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) Import(ctx context.Context, in *ImportRequest, opts ...grpc.CallOption) (*ImportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImportResponse)
+	err := c.cc.Invoke(ctx, Executor_Import_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RefreshResponse)
+	err := c.cc.Invoke(ctx, Executor_Refresh_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ExecutorServer is the server API for Executor service.
 // All implementations must embed UnimplementedExecutorServer
 // for forward compatibility.
@@ -270,6 +502,8 @@ type ExecutorServer interface {
 	Plan(context.Context, *PlanRequest) (*PlanResponse, error)
 	// Applies the Terraform plan and returns the execution result.
 	Apply(context.Context, *ApplyRequest) (*ApplyResponse, error)
+	// Applies the Terraform plan, streaming output as it is written and the result last.
+	StreamApply(*ApplyRequest, grpc.ServerStreamingServer[ApplyChunk]) error
 	// Destroys the Terraform-managed infrastructure and returns the result.
 	Destroy(context.Context, *DestroyRequest) (*DestroyResponse, error)
 	// Retrieves the Terraform state list.
@@ -298,6 +532,40 @@ type ExecutorServer interface {
 	ClearSecretVars(context.Context, *ClearSecretVarsRequest) (*ClearSecretVarsResponse, error)
 	// Gets the content of main.tf file
 	GetMainTf(context.Context, *GetMainTfRequest) (*GetMainTfResponse, error)
+	// Gets the content of the .terraform.lock.hcl file
+	GetLockFile(context.Context, *GetLockFileRequest) (*GetLockFileResponse, error)
+	// Replaces the content of the .terraform.lock.hcl file
+	SetLockFile(context.Context, *SetLockFileRequest) (*SetLockFileResponse, error)
+	// Gets hashes of the secret values injected into a workspace, so callers can mask them.
+	GetSecretHashes(context.Context, *GetSecretHashesRequest) (*GetSecretHashesResponse, error)
+	// Upgrades the Terraform binary used for a workspace to at least the given version.
+	UpgradeTerraform(context.Context, *UpgradeTerraformRequest) (*UpgradeTerraformResponse, error)
+	// Lists the variables declared in a workspace's base configuration.
+	ListVariables(context.Context, *ListVariablesRequest) (*ListVariablesResponse, error)
+	// Runs `terraform graph` and returns the dependency graph.
+	Graph(context.Context, *GraphRequest) (*GraphResponse, error)
+	// Reports whether the executor is ready. Must be cheap; used by probes.
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	// Runs `terraform validate`, which checks the configuration without calling provider APIs.
+	Validate(context.Context, *ValidateRequest) (*ValidateResponse, error)
+	// Runs `terraform fmt` on the workspace and returns the formatted main.tf.
+	Fmt(context.Context, *FmtRequest) (*FmtResponse, error)
+	// Writes the values to the workspace's terraform.tfvars, replacing any set
+	// before, and declares as strings the variables the base configuration does not.
+	SetVariables(context.Context, *SetVariablesRequest) (*SetVariablesResponse, error)
+	// Returns the values in the workspace's terraform.tfvars, as set by SetVariables.
+	GetVariables(context.Context, *GetVariablesRequest) (*GetVariablesResponse, error)
+	// Returns the outputs in the workspace's state as `terraform output -json`.
+	Output(context.Context, *OutputRequest) (*OutputResponse, error)
+	// Lists the workspaces of a context.
+	ListWorkspaces(context.Context, *ListWorkspacesRequest) (*ListWorkspacesResponse, error)
+	// Lists the contexts.
+	ListContexts(context.Context, *ListContextsRequest) (*ListContextsResponse, error)
+	// Runs `terraform import` for one resource of the workspace's configuration.
+	Import(context.Context, *ImportRequest) (*ImportResponse, error)
+	// Runs `terraform plan -refresh-only`, which compares the state with the
+	// real resources without changing either.
+	Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error)
 	mustEmbedUnimplementedExecutorServer()
 }
 
@@ -317,6 +585,9 @@ func (UnimplementedExecutorServer) Plan(context.Context, *PlanRequest) (*PlanRes
 func (UnimplementedExecutorServer) Apply(context.Context, *ApplyRequest) (*ApplyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Apply not implemented")
 }
+func (UnimplementedExecutorServer) StreamApply(*ApplyRequest, grpc.ServerStreamingServer[ApplyChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamApply not implemented")
+}
 func (UnimplementedExecutorServer) Destroy(context.Context, *DestroyRequest) (*DestroyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Destroy not implemented")
 }
@@ -359,6 +630,54 @@ func (UnimplementedExecutorServer) ClearSecretVars(context.Context, *ClearSecret
 func (UnimplementedExecutorServer) GetMainTf(context.Context, *GetMainTfRequest) (*GetMainTfResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetMainTf not implemented")
 }
+func (UnimplementedExecutorServer) GetLockFile(context.Context, *GetLockFileRequest) (*GetLockFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLockFile not implemented")
+}
+func (UnimplementedExecutorServer) SetLockFile(context.Context, *SetLockFileRequest) (*SetLockFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLockFile not implemented")
+}
+func (UnimplementedExecutorServer) GetSecretHashes(context.Context, *GetSecretHashesRequest) (*GetSecretHashesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSecretHashes not implemented")
+}
+func (UnimplementedExecutorServer) UpgradeTerraform(context.Context, *UpgradeTerraformRequest) (*UpgradeTerraformResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpgradeTerraform not implemented")
+}
+func (UnimplementedExecutorServer) ListVariables(context.Context, *ListVariablesRequest) (*ListVariablesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVariables not implemented")
+}
+func (UnimplementedExecutorServer) Graph(context.Context, *GraphRequest) (*GraphResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Graph not implemented")
+}
+func (UnimplementedExecutorServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (UnimplementedExecutorServer) Validate(context.Context, *ValidateRequest) (*ValidateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Validate not implemented")
+}
+func (UnimplementedExecutorServer) Fmt(context.Context, *FmtRequest) (*FmtResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Fmt not implemented")
+}
+func (UnimplementedExecutorServer) SetVariables(context.Context, *SetVariablesRequest) (*SetVariablesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetVariables not implemented")
+}
+func (UnimplementedExecutorServer) GetVariables(context.Context, *GetVariablesRequest) (*GetVariablesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVariables not implemented")
+}
+func (UnimplementedExecutorServer) Output(context.Context, *OutputRequest) (*OutputResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Output not implemented")
+}
+func (UnimplementedExecutorServer) ListWorkspaces(context.Context, *ListWorkspacesRequest) (*ListWorkspacesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWorkspaces not implemented")
+}
+func (UnimplementedExecutorServer) ListContexts(context.Context, *ListContextsRequest) (*ListContextsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListContexts not implemented")
+}
+func (UnimplementedExecutorServer) Import(context.Context, *ImportRequest) (*ImportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Import not implemented")
+}
+func (UnimplementedExecutorServer) Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
 func (UnimplementedExecutorServer) mustEmbedUnimplementedExecutorServer() {}
 func (UnimplementedExecutorServer) testEmbeddedByValue()                  {}
 
@@ -434,6 +753,17 @@ func _Executor_Apply_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Executor_StreamApply_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ApplyRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ExecutorServer).StreamApply(m, &grpc.GenericServerStream[ApplyRequest, ApplyChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Executor_StreamApplyServer = grpc.ServerStreamingServer[ApplyChunk]
+
 func _Executor_Destroy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(DestroyRequest)
 	if err := dec(in); err != nil {
@@ -686,6 +1016,294 @@ func _Executor_GetMainTf_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Executor_GetLockFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLockFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).GetLockFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_GetLockFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).GetLockFile(ctx, req.(*GetLockFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_SetLockFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLockFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).SetLockFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_SetLockFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).SetLockFile(ctx, req.(*SetLockFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_GetSecretHashes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSecretHashesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).GetSecretHashes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_GetSecretHashes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).GetSecretHashes(ctx, req.(*GetSecretHashesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_UpgradeTerraform_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpgradeTerraformRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).UpgradeTerraform(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_UpgradeTerraform_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).UpgradeTerraform(ctx, req.(*UpgradeTerraformRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_ListVariables_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVariablesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).ListVariables(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_ListVariables_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).ListVariables(ctx, req.(*ListVariablesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_Graph_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GraphRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Graph(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Graph_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Graph(ctx, req.(*GraphRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Health_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_Validate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Validate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Validate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Validate(ctx, req.(*ValidateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_Fmt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FmtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Fmt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Fmt_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Fmt(ctx, req.(*FmtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_SetVariables_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetVariablesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).SetVariables(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_SetVariables_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).SetVariables(ctx, req.(*SetVariablesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_GetVariables_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVariablesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).GetVariables(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_GetVariables_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).GetVariables(ctx, req.(*GetVariablesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_Output_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OutputRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Output(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Output_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Output(ctx, req.(*OutputRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_ListWorkspaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWorkspacesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).ListWorkspaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_ListWorkspaces_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).ListWorkspaces(ctx, req.(*ListWorkspacesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_ListContexts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListContextsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).ListContexts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_ListContexts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).ListContexts(ctx, req.(*ListContextsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_Import_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Import(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Import_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Import(ctx, req.(*ImportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Refresh_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Refresh(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Executor_ServiceDesc is the grpc.ServiceDesc for Executor service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -761,7 +1379,77 @@ var Executor_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetMainTf",
 			Handler:    _Executor_GetMainTf_Handler,
 		},
+		{
+			MethodName: "GetLockFile",
+			Handler:    _Executor_GetLockFile_Handler,
+		},
+		{
+			MethodName: "SetLockFile",
+			Handler:    _Executor_SetLockFile_Handler,
+		},
+		{
+			MethodName: "GetSecretHashes",
+			Handler:    _Executor_GetSecretHashes_Handler,
+		},
+		{
+			MethodName: "UpgradeTerraform",
+			Handler:    _Executor_UpgradeTerraform_Handler,
+		},
+		{
+			MethodName: "ListVariables",
+			Handler:    _Executor_ListVariables_Handler,
+		},
+		{
+			MethodName: "Graph",
+			Handler:    _Executor_Graph_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _Executor_Health_Handler,
+		},
+		{
+			MethodName: "Validate",
+			Handler:    _Executor_Validate_Handler,
+		},
+		{
+			MethodName: "Fmt",
+			Handler:    _Executor_Fmt_Handler,
+		},
+		{
+			MethodName: "SetVariables",
+			Handler:    _Executor_SetVariables_Handler,
+		},
+		{
+			MethodName: "GetVariables",
+			Handler:    _Executor_GetVariables_Handler,
+		},
+		{
+			MethodName: "Output",
+			Handler:    _Executor_Output_Handler,
+		},
+		{
+			MethodName: "ListWorkspaces",
+			Handler:    _Executor_ListWorkspaces_Handler,
+		},
+		{
+			MethodName: "ListContexts",
+			Handler:    _Executor_ListContexts_Handler,
+		},
+		{
+			MethodName: "Import",
+			Handler:    _Executor_Import_Handler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    _Executor_Refresh_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamApply",
+			Handler:       _Executor_StreamApply_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "executor.proto",
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Codes returned in ErrorResponse.Code. Unlike TerraformResponse.ErrorCode,
+// which classifies terraform failures, these describe why a request could
+// not be processed at all. They are stable; clients may branch on them.
+const (
+	APIErrorMethodNotAllowed     = "method_not_allowed"
+	APIErrorInvalidBody          = "invalid_body"
+	APIErrorInvalidRequest       = "invalid_request"
+	APIErrorUnknownAction        = "unknown_action"
+	APIErrorUnknownModel         = "unknown_model"
+	APIErrorForbidden            = "forbidden"
+	APIErrorNotFound             = "not_found"
+	APIErrorInvalidConfig        = "invalid_config"
+	APIErrorNothingToApply       = "nothing_to_apply"
+	APIErrorCooldown             = "cooldown"
+	APIErrorRateLimited          = "rate_limited"
+	APIErrorWorkspaceBusy        = "workspace_busy"
+	APIErrorWorkspaceNotEmpty    = "workspace_not_empty"
+	APIErrorCodeGenerationFailed = "code_generation_failed"
+	APIErrorNotInfrastructure    = "not_infrastructure"
+	APIErrorExecutorUnavailable  = "executor_unavailable"
+	APIErrorTimeout              = "timeout"
+	APIErrorInternal             = "internal"
+	APIErrorQueueFull            = "queue_full"
+	APIErrorShuttingDown         = "shutting_down"
+)
+
+// ErrorResponse is the body of every error the API returns.
+type ErrorResponse struct {
+	Code    string `json:"code"`              // One of the APIError* codes
+	Message string `json:"message"`           // Human-readable summary
+	Details string `json:"details,omitempty"` // Underlying error, when there is one
+}
+
+// errCodeGeneration wraps errors from the initial code generation, so the
+// handler can report them as code_generation_failed.
+var errCodeGeneration = errors.New("Failed to generate code")
+
+// errNotInfrastructure is returned when the model generated no code, as the
+// prompts ask it to for tasks that are not about infrastructure.
+var errNotInfrastructure = errors.New("request does not appear to be infrastructure-related")
+
+func writeError(w http.ResponseWriter, statusCode int, code, message, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{Code: code, Message: message, Details: details})
+}
+
+// writeProcessingError reports an error from processing a request, with the
+// code and status of its cause.
+func writeProcessingError(w http.ResponseWriter, err error) {
+	statusCode, response := processingError(err)
+	writeError(w, statusCode, response.Code, response.Message, response.Details)
+}
+
+// processingError classifies an error from processing a request, returning
+// the status and body to report it with.
+func processingError(err error) (int, ErrorResponse) {
+	details := err.Error()
+	switch {
+	case errors.Is(err, errWorkspaceBusy):
+		return http.StatusConflict, ErrorResponse{Code: APIErrorWorkspaceBusy, Message: errWorkspaceBusy.Error(), Details: details}
+	case isTimeout(err):
+		return http.StatusGatewayTimeout, ErrorResponse{Code: APIErrorTimeout, Message: "An LLM or executor call timed out", Details: details}
+	case errors.Is(err, errNotInfrastructure):
+		return http.StatusUnprocessableEntity, ErrorResponse{Code: APIErrorNotInfrastructure, Message: errNotInfrastructure.Error()}
+	case errors.Is(err, errCodeGeneration):
+		return http.StatusBadGateway, ErrorResponse{Code: APIErrorCodeGenerationFailed, Message: errCodeGeneration.Error(), Details: strings.TrimPrefix(details, errCodeGeneration.Error()+": ")}
+	case status.Code(err) == codes.Unavailable:
+		return http.StatusServiceUnavailable, ErrorResponse{Code: APIErrorExecutorUnavailable, Message: "Executor unavailable", Details: details}
+	default:
+		return http.StatusInternalServerError, ErrorResponse{Code: APIErrorInternal, Message: "Failed to process request", Details: details}
+	}
+}
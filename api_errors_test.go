@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerErrorsAreJSON(t *testing.T) {
+	s := newTestService(&Config{AdminToken: "admin"})
+	s.executorClient = newFakeExecutor()
+	unlock, err := s.workspaceLocks.lock(context.Background(), "ctx", "busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		admin      bool
+		serve      func(http.ResponseWriter, *http.Request)
+		wantStatus int
+		wantCode   string
+	}{
+		{"wrong method", http.MethodPost, "/contexts", false, s.handleContexts, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed},
+		{"not admin", http.MethodPost, "/reload", false, s.handleReload, http.StatusForbidden, APIErrorForbidden},
+		{"missing job", http.MethodGet, "/jobs/missing", false, s.handleJob, http.StatusNotFound, APIErrorNotFound},
+		{"missing code", http.MethodGet, "/code?id=missing", false, s.handleCode, http.StatusNotFound, APIErrorNotFound},
+		{"history without workspace", http.MethodGet, "/history", false, s.handleHistory, http.StatusBadRequest, APIErrorInvalidRequest},
+		{"busy workspace", http.MethodDelete, "/contexts/ctx/workspaces/busy", true, s.handleWorkspaceDelete, http.StatusConflict, APIErrorWorkspaceBusy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.SetPathValue("id", "missing")
+			req.SetPathValue("name", "ctx")
+			req.SetPathValue("workspace", "busy")
+			if tt.admin {
+				req.Header.Set("X-Admin-Token", "admin")
+			}
+			w := httptest.NewRecorder()
+			tt.serve(w, req)
+
+			var body ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not a JSON error: %v", w.Body, err)
+			}
+			if w.Code != tt.wantStatus || body.Code != tt.wantCode {
+				t.Errorf("status = %d, code = %q, want %d, %q", w.Code, body.Code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
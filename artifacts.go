@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const artifactNamespace = "artifacts"
+
+// putArtifact stores the full text of a truncated output and returns its ID.
+func (s *Service) putArtifact(ctx context.Context, content string) (string, error) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	ttl := time.Duration(s.config().ArtifactTTLSeconds) * time.Second
+	if err := s.store.Put(ctx, artifactNamespace, id, []byte(content), ttl); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// truncateOutput keeps the first head and last tail lines of output and
+// replaces the rest with a marker.
+func truncateOutput(output string, head, tail int) string {
+	lines := strings.Split(output, "\n")
+	if len(lines) <= head+tail {
+		return output
+	}
+
+	truncated := len(lines) - head - tail
+	result := make([]string, 0, head+tail+1)
+	result = append(result, lines[:head]...)
+	result = append(result, fmt.Sprintf("[...truncated %d lines...]", truncated))
+	result = append(result, lines[len(lines)-tail:]...)
+	return strings.Join(result, "\n")
+}
+
+// truncateResponseOutputs shortens each oversized output in place and stores
+// its full text as an artifact, referenced from response.Artifacts by the
+// output's JSON name. Outputs with the same text, such as output and
+// apply_output after an apply, share one artifact. Outputs are left untouched
+// if their artifact can't be stored.
+func (s *Service) truncateResponseOutputs(ctx context.Context, response *TerraformResponse) {
+	cfg := s.config().OutputTruncation
+	if cfg.MaxLines <= 0 {
+		return
+	}
+
+	stored := make(map[string]string) // Artifact IDs by full text
+	truncate := func(name string, output *string) {
+		if strings.Count(*output, "\n")+1 <= cfg.MaxLines {
+			return
+		}
+		id, ok := stored[*output]
+		if !ok {
+			var err error
+			if id, err = s.putArtifact(ctx, *output); err != nil {
+				s.runLogger(ctx).Warn("failed to store artifact", "field", name, "error", err)
+				return
+			}
+			stored[*output] = id
+		}
+		if response.Artifacts == nil {
+			response.Artifacts = make(map[string]string)
+		}
+		response.Artifacts[name] = id
+		*output = truncateOutput(*output, cfg.HeadLines, cfg.TailLines)
+	}
+
+	truncate("output", &response.Output)
+	truncate("plan_output", &response.PlanOutput)
+	truncate("apply_output", &response.ApplyOutput)
+	truncate("import_output", &response.ImportOutput)
+	truncate("init_output", &response.InitOutput)
+}
+
+func (s *Service) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	content, err := s.store.Get(r.Context(), artifactNamespace, r.URL.Query().Get("id"))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, APIErrorNotFound, "Artifact not found", "")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to load artifact", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(content)
+}
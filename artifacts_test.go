@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns n lines reading "line 1", "line 2" and so on.
+func numberedLines(n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestTruncateOutput(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		head, tail int
+		want       string
+	}{
+		{
+			name:   "short enough",
+			output: numberedLines(4),
+			head:   2,
+			tail:   2,
+			want:   numberedLines(4),
+		},
+		{
+			name:   "head and tail",
+			output: numberedLines(6),
+			head:   2,
+			tail:   1,
+			want:   "line 1\nline 2\n[...truncated 3 lines...]\nline 6",
+		},
+		{
+			name:   "tail only",
+			output: numberedLines(5),
+			head:   0,
+			tail:   2,
+			want:   "[...truncated 3 lines...]\nline 4\nline 5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateOutput(tt.output, tt.head, tt.tail); got != tt.want {
+				t.Errorf("truncateOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateResponseOutputs(t *testing.T) {
+	long, short := numberedLines(10), numberedLines(3)
+	tests := []struct {
+		name          string
+		response      TerraformResponse
+		wantArtifacts []string // Outputs expected to be truncated, by JSON name
+		wantShared    [][2]string
+	}{
+		{
+			name:     "nothing to truncate",
+			response: TerraformResponse{Output: short, PlanOutput: short},
+		},
+		{
+			name:          "apply",
+			response:      TerraformResponse{Output: long, PlanOutput: long + "\nplan", ApplyOutput: long, InitOutput: short},
+			wantArtifacts: []string{"output", "plan_output", "apply_output"},
+			wantShared:    [][2]string{{"output", "apply_output"}},
+		},
+		{
+			name:          "import",
+			response:      TerraformResponse{Output: short, PlanOutput: short, ImportOutput: long},
+			wantArtifacts: []string{"import_output"},
+		},
+		{
+			name:          "apply output only",
+			response:      TerraformResponse{Output: short, ApplyOutput: long, InitOutput: long + "\ninit"},
+			wantArtifacts: []string{"apply_output", "init_output"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{ArtifactTTLSeconds: 60}
+			config.OutputTruncation.MaxLines, config.OutputTruncation.HeadLines, config.OutputTruncation.TailLines = 4, 2, 2
+			s := &Service{store: newMemoryStore(0), currentConfig: config}
+			response := tt.response
+			s.truncateResponseOutputs(context.Background(), &response)
+
+			fields := map[string][2]string{
+				"output":        {tt.response.Output, response.Output},
+				"plan_output":   {tt.response.PlanOutput, response.PlanOutput},
+				"apply_output":  {tt.response.ApplyOutput, response.ApplyOutput},
+				"import_output": {tt.response.ImportOutput, response.ImportOutput},
+				"init_output":   {tt.response.InitOutput, response.InitOutput},
+			}
+			if len(response.Artifacts) != len(tt.wantArtifacts) {
+				t.Errorf("Artifacts = %v, want %v", response.Artifacts, tt.wantArtifacts)
+			}
+			for _, name := range tt.wantArtifacts {
+				original, truncated := fields[name][0], fields[name][1]
+				if truncated != truncateOutput(original, 2, 2) {
+					t.Errorf("%s = %q, want it truncated", name, truncated)
+				}
+				stored, err := s.store.Get(context.Background(), artifactNamespace, response.Artifacts[name])
+				if err != nil {
+					t.Fatalf("%s artifact: %v", name, err)
+				}
+				if string(stored) != original {
+					t.Errorf("%s artifact = %q, want the full output %q", name, stored, original)
+				}
+				delete(fields, name)
+			}
+			for name, field := range fields {
+				if field[0] != field[1] {
+					t.Errorf("%s = %q, want it unchanged", name, field[1])
+				}
+			}
+			for _, pair := range tt.wantShared {
+				if response.Artifacts[pair[0]] != response.Artifacts[pair[1]] {
+					t.Errorf("%s and %s have different artifacts, want one shared", pair[0], pair[1])
+				}
+			}
+		})
+	}
+}
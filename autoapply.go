@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// AutoApplyDecision explains whether an auto_apply request was applied.
+type AutoApplyDecision struct {
+	Applied    bool     `json:"applied"`
+	Confidence float64  `json:"confidence"`
+	Threshold  float64  `json:"threshold"`
+	Risks      []string `json:"risks,omitempty"`
+	Rationale  string   `json:"rationale"`
+}
+
+// critique is the model's review of a plan.
+type critique struct {
+	Confidence float64  `json:"confidence"`
+	Risks      []string `json:"risks"`
+	Summary    string   `json:"summary"`
+}
+
+func generateCritiquePrompt(description, code, planOutput string) string {
+	return fmt.Sprintf(`You are a senior DevOps engineer reviewing a Terraform change before it is applied automatically.
+
+	Requested Changes:
+	%s
+
+	Terraform Code:
+	%s
+
+	Terraform Plan Output:
+	%s
+
+	Requirements:
+	1. Judge whether the plan does exactly what was requested and is safe to apply without human review
+	2. List concrete risks: unexpected replacements or deletions, downtime, data loss, cost, security exposure
+	3. Give a confidence between 0 and 1 that applying is safe and correct
+	4. Respond ONLY with JSON of the form {"confidence": 0.0, "risks": ["..."], "summary": "..."}`,
+		description,
+		code,
+		planOutput,
+	)
+}
+
+// critiquePlan asks the model to review a plan before it is auto-applied.
+func (s *Service) critiquePlan(ctx context.Context, description, code, planOutput string) (*critique, *generation, error) {
+	gen, err := s.complete(ctx, s.auxiliaryModel(anthropic.ModelClaude3_5SonnetLatest), generateCritiquePrompt(description, code, planOutput), 1024)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to critique plan: %v", err)
+	}
+
+	text := gen.Code
+	if start, end := strings.Index(text, "{"), strings.LastIndex(text, "}"); start >= 0 && end > start {
+		text = text[start : end+1]
+	}
+	var c critique
+	if err := json.Unmarshal([]byte(text), &c); err != nil {
+		return nil, gen, fmt.Errorf("failed to parse plan critique: %v", err)
+	}
+	return &c, gen, nil
+}
+
+// autoApply decides whether a successful plan is applied without human
+// approval. The plan is applied only if the critique confidence reaches the
+// configured threshold and the plan passes policy checks; otherwise the plan
+// is returned as is with the rationale for escalating.
+func (s *Service) autoApply(ctx context.Context, req TerraformRequest, response *TerraformResponse, usage *llmUsage) {
+	decision := &AutoApplyDecision{Threshold: s.config().AutoApply.ConfidenceThreshold}
+	response.AutoApply = decision
+
+	c, gen, err := s.critiquePlan(ctx, req.Description, response.Code, response.Output)
+	if gen != nil {
+		usage.record(gen, s.config().ModelPricing)
+	}
+	if err != nil {
+		decision.Rationale = fmt.Sprintf("not applied: %v", err)
+		return
+	}
+	decision.Confidence = c.Confidence
+	decision.Risks = c.Risks
+
+	if c.Confidence < decision.Threshold {
+		decision.Rationale = fmt.Sprintf("not applied: confidence %.2f is below the threshold %.2f. %s", c.Confidence, decision.Threshold, c.Summary)
+		return
+	}
+
+	if !req.features.PolicyChecks && !s.config().AutoApply.AllowWithoutPolicyChecks {
+		decision.Rationale = "not applied: policy checks are disabled for this context"
+		return
+	}
+	applyCtx := ctx
+	if s.checkPlanBeforeApply(req) {
+		plan, err := s.savedPlan(ctx, req.Context, req.Workspace, nil)
+		if err != nil {
+			decision.Rationale = fmt.Sprintf("not applied: policy check failed: %v", err)
+			return
+		}
+		blocked, err := s.checkProtectedReplacements(req, plan)
+		if err != nil {
+			decision.Rationale = fmt.Sprintf("not applied: policy check failed: %v", err)
+			return
+		}
+		if len(blocked) > 0 {
+			response.BlockedResources = blocked
+			decision.Rationale = fmt.Sprintf("not applied: plan replaces protected resources: %s", strings.Join(blocked, ", "))
+			return
+		}
+		webhook, err := s.checkValidationWebhook(ctx, req, req.Workspace, response.Code, plan)
+		if err != nil {
+			decision.Rationale = fmt.Sprintf("not applied: validation webhook failed: %v", err)
+			return
+		}
+		if webhook != nil && !webhook.Allow {
+			response.ValidationWebhook = webhook
+			decision.Rationale = fmt.Sprintf("not applied: %s", webhookDeniedError(webhook))
+			return
+		}
+		if plan.planFile != "" {
+			applyCtx = withPlanFile(ctx, plan.planFile)
+		}
+	}
+
+	unlock, err := s.workspaceLocks.lock(ctx, req.Context, req.Workspace)
+	if err != nil {
+		decision.Rationale = fmt.Sprintf("not applied: %v", err)
+		return
+	}
+	defer unlock()
+	if current, err := s.workspaceCode(ctx, req.Context, req.Workspace); err != nil || codeID(current) != codeID(response.Code) {
+		decision.Rationale = "not applied: the workspace code changed after the plan"
+		return
+	}
+
+	s.runLogger(ctx).Info("auto-applying", "context", req.Context, "workspace", req.Workspace, "confidence", c.Confidence)
+	applied, err := s.executeAction(applyCtx, ActionApply, req.Context, req.Workspace)
+	if err != nil {
+		decision.Rationale = fmt.Sprintf("apply attempted after passing confidence and policy checks, but failed: %v", err)
+		response.Success = false
+		response.Error = err.Error()
+		return
+	}
+
+	decision.Applied = true
+	decision.Rationale = fmt.Sprintf("applied: confidence %.2f reached the threshold %.2f and the plan passed policy checks. %s", c.Confidence, decision.Threshold, c.Summary)
+	response.Success = applied.Success && applied.Error == ""
+	response.Output = applied.Output
+	response.PlanOutput = applied.PlanOutput
+	response.ApplyOutput = applied.ApplyOutput
+	response.Error = applied.Error
+	response.planJSON = applied.planJSON
+}
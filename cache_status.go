@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Caches that can serve part of a request, as reported in
+// TerraformResponse.CacheHits.
+const (
+	CacheGeneration       = "generation"
+	CacheErrorExplanation = "error_explanation"
+	CacheWorkspaceCode    = "workspace_code"
+)
+
+// cacheStatus tracks which caches served a request, and whether the request
+// asked to bypass them with no_cache. Caches still store fresh results for a
+// bypassed request, so no_cache also refreshes them.
+type cacheStatus struct {
+	bypass bool
+
+	mu   sync.Mutex
+	hits map[string]bool
+}
+
+type cacheStatusKey struct{}
+
+func withCacheStatus(ctx context.Context, bypass bool) (context.Context, *cacheStatus) {
+	status := &cacheStatus{bypass: bypass, hits: make(map[string]bool)}
+	return context.WithValue(ctx, cacheStatusKey{}, status), status
+}
+
+// cacheBypassed reports whether the request in ctx asked for no_cache.
+func cacheBypassed(ctx context.Context) bool {
+	status, ok := ctx.Value(cacheStatusKey{}).(*cacheStatus)
+	return ok && status.bypass
+}
+
+// recordCacheHit notes that a cache served part of the request in ctx.
+func recordCacheHit(ctx context.Context, cache string) {
+	status, ok := ctx.Value(cacheStatusKey{}).(*cacheStatus)
+	if !ok {
+		return
+	}
+	status.mu.Lock()
+	status.hits[cache] = true
+	status.mu.Unlock()
+}
+
+func (c *cacheStatus) hitCaches() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	caches := make([]string, 0, len(c.hits))
+	for cache := range c.hits {
+		caches = append(caches, cache)
+	}
+	sort.Strings(caches)
+	return caches
+}
+
+// header returns the Cache-Status header value (RFC 9211) for the request.
+func (c *cacheStatus) header() string {
+	if c.bypass {
+		return "request-processor; fwd=bypass"
+	}
+	if caches := c.hitCaches(); len(caches) > 0 {
+		return fmt.Sprintf("request-processor; hit; detail=%q", strings.Join(caches, ","))
+	}
+	return "request-processor; fwd=miss"
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// Job callback delivery: each attempt has callbackTimeout, and failed
+// attempts are retried after callbackRetryDelay, then twice as long each
+// time.
+const (
+	callbackAttempts = 4
+	callbackTimeout  = 10 * time.Second
+)
+
+var callbackRetryDelay = time.Second
+
+// errInternalCallbackAddress is returned for callbacks to addresses inside
+// the service's network. They are refused so a request can't make the
+// service post to internal endpoints, such as cloud metadata services.
+var errInternalCallbackAddress = errors.New("callback_url must not point to a private, loopback or link-local address")
+
+// internalIP reports whether ip is an address callbacks are refused for.
+func internalIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// validateCallbackURL checks a request's callback_url. URLs naming an
+// internal IP address are refused unless allowedHosts lists it; hostnames
+// are checked once resolved, when the callback is delivered.
+func validateCallbackURL(callbackURL string, async bool, allowedHosts []string) error {
+	if !async {
+		return fmt.Errorf("callback_url requires async")
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute http or https URL")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && internalIP(ip) && !slices.Contains(allowedHosts, u.Hostname()) {
+		return errInternalCallbackAddress
+	}
+	return nil
+}
+
+// newCallbackClient returns the client callbacks are delivered with. It
+// refuses to connect to internal addresses, checking the resolved address
+// of every connection, redirects included, so hostnames resolving to
+// internal addresses are refused too. Hosts in allowedHosts are exempt.
+// Proxies from the environment are not used, as they would hide the
+// address.
+func newCallbackClient(allowedHosts []string) *http.Client {
+	open := &net.Dialer{Timeout: callbackTimeout}
+	guarded := &net.Dialer{
+		Timeout: callbackTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+				return errInternalCallbackAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if host, _, err := net.SplitHostPort(address); err == nil && slices.Contains(allowedHosts, host) {
+				return open.DialContext(ctx, network, address)
+			}
+			return guarded.DialContext(ctx, network, address)
+		},
+		TLSHandshakeTimeout: callbackTimeout,
+	}}
+}
+
+// deliverCallback posts the outcome of a finished job to its callback URL:
+// the final response, or for a failed job a failed response with the
+// error. X-Job-ID and X-Job-Status identify the job. Delivery failures are
+// only logged; the job's recorded outcome stands.
+func (s *Service) deliverCallback(ctx context.Context, callbackURL string, job *Job) {
+	response := job.Response
+	if response == nil {
+		response = &TerraformResponse{Success: false}
+		if job.Error != nil {
+			response.Error = job.Error.Message
+			if job.Error.Details != "" {
+				response.Error += ": " + job.Error.Details
+			}
+		}
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		s.runLogger(ctx).Error("failed to encode callback", "job_id", job.ID, "error", err)
+		return
+	}
+
+	delay := callbackRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := s.postCallback(ctx, callbackURL, job, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == callbackAttempts {
+			s.runLogger(ctx).Error("failed to deliver callback", "job_id", job.ID, "attempts", attempt, "error", err)
+			return
+		}
+		if !sleepContext(ctx, delay) {
+			s.runLogger(ctx).Error("gave up delivering callback", "job_id", job.ID, "attempts", attempt, "error", ctx.Err())
+			return
+		}
+		delay *= 2
+	}
+}
+
+// postCallback makes one callback delivery attempt. It reports whether a
+// failure is worth retrying: network errors, 429s and 5xx responses are,
+// refused internal addresses are not.
+func (s *Service) postCallback(ctx context.Context, callbackURL string, job *Job, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, callbackTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create callback request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-ID", job.ID)
+	req.Header.Set("X-Job-Status", job.Status)
+	signBody(req, s.config().WebhookSecret, body)
+
+	resp, err := s.callbackClient.Do(req)
+	if err != nil {
+		return !errors.Is(err, errInternalCallbackAddress), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("callback returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return false, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		async   bool
+		allowed []string
+		wantErr string // Expected in the error; no error when empty
+	}{
+		{"public host", "https://hooks.example.com/jobs", true, nil, ""},
+		{"public IP", "http://93.184.216.34/jobs", true, nil, ""},
+		{"not async", "https://hooks.example.com/jobs", false, nil, "requires async"},
+		{"relative", "/jobs", true, nil, "absolute http or https URL"},
+		{"other scheme", "ftp://hooks.example.com/jobs", true, nil, "absolute http or https URL"},
+		{"loopback", "http://127.0.0.1:8080/jobs", true, nil, "private, loopback or link-local"},
+		{"IPv6 loopback", "http://[::1]:8080/jobs", true, nil, "private, loopback or link-local"},
+		{"private", "http://10.0.0.5/jobs", true, nil, "private, loopback or link-local"},
+		{"metadata service", "http://169.254.169.254/latest/meta-data", true, nil, "private, loopback or link-local"},
+		{"unspecified", "http://0.0.0.0/jobs", true, nil, "private, loopback or link-local"},
+		{"allowed internal host", "http://10.0.0.5/jobs", true, []string{"10.0.0.5"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCallbackURL(tt.url, tt.async, tt.allowed)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateCallbackURL() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateCallbackURL() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// callbackServer records the callbacks it receives and answers them with
+// statuses in turn, then 200.
+type callbackServer struct {
+	mu       sync.Mutex
+	statuses []int
+	jobIDs   []string
+}
+
+func (c *callbackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jobIDs = append(c.jobIDs, r.Header.Get("X-Job-ID"))
+	status := http.StatusOK
+	if len(c.statuses) > 0 {
+		status, c.statuses = c.statuses[0], c.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (c *callbackServer) attempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.jobIDs)
+}
+
+func TestDeliverCallback(t *testing.T) {
+	delay := callbackRetryDelay
+	callbackRetryDelay = 0
+	t.Cleanup(func() { callbackRetryDelay = delay })
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+	}{
+		{"delivered", nil, 1},
+		{"server error retried", []int{http.StatusBadGateway, http.StatusServiceUnavailable}, 3},
+		{"rate limit retried", []int{http.StatusTooManyRequests}, 2},
+		{"client error not retried", []int{http.StatusNotFound}, 1},
+		{"attempts exhausted", []int{500, 500, 500, 500, 500}, callbackAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &callbackServer{statuses: tt.statuses}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+			u, _ := url.Parse(server.URL)
+			s := newTestService(&Config{CallbackAllowedHosts: []string{u.Hostname()}})
+
+			s.deliverCallback(context.Background(), server.URL, &Job{ID: "job-1", Status: JobSucceeded, Response: &TerraformResponse{Success: true}})
+			if got := receiver.attempts(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if receiver.jobIDs[0] != "job-1" {
+				t.Errorf("X-Job-ID = %q, want job-1", receiver.jobIDs[0])
+			}
+		})
+	}
+}
+
+func TestCallbackRefusesInternalAddresses(t *testing.T) {
+	receiver := &callbackServer{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	s := newTestService(nil)
+
+	for _, callbackURL := range []string{server.URL, "http://localhost:" + u.Port()} {
+		retry, err := s.postCallback(context.Background(), callbackURL, &Job{ID: "job-1"}, []byte("{}"))
+		if !errors.Is(err, errInternalCallbackAddress) {
+			t.Errorf("post to %s: error = %v, want %v", callbackURL, err, errInternalCallbackAddress)
+		}
+		if retry {
+			t.Errorf("post to %s: refused address would be retried", callbackURL)
+		}
+	}
+	if got := receiver.attempts(); got != 0 {
+		t.Errorf("server received %d callbacks, want none", got)
+	}
+}
+
+func TestDeliverCallbackStopsWhenContextDone(t *testing.T) {
+	receiver := &callbackServer{statuses: []int{500, 500, 500, 500}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	s := newTestService(&Config{CallbackAllowedHosts: []string{u.Hostname()}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.deliverCallback(ctx, server.URL, &Job{ID: "job-1", Status: JobFailed})
+	if got := receiver.attempts(); got > 1 {
+		t.Errorf("attempts = %d, want no retry once the context is done", got)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	applySummaryLine   = regexp.MustCompile(`(?:Apply|Destroy) complete! Resources: (?:(\d+) added, (\d+) changed, )?(\d+) destroyed`)
+	planSummaryLine    = regexp.MustCompile(`Plan: (\d+) to add, (\d+) to change, (\d+) to destroy`)
+	terraformOutputVar = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_\-]*) = (.+)$`)
+)
+
+// maxSummaryOutputs is how many terraform outputs a chat summary mentions.
+const maxSummaryOutputs = 3
+
+// changeCounts are the resource counts terraform reports after a plan, apply
+// or destroy.
+type changeCounts struct {
+	Add, Change, Destroy int
+}
+
+// parseChangeCounts reads the summary line of terraform output. ok is false
+// if output has none.
+func parseChangeCounts(output string) (counts changeCounts, ok bool) {
+	if m := applySummaryLine.FindStringSubmatch(output); m != nil {
+		counts.Add, _ = strconv.Atoi(m[1])
+		counts.Change, _ = strconv.Atoi(m[2])
+		counts.Destroy, _ = strconv.Atoi(m[3])
+		return counts, true
+	}
+	if m := planSummaryLine.FindStringSubmatch(output); m != nil {
+		counts.Add, _ = strconv.Atoi(m[1])
+		counts.Change, _ = strconv.Atoi(m[2])
+		counts.Destroy, _ = strconv.Atoi(m[3])
+		return counts, true
+	}
+	if planHasNoChanges(output) {
+		return counts, true
+	}
+	return counts, false
+}
+
+// terraformOutputValues reads the "Outputs:" section printed after an apply.
+// Sensitive and multi-line values are left out.
+func terraformOutputValues(output string) map[string]string {
+	_, section, ok := strings.Cut(output, "\nOutputs:\n")
+	if !ok {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, line := range strings.Split(section, "\n") {
+		m := terraformOutputVar.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		value := m[2]
+		if value == "<sensitive>" || value == "[" || value == "{" || strings.HasPrefix(value, "tolist(") || strings.HasPrefix(value, "tomap(") {
+			continue
+		}
+		values[m[1]] = strings.Trim(value, `"`)
+	}
+	return values
+}
+
+// plural formats n with noun, e.g. "1 resource" or "3 resources".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// chatSummary describes the outcome of a request in a sentence or two, from
+// the parsed response rather than an LLM call, for chat clients.
+func chatSummary(req TerraformRequest, response *TerraformResponse) string {
+	if len(response.Regions) > 0 {
+		return multiSummary(response.Regions, "region")
+	}
+	if len(response.Workspaces) > 0 {
+		summary := multiSummary(response.Workspaces, "workspace")
+		if response.Transaction != "" {
+			summary += fmt.Sprintf(" (%s)", strings.ReplaceAll(response.Transaction, "_", " "))
+		}
+		return summary
+	}
+
+	if !response.Success || response.Error != "" {
+		reason := response.Error
+		if causes := terraformErrorLine.FindStringSubmatch(response.Error); causes != nil {
+			reason = causes[1]
+		}
+		reason, _, _ = strings.Cut(strings.TrimSpace(reason), "\n")
+		return fmt.Sprintf("❌ %s failed: %s", capitalize(string(req.Action)), reason)
+	}
+	if req.DryRun {
+		return "📝 Generated the code without running it; pass code_id to run it."
+	}
+	if response.ChangePreview != "" {
+		return "📝 Prepared a preview of the changes; nothing was run."
+	}
+
+	switch req.Action {
+	case ActionValidate:
+		return "✅ The configuration is valid."
+	case ActionFmt:
+		return "✅ Formatted the code."
+	case ActionRefresh:
+		if len(response.Drift) > 0 {
+			return fmt.Sprintf("⚠️ %s changed outside Terraform.", plural(len(response.Drift), "resource"))
+		}
+		if response.NoChanges {
+			return "✅ No drift: the resources match the state."
+		}
+	case ActionGraph:
+		if response.Graph != nil {
+			return fmt.Sprintf("✅ Built the dependency graph of %s.", plural(response.Graph.TotalNodes, "node"))
+		}
+		return "✅ Built the dependency graph."
+	}
+
+	output := response.Output
+	applied := req.Action == ActionApply || req.Action == ActionDestroy
+	if response.AutoApply != nil && response.AutoApply.Applied {
+		applied = true
+	}
+	counts, ok := parseChangeCounts(output)
+	if !ok && response.ApplyOutput != "" {
+		counts, ok = parseChangeCounts(response.ApplyOutput)
+	}
+
+	var summary string
+	switch {
+	case !ok:
+		summary = fmt.Sprintf("✅ %s succeeded", capitalize(string(req.Action)))
+	case counts == changeCounts{} && applied:
+		summary = "✅ Everything was already up to date"
+	case counts == changeCounts{}:
+		summary = "📝 Plan: no changes needed"
+	case applied:
+		summary = "✅ " + capitalize(describeCounts(counts, "created", "updated", "destroyed"))
+	default:
+		summary = "📝 Plan would " + describeCounts(counts, "create", "update", "destroy")
+	}
+	if regions := placementRegions(response.Placements); len(regions) > 0 {
+		summary += " in " + strings.Join(regions, ", ")
+	}
+
+	if values := terraformOutputValues(output); len(values) > 0 && applied {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) > maxSummaryOutputs {
+			names = names[:maxSummaryOutputs]
+		}
+		var parts []string
+		for _, name := range names {
+			parts = append(parts, fmt.Sprintf("%s is %s", name, values[name]))
+		}
+		summary += "; your " + strings.Join(parts, ", ")
+	}
+	return summary + "."
+}
+
+// describeCounts lists the non-zero counts, e.g. "created 3 resources and
+// destroyed 1 resource".
+func describeCounts(counts changeCounts, add, change, destroy string) string {
+	var parts []string
+	for _, c := range []struct {
+		n    int
+		verb string
+	}{{counts.Add, add}, {counts.Change, change}, {counts.Destroy, destroy}} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", c.verb, plural(c.n, "resource")))
+		}
+	}
+	if len(parts) > 1 {
+		return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+	}
+	return strings.Join(parts, "")
+}
+
+// multiSummary summarizes a multi-region or fan-out response by how many of
+// its parts succeeded.
+func multiSummary(parts map[string]*TerraformResponse, noun string) string {
+	var failed []string
+	for name, part := range parts {
+		if part == nil || !part.Success || part.Error != "" {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) == 0 {
+		if len(parts) == 1 {
+			return fmt.Sprintf("✅ Succeeded in 1 %s.", noun)
+		}
+		return fmt.Sprintf("✅ Succeeded in all %s.", plural(len(parts), noun))
+	}
+	sort.Strings(failed)
+	return fmt.Sprintf("❌ Failed in %d of %s: %s.", len(failed), plural(len(parts), noun), strings.Join(failed, ", "))
+}
+
+func placementRegions(placements map[string]ResourcePlacement) []string {
+	seen := make(map[string]bool)
+	var regions []string
+	for _, placement := range placements {
+		if placement.Region != "" && !seen[placement.Region] {
+			seen[placement.Region] = true
+			regions = append(regions, placement.Region)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
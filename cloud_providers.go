@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// cloudProviderPrompt is the provider-specific part of the generation
+// prompts: an example and the idioms the model should follow.
+type cloudProviderPrompt struct {
+	ExampleTask string
+	ExampleCode string
+	Guidance    []string // Resource types and naming conventions
+
+	// AuthSuggestions replace the generic next steps for authentication
+	// failures with the provider's own credentials.
+	AuthSuggestions []string
+}
+
+// cloudProviders are the values accepted in TerraformRequest.Provider.
+var cloudProviders = map[string]cloudProviderPrompt{
+	"digitalocean": {
+		ExampleTask: "Create a droplet in Frankfurt region with 1GB RAM",
+		ExampleCode: `resource "digitalocean_droplet" "web" {
+	name   = "web-1"
+	region = "fra1"
+	size   = "s-1vcpu-1gb"
+	image  = "ubuntu-20-04-x64"
+	}
+
+	output "droplet_ip" {
+	value = digitalocean_droplet.web.ipv4_address
+	}`,
+		Guidance: []string{
+			"Use only digitalocean_* resources",
+			"Use DigitalOcean region slugs such as fra1 or nyc3 and size slugs such as s-1vcpu-1gb",
+			"Name resources in lowercase with hyphens, e.g. web-1",
+		},
+		AuthSuggestions: []string{
+			"Check that the DigitalOcean token configured on the executor is set and valid",
+			"Make sure the token has write scope if the action creates or changes resources",
+		},
+	},
+	"aws": {
+		ExampleTask: "Create a small web server in Frankfurt",
+		ExampleCode: `resource "aws_instance" "web" {
+	ami           = "ami-0faab6bdbac9486fb"
+	instance_type = "t3.micro"
+
+	tags = {
+		Name = "web-1"
+	}
+	}
+
+	output "instance_ip" {
+	value = aws_instance.web.public_ip
+	}`,
+		Guidance: []string{
+			"Use only aws_* resources",
+			"The region is set by the provider configuration; do not set it on resources",
+			"Name resources with a Name tag in lowercase with hyphens, e.g. web-1",
+		},
+		AuthSuggestions: []string{
+			"Check that the AWS credentials configured on the executor are set, valid and not expired",
+			"Make sure the IAM policy of those credentials allows the actions on the resources in the code",
+		},
+	},
+	"gcp": {
+		ExampleTask: "Create a small web server in Frankfurt",
+		ExampleCode: `resource "google_compute_instance" "web" {
+	name         = "web-1"
+	zone         = "europe-west3-a"
+	machine_type = "e2-micro"
+
+	boot_disk {
+		initialize_params {
+		image = "debian-cloud/debian-12"
+		}
+	}
+
+	network_interface {
+		network = "default"
+		access_config {}
+	}
+	}
+
+	output "instance_ip" {
+	value = google_compute_instance.web.network_interface[0].access_config[0].nat_ip
+	}`,
+		Guidance: []string{
+			"Use only google_* resources",
+			"Use GCP zones such as europe-west3-a and machine types such as e2-micro",
+			"Name resources in lowercase with hyphens, e.g. web-1; GCP rejects uppercase and underscores",
+		},
+		AuthSuggestions: []string{
+			"Check that the GCP service account credentials configured on the executor are set and valid",
+			"Make sure the service account has roles that allow changing the resources in the code, in the right project",
+		},
+	},
+}
+
+// knownCloudProviders returns the accepted providers, sorted.
+func knownCloudProviders() []string {
+	providers := make([]string, 0, len(cloudProviders))
+	for provider := range cloudProviders {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// validateCloudProvider checks a request's provider; "" selects the generic
+// prompts.
+func validateCloudProvider(provider string) error {
+	if _, ok := cloudProviders[provider]; provider != "" && !ok {
+		return fmt.Errorf("unknown provider %q, valid providers are: %s", provider, strings.Join(knownCloudProviders(), ", "))
+	}
+	return nil
+}
+
+// providerGuidance returns the provider's conventions as prompt lines, or ""
+// for the generic prompts.
+func providerGuidance(provider string) string {
+	p, ok := cloudProviders[provider]
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\tProvider conventions (%s):\n", provider)
+	for _, line := range p.Guidance {
+		fmt.Fprintf(&b, "\t- %s\n", line)
+	}
+	return b.String()
+}
+
+// providerExample returns the provider's example task and output for the
+// initial prompt, or a provider-neutral instruction for the generic prompt.
+func providerExample(provider string) string {
+	p, ok := cloudProviders[provider]
+	if !ok {
+		return "Use the cloud provider named in the task, following its own resource types and naming conventions."
+	}
+	return fmt.Sprintf("Example task: %q\n\tExample output:\n\t%s", p.ExampleTask, p.ExampleCode)
+}
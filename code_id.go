@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const codeNamespace = "code"
+
+// codeID returns the content address of code: the SHA-256 of its canonical
+// form, so code that differs only in formatting or block order shares an ID.
+// Code that does not parse is hashed as is.
+func codeID(code string) string {
+	canonical, err := canonicalHCL(code)
+	if err != nil {
+		canonical = strings.TrimSpace(code)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// storeCode saves code under its content ID and returns the ID.
+func (s *Service) storeCode(ctx context.Context, code string) (string, error) {
+	id := codeID(code)
+	ttl := time.Duration(s.config().CodeTTLSeconds) * time.Second
+	if err := s.store.Put(ctx, codeNamespace, id, []byte(code), ttl); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// loadCode returns the code stored under id, after checking that it still
+// hashes to id.
+func (s *Service) loadCode(ctx context.Context, id string) (string, error) {
+	value, err := s.store.Get(ctx, codeNamespace, id)
+	if err != nil {
+		return "", err
+	}
+	code := string(value)
+	if codeID(code) != id {
+		return "", fmt.Errorf("stored code does not match its ID %s", id)
+	}
+	return code, nil
+}
+
+func (s *Service) handleCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	code, err := s.loadCode(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, APIErrorNotFound, "Code not found", "")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to load code", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":   id,
+		"code": code,
+	})
+}
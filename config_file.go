@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultConfigPath is the config file read when -config isn't given.
+const defaultConfigPath = "config.yaml"
+
+// readConfigFile parses the config file into config: JSON for a .json file,
+// YAML otherwise. A missing default config file leaves config empty, for
+// setups configured only with environment variables; any other missing file
+// is an error.
+func readConfigFile(filename string, config *Config) error {
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) && filename == defaultConfigPath {
+		slog.Info("config file not found, using environment variables and defaults", "path", filename)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		// Config only has yaml keys, and JSON is YAML once re-encoded
+		var doc any
+		if err := json.Unmarshal(buf, &doc); err != nil {
+			return fmt.Errorf("error parsing config file: %v", err)
+		}
+		if buf, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("error parsing config file: %v", err)
+		}
+	}
+	if err := yaml.Unmarshal(buf, config); err != nil {
+		return fmt.Errorf("error parsing config file: %v", err)
+	}
+	return nil
+}
+
+// applyEnvOverrides sets the settings given in environment variables, which
+// take precedence over the config file.
+func applyEnvOverrides(config *Config) error {
+	if env := os.Getenv("ANTHROPIC_API_KEY"); env != "" {
+		config.AnthropicAPIKey = env
+	}
+	if env := os.Getenv("GRPC_SERVER_ADDR"); env != "" {
+		config.GRPCServerAddr = env
+	}
+	if env := os.Getenv("GRPC_INSECURE"); env != "" {
+		insecure, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("GRPC_INSECURE must be true or false, got %q", env)
+		}
+		config.GRPCInsecure = insecure
+	}
+	if env := os.Getenv("DEFAULT_MODEL"); env != "" {
+		config.DefaultModel = env
+	}
+	if env := os.Getenv("RETRY_BACKOFF"); env != "" {
+		config.Retry.Backoff = env
+	}
+
+	ints := []struct {
+		name string
+		set  func(int)
+	}{
+		{"SERVER_PORT", func(n int) { config.Server.Port = n }},
+		{"RETRY_MAX_ATTEMPTS", func(n int) { config.Retry.MaxAttempts = &n }},
+		{"RETRY_DELAY_SECONDS", func(n int) { config.Retry.DelaySeconds = &n }},
+		{"RETRY_MAX_DELAY_SECONDS", func(n int) { config.Retry.MaxDelaySeconds = n }},
+	}
+	for _, v := range ints {
+		env := os.Getenv(v.name)
+		if env == "" {
+			continue
+		}
+		n, err := strconv.Atoi(env)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", v.name, env)
+		}
+		v.set(n)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigFileMissing(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := readConfigFile(defaultConfigPath, &Config{}); err != nil {
+		t.Errorf("missing default config file: error = %v, want nil", err)
+	}
+	if err := readConfigFile("typo.yaml", &Config{}); err == nil {
+		t.Error("missing config file given with -config: error = nil, want one")
+	}
+}
+
+func TestGRPCInsecureEnvOverride(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    bool
+		wantErr bool
+	}{
+		{"true", true, false},
+		{"0", false, false},
+		{"maybe", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte("grpc_insecure: true\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("GRPC_INSECURE", tt.env)
+			config, err := LoadConfig(path)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "GRPC_INSECURE") {
+					t.Fatalf("LoadConfig() error = %v, want one naming GRPC_INSECURE", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.GRPCInsecure != tt.want {
+				t.Errorf("GRPCInsecure = %v, want %v", config.GRPCInsecure, tt.want)
+			}
+		})
+	}
+}
+
+func TestOTELEndpoint(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		wantEnabled  bool
+		wantEndpoint string
+	}{
+		{"unset", "", false, ""},
+		{"otel_endpoint", "otel_endpoint: collector:4318\n", true, "collector:4318"},
+		{"telemetry.traces wins", "otel_endpoint: collector:4318\ntelemetry:\n  traces:\n    enabled: true\n    endpoint: other:4318\n", true, "other:4318"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte("anthropic_api_key: key\n"+tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if traces := config.Telemetry.Traces; traces.Enabled != tt.wantEnabled || traces.Endpoint != tt.wantEndpoint {
+				t.Errorf("traces enabled = %v, endpoint = %q, want %v, %q", traces.Enabled, traces.Endpoint, tt.wantEnabled, tt.wantEndpoint)
+			}
+		})
+	}
+}
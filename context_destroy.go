@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "request-processor/api/proto"
+)
+
+// handleContextDestroy destroys every workspace of a context, continuing past
+// failures. The response has each workspace's result in workspaces and
+// fails if any destroy failed.
+func (s *Service) handleContextDestroy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	var body struct {
+		Confirm bool `json:"confirm"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidBody, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	ctx := r.Context()
+	contextName := r.PathValue("name")
+	listed, err := s.executorClient.ListWorkspaces(ctx, &pb.ListWorkspacesRequest{Context: contextName})
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+	if !listed.Success {
+		writeError(w, http.StatusNotFound, APIErrorNotFound, fmt.Sprintf("failed to list workspaces of context %s", contextName), listed.Error)
+		return
+	}
+
+	req := TerraformRequest{
+		Context:    contextName,
+		Action:     ActionDestroy,
+		Workspaces: listed.Workspaces,
+		Confirm:    body.Confirm,
+		features:   s.resolveFeatures(ctx, contextName),
+	}
+	if req.features.DestroyConfirmation && !req.Confirm {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, fmt.Sprintf("destroy in context %s requires confirm", contextName), "")
+		return
+	}
+	wait, release, err := s.reserveDestructiveOp(ctx, req)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeError(w, http.StatusTooManyRequests, APIErrorCooldown, fmt.Sprintf("destructive operations in context %s are limited by a cooldown, retry in %ds", contextName, seconds), "")
+		return
+	}
+
+	results := s.forEachWorkspace(req.Workspaces, func(workspace string) *TerraformResponse {
+		workspaceReq := req
+		workspaceReq.Workspaces = nil
+		workspaceReq.Workspace = workspace
+		resp, err := s.processTerraformRequest(ctx, workspaceReq)
+		if err != nil {
+			resp = &TerraformResponse{Error: err.Error()}
+		}
+		return resp
+	})
+
+	response := &TerraformResponse{Success: true, Workspaces: results}
+	release(ctx, response, nil)
+	var summary, failed []string
+	for _, workspace := range req.Workspaces {
+		status := "destroyed"
+		if result := results[workspace]; !result.Success || result.Error != "" {
+			status = "failed"
+			failed = append(failed, workspace)
+		}
+		summary = append(summary, fmt.Sprintf("%s: %s", workspace, status))
+	}
+	if len(failed) > 0 {
+		response.Success = false
+		response.Error = fmt.Sprintf("destroy failed in %d of %d workspaces: %s", len(failed), len(req.Workspaces), strings.Join(failed, ", "))
+	}
+	response.Output = strings.Join(summary, "\n")
+	s.metrics.observeRequest(ActionDestroy, metricStatus(response, nil))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const cooldownNamespace = "destructive_ops"
+
+func isDestructive(req TerraformRequest) bool {
+	if req.DryRun {
+		return false
+	}
+	return req.Action == "apply" || req.Action == "destroy" || req.AutoApply
+}
+
+// requestWorkspaces returns every workspace a request operates on.
+func requestWorkspaces(req TerraformRequest) []string {
+	switch {
+	case len(req.Regions) > 0:
+		workspaces := make([]string, len(req.Regions))
+		for i, region := range req.Regions {
+			workspaces[i] = regionalWorkspace(req.Workspace, region)
+		}
+		return workspaces
+	case len(req.Workspaces) > 0:
+		return req.Workspaces
+	default:
+		return []string{req.Workspace}
+	}
+}
+
+// workspaceResults returns the result of each workspace of a request from
+// its response.
+func workspaceResults(req TerraformRequest, response *TerraformResponse) map[string]*TerraformResponse {
+	switch {
+	case response == nil:
+		return nil
+	case len(req.Regions) > 0:
+		results := make(map[string]*TerraformResponse, len(req.Regions))
+		for _, region := range req.Regions {
+			results[regionalWorkspace(req.Workspace, region)] = response.Regions[region]
+		}
+		return results
+	case len(req.Workspaces) > 0:
+		return response.Workspaces
+	default:
+		return map[string]*TerraformResponse{req.Workspace: response}
+	}
+}
+
+// destructiveOpSucceeded reports whether a destructive operation of req
+// went through in a workspace, given the workspace's result. A plan with
+// auto_apply only counts once it was applied.
+func destructiveOpSucceeded(req TerraformRequest, result *TerraformResponse) bool {
+	if responseFailed(result) {
+		return false
+	}
+	if req.AutoApply && req.Action == ActionPlan {
+		return result.AutoApply != nil && result.AutoApply.Applied
+	}
+	return true
+}
+
+// reserveDestructiveOp enforces the context's destructive operation cooldown.
+// If a workspace of the request had a destructive operation within the
+// window, it returns how long the caller must wait. Otherwise it records the
+// operation for all of them and returns 0 and release. The caller must call
+// release with the outcome of the operation, or a nil response if it didn't
+// run: it releases the workspaces where the operation did not succeed, so
+// their retries aren't held back.
+func (s *Service) reserveDestructiveOp(ctx context.Context, req TerraformRequest) (wait time.Duration, release func(context.Context, *TerraformResponse, error), err error) {
+	release = func(context.Context, *TerraformResponse, error) {}
+	window := time.Duration(req.features.DestructiveCooldownSeconds) * time.Second
+	if window <= 0 || !isDestructive(req) {
+		return 0, release, nil
+	}
+
+	s.cooldownMu.Lock()
+	defer s.cooldownMu.Unlock()
+
+	now := time.Now()
+	workspaces := requestWorkspaces(req)
+	for _, workspace := range workspaces {
+		value, err := s.store.Get(ctx, cooldownNamespace, req.Context+"/"+workspace)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to load last destructive operation: %v", err)
+		}
+		last, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		if remaining := time.Unix(0, last).Add(window).Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	if wait > 0 {
+		return wait, release, nil
+	}
+
+	value := strconv.FormatInt(now.UnixNano(), 10)
+	for _, workspace := range workspaces {
+		if err := s.store.Put(ctx, cooldownNamespace, req.Context+"/"+workspace, []byte(value), window); err != nil {
+			return 0, nil, fmt.Errorf("failed to record destructive operation: %v", err)
+		}
+	}
+	release = func(ctx context.Context, response *TerraformResponse, err error) {
+		results := workspaceResults(req, response)
+		for _, workspace := range workspaces {
+			if err == nil && destructiveOpSucceeded(req, results[workspace]) {
+				continue
+			}
+			if err := s.releaseDestructiveOp(ctx, req.Context, workspace, value); err != nil {
+				s.runLogger(ctx).Warn("failed to release destructive operation cooldown", "context", req.Context, "workspace", workspace, "error", err)
+			}
+		}
+	}
+	return 0, release, nil
+}
+
+// releaseDestructiveOp removes the record of a destructive operation, unless
+// a later operation replaced it.
+func (s *Service) releaseDestructiveOp(ctx context.Context, contextName, workspace, value string) error {
+	s.cooldownMu.Lock()
+	defer s.cooldownMu.Unlock()
+
+	key := contextName + "/" + workspace
+	current, err := s.store.Get(ctx, cooldownNamespace, key)
+	if errors.Is(err, ErrNotFound) || err == nil && string(current) != value {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, cooldownNamespace, key)
+}
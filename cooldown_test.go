@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestWorkspaces(t *testing.T) {
+	tests := []struct {
+		name string
+		req  TerraformRequest
+		want []string
+	}{
+		{"single", TerraformRequest{Workspace: "ws"}, []string{"ws"}},
+		{"regions", TerraformRequest{Workspace: "ws", Regions: []string{"fra1", "nyc3"}}, []string{"ws-fra1", "ws-nyc3"}},
+		{"regions without workspace", TerraformRequest{Regions: []string{"fra1"}}, []string{"fra1"}},
+		{"fan-out", TerraformRequest{Workspaces: []string{"a", "b"}}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestWorkspaces(tt.req); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestWorkspaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// outcome returns the response of req when it failed in the failed
+// workspaces and succeeded in the others.
+func outcome(req TerraformRequest, failed []string) *TerraformResponse {
+	result := func(workspace string) *TerraformResponse {
+		return &TerraformResponse{Success: !slices.Contains(failed, workspace)}
+	}
+	if len(req.Workspaces) == 0 {
+		return result(req.Workspace)
+	}
+	response := &TerraformResponse{Success: len(failed) == 0, Workspaces: make(map[string]*TerraformResponse)}
+	for _, workspace := range req.Workspaces {
+		response.Workspaces[workspace] = result(workspace)
+	}
+	return response
+}
+
+func TestReserveDestructiveOp(t *testing.T) {
+	destructive := func(workspace string, workspaces ...string) TerraformRequest {
+		req := TerraformRequest{Context: "ctx", Workspace: workspace, Workspaces: workspaces, Action: ActionApply}
+		req.features.DestructiveCooldownSeconds = 60
+		return req
+	}
+	withoutCooldown := destructive("ws")
+	withoutCooldown.features.DestructiveCooldownSeconds = 0
+	plan := destructive("ws")
+	plan.Action = ActionPlan
+	dryRun := destructive("ws")
+	dryRun.DryRun = true
+
+	tests := []struct {
+		name     string
+		first    TerraformRequest
+		failed   []string // Workspaces where the first request failed
+		second   TerraformRequest
+		wantWait bool // Whether the second request must wait
+	}{
+		{"same workspace", destructive("ws"), nil, destructive("ws"), true},
+		{"other workspace", destructive("ws"), nil, destructive("other"), false},
+		{"fan-out overlapping", destructive("ws"), nil, destructive("", "other", "ws"), true},
+		{"after a fan-out", destructive("", "a", "b"), nil, destructive("b"), true},
+		{"after a failure", destructive("ws"), []string{"ws"}, destructive("ws"), false},
+		{"after a fan-out that failed elsewhere", destructive("", "a", "b"), []string{"b"}, destructive("a"), true},
+		{"after a fan-out that failed there", destructive("", "a", "b"), []string{"b"}, destructive("b"), false},
+		{"cooldown disabled", withoutCooldown, nil, withoutCooldown, false},
+		{"plans are not destructive", plan, nil, plan, false},
+		{"dry runs are not destructive", dryRun, nil, dryRun, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(nil)
+			ctx := context.Background()
+			wait, release, err := s.reserveDestructiveOp(ctx, tt.first)
+			if err != nil || wait != 0 {
+				t.Fatalf("first reservation: wait = %v, err = %v, want neither", wait, err)
+			}
+			release(ctx, outcome(tt.first, tt.failed), nil)
+
+			wait, _, err = s.reserveDestructiveOp(ctx, tt.second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (wait > 0) != tt.wantWait {
+				t.Errorf("wait = %v, want waiting %v", wait, tt.wantWait)
+			}
+			if wait > time.Minute {
+				t.Errorf("wait = %v, longer than the cooldown", wait)
+			}
+		})
+	}
+}
+
+func TestCooldownResponse(t *testing.T) {
+	cooldown := 60
+	config := &Config{}
+	config.Features.DestructiveCooldownSeconds = &cooldown
+	s := newTestService(config)
+	s.executorClient = newFakeExecutor()
+	s.generator = &fakeGenerator{replies: []string{testCode}}
+
+	const body = `{"action":"apply","context":"ctx","workspace":"ws","description":"a droplet"}`
+	w := httptest.NewRecorder()
+	s.handleTerraformRequest(w, httptest.NewRequest(http.MethodPost, "/terraform", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("first apply: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleTerraformRequest(w, httptest.NewRequest(http.MethodPost, "/terraform", strings.NewReader(body)))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second apply: status = %d, want %d: %s", w.Code, http.StatusTooManyRequests, w.Body)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if !strings.Contains(w.Body.String(), APIErrorCooldown) {
+		t.Errorf("body = %s, want the %s error code", w.Body, APIErrorCooldown)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// CostEstimate is the estimated monthly cost of a plan.
+type CostEstimate struct {
+	Currency         string         `json:"currency"`
+	MonthlyCost      float64        `json:"monthly_cost"`                // Once the plan is applied
+	PastMonthlyCost  float64        `json:"past_monthly_cost"`           // Before the plan
+	DiffMonthlyCost  float64        `json:"diff_monthly_cost"`           // Change made by the plan
+	Resources        []ResourceCost `json:"resources,omitempty"`         // Resources with a known cost
+	UnsupportedCount int            `json:"unsupported_count,omitempty"` // Resources the estimator has no prices for
+}
+
+type ResourceCost struct {
+	Address     string  `json:"address"`
+	MonthlyCost float64 `json:"monthly_cost"`
+}
+
+// CostEstimator prices a plan, given as `terraform show -json` output.
+// Implement it to use a pricing source of your own.
+type CostEstimator interface {
+	Estimate(ctx context.Context, planJSON string) (*CostEstimate, error)
+}
+
+type CostEstimationConfig struct {
+	Estimator      string `yaml:"estimator"`       // "infracost", or empty to disable estimation
+	Path           string `yaml:"path"`            // Binary to run; defaults to the estimator's name on PATH
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // Default 60
+}
+
+func newCostEstimator(config CostEstimationConfig) (CostEstimator, error) {
+	switch config.Estimator {
+	case "":
+		return nil, nil
+	case "infracost":
+		path := config.Path
+		if path == "" {
+			path = "infracost"
+		}
+		return &infracostEstimator{path: path, timeout: time.Duration(config.TimeoutSeconds) * time.Second}, nil
+	default:
+		return nil, fmt.Errorf("unknown cost_estimation.estimator %q", config.Estimator)
+	}
+}
+
+// infracostEstimator runs the Infracost CLI on this host. It reads its API
+// key from INFRACOST_API_KEY in the service's environment.
+type infracostEstimator struct {
+	path    string
+	timeout time.Duration
+}
+
+// infracostCost is a decimal string, or null when a cost is unknown.
+type infracostCost string
+
+func (c *infracostCost) float() float64 {
+	if c == nil {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(string(*c), 64)
+	return f
+}
+
+func (e *infracostEstimator) Estimate(ctx context.Context, planJSON string) (*CostEstimate, error) {
+	dir, err := os.MkdirTemp("", "cost-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cost estimation directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	planPath := filepath.Join(dir, "plan.json")
+	if err := os.WriteFile(planPath, []byte(planJSON), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write plan for cost estimation: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, e.path, "breakdown", "--path", planPath, "--format", "json", "--no-color").Output()
+	if err != nil {
+		return nil, fmt.Errorf("infracost failed: %v", err)
+	}
+
+	var result struct {
+		Currency             string         `json:"currency"`
+		TotalMonthlyCost     *infracostCost `json:"totalMonthlyCost"`
+		PastTotalMonthlyCost *infracostCost `json:"pastTotalMonthlyCost"`
+		DiffTotalMonthlyCost *infracostCost `json:"diffTotalMonthlyCost"`
+		Projects             []struct {
+			Breakdown struct {
+				Resources []struct {
+					Name        string         `json:"name"`
+					MonthlyCost *infracostCost `json:"monthlyCost"`
+				} `json:"resources"`
+			} `json:"breakdown"`
+		} `json:"projects"`
+		Summary struct {
+			TotalUnsupportedResources int `json:"totalUnsupportedResources"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse infracost output: %v", err)
+	}
+
+	estimate := &CostEstimate{
+		Currency:         result.Currency,
+		MonthlyCost:      result.TotalMonthlyCost.float(),
+		PastMonthlyCost:  result.PastTotalMonthlyCost.float(),
+		DiffMonthlyCost:  result.DiffTotalMonthlyCost.float(),
+		UnsupportedCount: result.Summary.TotalUnsupportedResources,
+	}
+	for _, project := range result.Projects {
+		for _, resource := range project.Breakdown.Resources {
+			if resource.MonthlyCost == nil {
+				continue
+			}
+			estimate.Resources = append(estimate.Resources, ResourceCost{
+				Address:     resource.Name,
+				MonthlyCost: resource.MonthlyCost.float(),
+			})
+		}
+	}
+	return estimate, nil
+}
+
+// setCostEstimate sets response.CostEstimate from the plan of a successful
+// plan, when an estimator is configured and the request's context has cost
+// estimation on. Estimation failures are warnings.
+func (s *Service) setCostEstimate(ctx context.Context, req TerraformRequest, response *TerraformResponse) {
+	if s.costEstimator == nil || !req.features.CostEstimation || response.planJSON == "" || !response.Success || response.Error != "" {
+		return
+	}
+	estimate, err := s.costEstimator.Estimate(ctx, response.planJSON)
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to estimate cost", "error", err)
+		response.Warnings = append(response.Warnings, fmt.Sprintf("cost estimation: %v", err))
+		return
+	}
+	response.CostEstimate = estimate
+}
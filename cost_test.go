@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeEstimator prices every plan the same, or fails with err.
+type fakeEstimator struct {
+	err   error
+	calls int
+}
+
+func (e *fakeEstimator) Estimate(ctx context.Context, planJSON string) (*CostEstimate, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &CostEstimate{Currency: "USD", MonthlyCost: 12, DiffMonthlyCost: 12}, nil
+}
+
+func TestSetCostEstimate(t *testing.T) {
+	tests := []struct {
+		name         string
+		estimator    *fakeEstimator
+		flag         bool
+		response     TerraformResponse
+		wantEstimate bool
+		wantWarning  bool
+	}{
+		{"estimated", &fakeEstimator{}, true, TerraformResponse{Success: true, planJSON: "{}"}, true, false},
+		{"flag off for the context", &fakeEstimator{}, false, TerraformResponse{Success: true, planJSON: "{}"}, false, false},
+		{"no estimator", nil, true, TerraformResponse{Success: true, planJSON: "{}"}, false, false},
+		{"failed plan", &fakeEstimator{}, true, TerraformResponse{Success: false, Error: "Error: invalid", planJSON: "{}"}, false, false},
+		{"no plan", &fakeEstimator{}, true, TerraformResponse{Success: true}, false, false},
+		{"estimator failed", &fakeEstimator{err: errors.New("infracost: no API key")}, true, TerraformResponse{Success: true, planJSON: "{}"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(nil)
+			if tt.estimator != nil {
+				s.costEstimator = tt.estimator
+			}
+			req := TerraformRequest{features: defaultFeatureFlags}
+			req.features.CostEstimation = tt.flag
+
+			response := tt.response
+			s.setCostEstimate(context.Background(), req, &response)
+			if (response.CostEstimate != nil) != tt.wantEstimate {
+				t.Errorf("estimate = %+v, want one: %v", response.CostEstimate, tt.wantEstimate)
+			}
+			if (len(response.Warnings) > 0) != tt.wantWarning {
+				t.Errorf("warnings = %q, want one: %v", response.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestCostEstimationOverride(t *testing.T) {
+	off := false
+	if !defaultFeatureFlags.CostEstimation {
+		t.Fatal("cost estimation is off by default")
+	}
+	if flags := (FeatureOverrides{CostEstimation: &off}).apply(defaultFeatureFlags); flags.CostEstimation {
+		t.Error("cost_estimation override was not applied")
+	}
+}
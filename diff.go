@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// unifiedDiff returns a unified diff between two versions of terraform code.
+func unifiedDiff(oldCode, newCode, oldName, newName string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(oldCode),
+		B:        difflib.SplitLines(newCode),
+		FromFile: oldName,
+		ToFile:   newName,
+		Context:  3,
+	})
+	return diff
+}
+
+// codeDiff returns the unified diff from a workspace's previous code to the
+// code of a request, or "" if the workspace had no code.
+func codeDiff(previousCode, code string) string {
+	if strings.TrimSpace(previousCode) == "" || code == "" {
+		return ""
+	}
+	return unifiedDiff(previousCode, code, "a/main.tf", "b/main.tf")
+}
+
+type ResourceChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// diffResources compares the resource blocks of two versions of code by
+// address. It returns nil if either version can't be parsed.
+func diffResources(oldCode, newCode string) *ResourceChanges {
+	oldBlocks, err := resourceBlocks(oldCode)
+	if err != nil {
+		return nil
+	}
+	newBlocks, err := resourceBlocks(newCode)
+	if err != nil {
+		return nil
+	}
+
+	changes := &ResourceChanges{}
+	for address, source := range newBlocks {
+		oldSource, ok := oldBlocks[address]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, address)
+		case strings.TrimSpace(oldSource) != strings.TrimSpace(source):
+			changes.Changed = append(changes.Changed, address)
+		}
+	}
+	for address := range oldBlocks {
+		if _, ok := newBlocks[address]; !ok {
+			changes.Removed = append(changes.Removed, address)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes
+}
+
+// unintendedChanges returns the resources that newCode changes or removes
+// from oldCode although the description mentions neither their address, their
+// label nor their name attribute. Modification prompts ask the model to keep
+// other resources unchanged; this catches when it doesn't. Blocks are compared
+// in canonical form, so reordering and reformatting don't count as changes.
+func unintendedChanges(description, oldCode, newCode string) []string {
+	changes := diffResources(oldCode, newCode)
+	if changes == nil {
+		return nil
+	}
+	oldBlocks, _ := resourceBlocks(oldCode)
+	newBlocks, _ := resourceBlocks(newCode)
+	names := make(map[string]string)
+	if body, err := parseHCL(oldCode); err == nil {
+		for _, name := range resourceNames(body) {
+			names[name.Address] = name.Name
+		}
+	}
+
+	description = strings.ToLower(description)
+	var unintended []string
+	for _, address := range append(changes.Changed, changes.Removed...) {
+		if newSource, ok := newBlocks[address]; ok && sameBlock(oldBlocks[address], newSource) {
+			continue
+		}
+		if !mentionsResource(description, address, names[address]) {
+			unintended = append(unintended, address)
+		}
+	}
+	sort.Strings(unintended)
+	return unintended
+}
+
+func sameBlock(a, b string) bool {
+	canonicalA, errA := canonicalHCL(a)
+	canonicalB, errB := canonicalHCL(b)
+	return errA == nil && errB == nil && canonicalA == canonicalB
+}
+
+// mentionsResource reports whether a lowercased description refers to a
+// resource by address, label or name attribute. Underscores in labels may be
+// written as spaces or hyphens.
+func mentionsResource(description, address, name string) bool {
+	_, label, _ := strings.Cut(address, ".")
+	terms := []string{address, label, strings.ReplaceAll(label, "_", " "), strings.ReplaceAll(label, "_", "-"), name}
+	for _, term := range terms {
+		if term != "" && containsWord(description, strings.ToLower(term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord reports whether term occurs in text delimited by non-word
+// characters.
+func containsWord(text, term string) bool {
+	for i := 0; ; {
+		j := strings.Index(text[i:], term)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(term)
+		if (start == 0 || !isWordByte(text[start-1])) && (end == len(text) || !isWordByte(text[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DriftedResource is a resource that changed outside terraform, from a
+// refresh-only plan.
+type DriftedResource struct {
+	Address    string   `json:"address"`
+	Type       string   `json:"type"`
+	Deleted    bool     `json:"deleted,omitempty"`    // The resource no longer exists
+	Attributes []string `json:"attributes,omitempty"` // Top-level attributes whose values changed
+}
+
+// driftedResources returns the resource_drift entries of a refresh-only plan.
+func driftedResources(planOutput string) ([]DriftedResource, error) {
+	var plan struct {
+		ResourceDrift []struct {
+			Address string `json:"address"`
+			Type    string `json:"type"`
+			Change  struct {
+				Before map[string]any `json:"before"`
+				After  map[string]any `json:"after"`
+			} `json:"change"`
+		} `json:"resource_drift"`
+	}
+	if err := json.Unmarshal([]byte(planOutput), &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %v", err)
+	}
+
+	drift := []DriftedResource{}
+	for _, rd := range plan.ResourceDrift {
+		resource := DriftedResource{Address: rd.Address, Type: rd.Type}
+		if rd.Change.After == nil {
+			resource.Deleted = true
+			drift = append(drift, resource)
+			continue
+		}
+		for name, before := range rd.Change.Before {
+			if after, ok := rd.Change.After[name]; !ok || !reflect.DeepEqual(before, after) {
+				resource.Attributes = append(resource.Attributes, name)
+			}
+		}
+		for name := range rd.Change.After {
+			if _, ok := rd.Change.Before[name]; !ok {
+				resource.Attributes = append(resource.Attributes, name)
+			}
+		}
+		sort.Strings(resource.Attributes)
+		drift = append(drift, resource)
+	}
+	return drift, nil
+}
+
+// setDrift fills response.Drift for a refresh request.
+func setDrift(response *TerraformResponse) {
+	if response.planJSON == "" {
+		response.Warnings = append(response.Warnings, "refresh: executor did not return plan JSON, drifted resources are only in the output")
+		return
+	}
+	drift, err := driftedResources(response.planJSON)
+	if err != nil {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("refresh: %v", err))
+		return
+	}
+	response.Drift = drift
+}
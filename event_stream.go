@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	pb "request-processor/api/proto"
+)
+
+// Server-Sent Events sent to clients that request text/event-stream.
+const (
+	EventLog    = "log"    // A section of the request's log
+	EventOutput = "output" // A chunk of terraform apply output
+	EventResult = "result" // The TerraformResponse, last
+	EventError  = "error"  // An ErrorResponse, last, when the request failed
+)
+
+// eventStream writes Server-Sent Events to a client. Requests fanned out
+// across workspaces share one stream, so writes are serialized.
+type eventStream struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+}
+
+type eventStreamKey struct{}
+
+// wantsEventStream reports whether the client asked for Server-Sent Events.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// startEventStream writes the event stream headers and returns a context
+// carrying the stream. It fails if w cannot be flushed incrementally.
+func startEventStream(ctx context.Context, w http.ResponseWriter) (context.Context, *eventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, nil, fmt.Errorf("streaming is not supported by this connection")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	stream := &eventStream{w: w, flusher: flusher}
+	return context.WithValue(ctx, eventStreamKey{}, stream), stream, nil
+}
+
+func eventStreamFrom(ctx context.Context) *eventStream {
+	stream, _ := ctx.Value(eventStreamKey{}).(*eventStream)
+	return stream
+}
+
+// send writes one event. Each line of data becomes a data field, so
+// multi-line output arrives intact.
+func (e *eventStream) send(event, data string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	io.WriteString(e.w, b.String())
+	e.flusher.Flush()
+}
+
+// sendJSON writes one event with v encoded as JSON.
+func (e *eventStream) sendJSON(event string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(ErrorResponse{Code: APIErrorInternal, Message: fmt.Sprintf("failed to encode event: %v", err)})
+		event = EventError
+	}
+	e.send(event, string(data))
+}
+
+// streamEvent sends text, redacted, to the client of the request in ctx, if
+// it asked for a stream.
+func (s *Service) streamEvent(ctx context.Context, event, text string) {
+	if stream := eventStreamFrom(ctx); stream != nil {
+		stream.send(event, s.redact(ctx, text))
+	}
+}
+
+// streamLogWriter forwards each log record to the request's event stream.
+type streamLogWriter struct {
+	s   *Service
+	ctx context.Context
+}
+
+func (w streamLogWriter) Write(p []byte) (int, error) {
+	w.s.streamEvent(w.ctx, EventLog, string(p))
+	return len(p), nil
+}
+
+// streamApply runs terraform apply with StreamApply, forwarding its output to
+// the client as it is written, and returns the final result.
+func (s *Service) streamApply(ctx context.Context, contextName, workspace string) (*pb.ApplyResponse, error) {
+	stream, err := s.executorClient.StreamApply(ctx, &pb.ApplyRequest{
+		Context:   contextName,
+		Workspace: workspace,
+		PlanFile:  planFileFrom(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("apply stream ended without a result")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Output != "" {
+			s.streamEvent(ctx, EventOutput, chunk.Output)
+		}
+		if chunk.Result != nil {
+			return chunk.Result, nil
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	pb "request-processor/api/proto"
+)
+
+const workspaceUsageNamespace = "workspace_usage"
+
+type EvictionConfig struct {
+	Enabled         bool `yaml:"enabled"`
+	MaxWorkspaces   int  `yaml:"max_workspaces"`   // Evict the least recently used workspaces beyond this count; 0 disables
+	MaxIdleHours    int  `yaml:"max_idle_hours"`   // Evict workspaces unused for longer than this; 0 disables
+	NoticeMinutes   int  `yaml:"notice_minutes"`   // Time between the eviction notice and the eviction
+	IntervalMinutes int  `yaml:"interval_minutes"` // How often candidates are checked; default 60
+	DryRun          bool `yaml:"dry_run"`          // Only log and notify, never destroy
+}
+
+// workspaceUsage is the eviction bookkeeping kept per workspace.
+type workspaceUsage struct {
+	Context    string     `json:"context"`
+	Workspace  string     `json:"workspace"`
+	LastUsed   time.Time  `json:"last_used"`
+	Protected  bool       `json:"protected,omitempty"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+}
+
+type EvictionCandidate struct {
+	Context    string     `json:"context"`
+	Workspace  string     `json:"workspace"`
+	LastUsed   time.Time  `json:"last_used"`
+	Reason     string     `json:"reason"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	EvictAfter *time.Time `json:"evict_after,omitempty"`
+}
+
+func workspaceUsageKey(contextName, workspace string) string {
+	return contextName + "/" + workspace
+}
+
+func (s *Service) loadWorkspaceUsage(ctx context.Context, contextName, workspace string) (*workspaceUsage, error) {
+	value, err := s.store.Get(ctx, workspaceUsageNamespace, workspaceUsageKey(contextName, workspace))
+	if errors.Is(err, ErrNotFound) {
+		return &workspaceUsage{Context: contextName, Workspace: workspace}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var usage workspaceUsage
+	if err := json.Unmarshal(value, &usage); err != nil {
+		return nil, fmt.Errorf("failed to decode workspace usage: %v", err)
+	}
+	return &usage, nil
+}
+
+func (s *Service) saveWorkspaceUsage(ctx context.Context, usage *workspaceUsage) error {
+	value, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to encode workspace usage: %v", err)
+	}
+	return s.store.Put(ctx, workspaceUsageNamespace, workspaceUsageKey(usage.Context, usage.Workspace), value, 0)
+}
+
+// touchWorkspace records that a workspace was just used, which also cancels
+// a pending eviction notice.
+func (s *Service) touchWorkspace(ctx context.Context, contextName, workspace string) {
+	usage, err := s.loadWorkspaceUsage(ctx, contextName, workspace)
+	if err == nil {
+		usage.LastUsed = time.Now().UTC()
+		usage.NotifiedAt = nil
+		err = s.saveWorkspaceUsage(ctx, usage)
+	}
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to record workspace usage", "context", contextName, "workspace", workspace, "error", err)
+	}
+}
+
+// evictionCandidates returns the unprotected workspaces the eviction policy
+// selects, least recently used first.
+func (s *Service) evictionCandidates(ctx context.Context) ([]EvictionCandidate, error) {
+	items, err := s.store.List(ctx, workspaceUsageNamespace, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var usages []workspaceUsage
+	for _, item := range items {
+		var usage workspaceUsage
+		if err := json.Unmarshal(item.Value, &usage); err != nil {
+			slog.Warn("failed to decode workspace usage", "key", item.Key, "error", err)
+			continue
+		}
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].LastUsed.After(usages[j].LastUsed) })
+
+	config := s.config().Eviction
+	notice := time.Duration(config.NoticeMinutes) * time.Minute
+	now := time.Now()
+	var candidates []EvictionCandidate
+	for i, usage := range usages {
+		if usage.Protected {
+			continue
+		}
+
+		reason := ""
+		switch {
+		case config.MaxIdleHours > 0 && now.Sub(usage.LastUsed) > time.Duration(config.MaxIdleHours)*time.Hour:
+			reason = fmt.Sprintf("unused for more than %d hours", config.MaxIdleHours)
+		case config.MaxWorkspaces > 0 && i >= config.MaxWorkspaces:
+			reason = fmt.Sprintf("beyond the %d most recently used workspaces", config.MaxWorkspaces)
+		default:
+			continue
+		}
+
+		candidate := EvictionCandidate{
+			Context:    usage.Context,
+			Workspace:  usage.Workspace,
+			LastUsed:   usage.LastUsed,
+			Reason:     reason,
+			NotifiedAt: usage.NotifiedAt,
+		}
+		if usage.NotifiedAt != nil {
+			evictAfter := usage.NotifiedAt.Add(notice)
+			candidate.EvictAfter = &evictAfter
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].LastUsed.Before(candidates[j].LastUsed) })
+	return candidates, nil
+}
+
+// runEviction notifies new candidates and evicts those whose notice period
+// has passed. In dry-run mode nothing is destroyed.
+func (s *Service) runEviction(ctx context.Context) {
+	candidates, err := s.evictionCandidates(ctx)
+	if err != nil {
+		slog.Error("failed to list eviction candidates", "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, candidate := range candidates {
+		if candidate.NotifiedAt == nil {
+			s.noticeEviction(ctx, candidate, now)
+			continue
+		}
+		if now.Before(*candidate.EvictAfter) {
+			continue
+		}
+		if s.config().Eviction.DryRun {
+			slog.Info("dry run: would evict workspace", "context", candidate.Context, "workspace", candidate.Workspace, "reason", candidate.Reason)
+			continue
+		}
+		if err := s.evictWorkspace(ctx, candidate); err != nil {
+			slog.Error("failed to evict workspace", "context", candidate.Context, "workspace", candidate.Workspace, "error", err)
+		}
+	}
+}
+
+func (s *Service) noticeEviction(ctx context.Context, candidate EvictionCandidate, now time.Time) {
+	usage, err := s.loadWorkspaceUsage(ctx, candidate.Context, candidate.Workspace)
+	if err != nil {
+		slog.Warn("failed to load workspace usage", "context", candidate.Context, "workspace", candidate.Workspace, "error", err)
+		return
+	}
+	usage.NotifiedAt = &now
+	if err := s.saveWorkspaceUsage(ctx, usage); err != nil {
+		slog.Warn("failed to record eviction notice", "context", candidate.Context, "workspace", candidate.Workspace, "error", err)
+		return
+	}
+
+	evictAt := now.Add(time.Duration(s.config().Eviction.NoticeMinutes) * time.Minute)
+	slog.Warn("workspace will be evicted", "context", candidate.Context, "workspace", candidate.Workspace, "evict_after", evictAt.Format(time.RFC3339), "reason", candidate.Reason)
+	s.emitEvent(ctx, otellog.SeverityWarn, "eviction_notice", map[string]any{
+		"context":     candidate.Context,
+		"workspace":   candidate.Workspace,
+		"reason":      candidate.Reason,
+		"evict_after": evictAt.Format(time.RFC3339),
+		"dry_run":     s.config().Eviction.DryRun,
+	})
+}
+
+// evictWorkspace destroys a workspace's resources and deletes it.
+func (s *Service) evictWorkspace(ctx context.Context, candidate EvictionCandidate) error {
+	slog.Info("evicting workspace", "context", candidate.Context, "workspace", candidate.Workspace, "reason", candidate.Reason)
+	ctx = s.withInjectedSecrets(ctx, candidate.Context, candidate.Workspace)
+
+	resp, err := s.executeAction(ctx, "destroy", candidate.Context, candidate.Workspace)
+	if err != nil {
+		return fmt.Errorf("destroy failed: %v", err)
+	}
+	if !resp.Success || resp.Error != "" {
+		return fmt.Errorf("destroy failed: %s", resp.Error)
+	}
+
+	deleted, err := s.executorClient.DeleteWorkspace(ctx, &pb.DeleteWorkspaceRequest{
+		Context:   candidate.Context,
+		Workspace: candidate.Workspace,
+	})
+	s.workspaceCache.invalidate(candidate.Context, candidate.Workspace, CacheEventDeleted)
+	if err != nil {
+		return fmt.Errorf("delete workspace failed: %v", err)
+	}
+	if !deleted.Success {
+		return fmt.Errorf("delete workspace failed: %s", deleted.Error)
+	}
+
+	s.emitEvent(ctx, otellog.SeverityWarn, "eviction", map[string]any{
+		"context":   candidate.Context,
+		"workspace": candidate.Workspace,
+		"reason":    candidate.Reason,
+	})
+	return s.store.Delete(ctx, workspaceUsageNamespace, workspaceUsageKey(candidate.Context, candidate.Workspace))
+}
+
+func (s *Service) runEvictionLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config().Eviction.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runEviction(ctx)
+		}
+	}
+}
+
+func (s *Service) handleEvictionCandidates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	candidates, err := s.evictionCandidates(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to list eviction candidates", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"dry_run":    s.config().Eviction.DryRun,
+		"candidates": candidates,
+	})
+}
+
+// handleWorkspaceProtection marks a workspace as protected from eviction, or
+// clears the mark. Admin only.
+func (s *Service) handleWorkspaceProtection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if !s.isAdmin(r) {
+		writeError(w, http.StatusForbidden, APIErrorForbidden, "This endpoint requires a valid X-Admin-Token", "")
+		return
+	}
+
+	var req struct {
+		Context   string `json:"context"`
+		Workspace string `json:"workspace"`
+		Protected bool   `json:"protected"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidBody, "Invalid request body", err.Error())
+		return
+	}
+	if req.Context == "" {
+		req.Context = "default"
+	}
+
+	usage, err := s.loadWorkspaceUsage(r.Context(), req.Context, req.Workspace)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to load workspace", err.Error())
+		return
+	}
+	if usage.LastUsed.IsZero() {
+		usage.LastUsed = time.Now().UTC()
+	}
+	usage.Protected = req.Protected
+	if err := s.saveWorkspaceUsage(r.Context(), usage); err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to save workspace", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWorkspaceProtectionOutlivesFullStore(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(nil)
+	store := newMemoryStore(10)
+	s.store, s.history = store, &storeHistory{store: store}
+
+	if err := s.saveWorkspaceUsage(ctx, &workspaceUsage{Context: "dev", Workspace: "prod", Protected: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 100 {
+		store.Put(ctx, generationCacheNamespace, fmt.Sprint(i), []byte("x"), time.Hour)
+		s.recordRun(ctx, TerraformRequest{Context: "dev", Workspace: "other"}, &TerraformResponse{}, nil)
+	}
+	s.touchWorkspace(ctx, "dev", "prod")
+
+	usage, err := s.loadWorkspaceUsage(ctx, "dev", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !usage.Protected {
+		t.Error("workspace lost its protection once the store was full")
+	}
+	if entries, err := s.history.List(ctx, "dev", "other"); err != nil || len(entries) != 100 {
+		t.Errorf("history holds %d entries, %v, want all 100", len(entries), err)
+	}
+	if n := store.recent.Len(); n != 10 {
+		t.Errorf("store holds %d expiring entries, want 10", n)
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	pb "request-processor/api/proto"
+)
+
+// ringReplicas is the number of points each executor gets on the hash ring.
+const ringReplicas = 128
+
+// executorPool spreads executor RPCs over several executor connections. It
+// implements grpc.ClientConnInterface so the generated client can use it
+// directly.
+//
+// Without sticky routing every call goes round-robin to a healthy executor.
+// With sticky routing, calls that name a workspace are routed by consistent
+// hashing of context+workspace, so adding or removing an executor only moves
+// the workspaces it gains or loses. Streams are routed the same way by their
+// request. Context-level calls are sent to every executor so the context
+// exists wherever its workspaces live, and listings of contexts and
+// workspaces merge what every executor holds.
+type executorPool struct {
+	mu     sync.RWMutex
+	addrs  []string
+	conns  map[string]*grpc.ClientConn
+	ring   []ringPoint
+	sticky bool
+	opts   []grpc.DialOption
+	next   atomic.Uint64
+}
+
+type ringPoint struct {
+	hash uint32
+	addr string
+}
+
+type workspaceScoped interface {
+	GetContext() string
+	GetWorkspace() string
+}
+
+type contextScoped interface {
+	GetContext() string
+}
+
+func newExecutorPool(addrs []string, sticky bool, opts ...grpc.DialOption) (*executorPool, error) {
+	pool := &executorPool{
+		conns:  make(map[string]*grpc.ClientConn),
+		sticky: sticky,
+		opts:   opts,
+	}
+	if err := pool.update(addrs); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// update changes the pool membership, creating clients for new executors,
+// closing removed ones and rebuilding the hash ring. Clients connect lazily;
+// use waitReady to connect eagerly.
+func (p *executorPool) update(addrs []string) error {
+	if len(addrs) == 0 {
+		return errors.New("at least one executor address is required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := make(map[string]*grpc.ClientConn, len(addrs))
+	for _, addr := range addrs {
+		if conn, ok := p.conns[addr]; ok {
+			conns[addr] = conn
+			continue
+		}
+		conn, err := grpc.NewClient(addr, p.opts...)
+		if err != nil {
+			for a, c := range conns {
+				if _, existing := p.conns[a]; !existing {
+					c.Close()
+				}
+			}
+			return fmt.Errorf("failed to create client for executor %s: %v", addr, err)
+		}
+		conns[addr] = conn
+	}
+	for addr, conn := range p.conns {
+		if _, ok := conns[addr]; !ok {
+			conn.Close()
+		}
+	}
+
+	ring := make([]ringPoint, 0, len(addrs)*ringReplicas)
+	for _, addr := range addrs {
+		for i := 0; i < ringReplicas; i++ {
+			ring = append(ring, ringPoint{hash: hashKey(addr + "#" + strconv.Itoa(i)), addr: addr})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	p.addrs = append([]string(nil), addrs...)
+	p.conns = conns
+	p.ring = ring
+	return nil
+}
+
+// waitReady connects to every executor and waits until each connection is
+// ready, so an unreachable executor is reported at once rather than by the
+// first request routed to it.
+func (p *executorPool) waitReady(ctx context.Context) error {
+	p.mu.RLock()
+	addrs := append([]string(nil), p.addrs...)
+	conns := make(map[string]*grpc.ClientConn, len(p.conns))
+	for addr, conn := range p.conns {
+		conns[addr] = conn
+	}
+	p.mu.RUnlock()
+
+	for _, addr := range addrs {
+		conn := conns[addr]
+		conn.Connect()
+		for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("executor %s is not reachable (connection %s): %w", addr, state, ctx.Err())
+			}
+		}
+	}
+	return nil
+}
+
+func healthy(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.Idle:
+		conn.Connect()
+		return true
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	default:
+		return true
+	}
+}
+
+// conn returns the connection to the executor at addr, if it is in the pool.
+func (p *executorPool) conn(addr string) (*grpc.ClientConn, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	conn, ok := p.conns[addr]
+	return conn, ok
+}
+
+func (p *executorPool) roundRobin() (*grpc.ClientConn, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for range p.addrs {
+		addr := p.addrs[p.next.Add(1)%uint64(len(p.addrs))]
+		if conn := p.conns[addr]; healthy(conn) {
+			return conn, nil
+		}
+	}
+	return nil, status.Error(codes.Unavailable, "no healthy executors available")
+}
+
+// executorFor returns the address of the executor owning a workspace.
+func (p *executorPool) executorFor(contextName, workspace string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	h := hashKey(contextName + "/" + workspace)
+	i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	if i == len(p.ring) {
+		i = 0
+	}
+	return p.ring[i].addr
+}
+
+// route returns the connection for a call with request args: the executor
+// owning its workspace with sticky routing, otherwise the next healthy one.
+func (p *executorPool) route(args any) (*grpc.ClientConn, error) {
+	req, ok := args.(workspaceScoped)
+	if !p.sticky || !ok {
+		return p.roundRobin()
+	}
+	addr := p.executorFor(req.GetContext(), req.GetWorkspace())
+	p.mu.RLock()
+	conn := p.conns[addr]
+	p.mu.RUnlock()
+	if !healthy(conn) {
+		return nil, status.Errorf(codes.Unavailable, "executor %s holding workspace %s/%s is unavailable", addr, req.GetContext(), req.GetWorkspace())
+	}
+	return conn, nil
+}
+
+func (p *executorPool) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	_, perWorkspace := args.(workspaceScoped)
+	_, perContext := args.(contextScoped)
+	if p.sticky && (perContext && !perWorkspace || listing(args)) {
+		return p.broadcast(ctx, method, args, reply, opts...)
+	}
+
+	conn, err := p.route(args)
+	if err != nil {
+		return err
+	}
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// listing reports whether a call lists what the executors hold, so every
+// executor has to answer for the result to be complete.
+func listing(args any) bool {
+	switch args.(type) {
+	case *pb.ListContextsRequest, *pb.ListWorkspacesRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// broadcast sends a call to every executor, each with its own reply, and
+// merges the replies into reply. It succeeds if any executor accepted the
+// call, except that listings fail unless every executor answered.
+func (p *executorPool) broadcast(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	p.mu.RLock()
+	addrs := append([]string(nil), p.addrs...)
+	conns := make([]*grpc.ClientConn, len(addrs))
+	for i, addr := range addrs {
+		conns[i] = p.conns[addr]
+	}
+	p.mu.RUnlock()
+
+	var firstErr error
+	var replies []proto.Message
+	for i, conn := range conns {
+		executorReply := reply.(proto.Message).ProtoReflect().New().Interface()
+		if err := conn.Invoke(ctx, method, args, executorReply, opts...); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("executor %s: %v", addrs[i], err)
+			}
+			continue
+		}
+		replies = append(replies, executorReply)
+	}
+	if len(replies) == 0 || firstErr != nil && listing(args) {
+		return firstErr
+	}
+	mergeReplies(reply.(proto.Message), replies)
+	return nil
+}
+
+// mergeReplies merges the replies executors sent to a broadcast call into
+// reply. Listings are the sorted union of what the executors that have the
+// context list, failing only if none has it. Other calls take the first
+// successful reply, or the first reply when none succeeded.
+func mergeReplies(reply proto.Message, replies []proto.Message) {
+	switch reply := reply.(type) {
+	case *pb.ListContextsResponse:
+		for _, r := range replies {
+			r := r.(*pb.ListContextsResponse)
+			if r.Success {
+				reply.Success = true
+				reply.Contexts = append(reply.Contexts, r.Contexts...)
+			} else if reply.Error == "" {
+				reply.Error = r.Error
+			}
+		}
+		if reply.Success {
+			slices.Sort(reply.Contexts)
+			reply.Contexts, reply.Error = slices.Compact(reply.Contexts), ""
+		}
+	case *pb.ListWorkspacesResponse:
+		for _, r := range replies {
+			r := r.(*pb.ListWorkspacesResponse)
+			if r.Success {
+				reply.Success = true
+				reply.Workspaces = append(reply.Workspaces, r.Workspaces...)
+			} else if reply.Error == "" {
+				reply.Error = r.Error
+			}
+		}
+		if reply.Success {
+			slices.Sort(reply.Workspaces)
+			reply.Workspaces, reply.Error = slices.Compact(reply.Workspaces), ""
+		}
+	default:
+		chosen := replies[0]
+		for _, r := range replies {
+			if r, ok := r.(interface{ GetSuccess() bool }); ok && r.GetSuccess() {
+				chosen = r.(proto.Message)
+				break
+			}
+		}
+		proto.Merge(reply, chosen)
+	}
+}
+
+func (p *executorPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if p.sticky {
+		// The request that names the workspace is only sent after the stream is opened
+		return &routedStream{ctx: ctx, pool: p, desc: desc, method: method, opts: opts}, nil
+	}
+	conn, err := p.roundRobin()
+	if err != nil {
+		return nil, err
+	}
+	return conn.NewStream(ctx, desc, method, opts...)
+}
+
+// routedStream is a client stream that is opened on the executor its first
+// message routes to. Until then, only SendMsg and Context may be called,
+// which holds for server-streaming calls such as StreamApply.
+type routedStream struct {
+	grpc.ClientStream // Set by the first SendMsg
+
+	ctx    context.Context
+	pool   *executorPool
+	desc   *grpc.StreamDesc
+	method string
+	opts   []grpc.CallOption
+}
+
+func (s *routedStream) SendMsg(m any) error {
+	if s.ClientStream == nil {
+		conn, err := s.pool.route(m)
+		if err != nil {
+			return err
+		}
+		stream, err := conn.NewStream(s.ctx, s.desc, s.method, s.opts...)
+		if err != nil {
+			return err
+		}
+		s.ClientStream = stream
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *routedStream) Context() context.Context {
+	if s.ClientStream == nil {
+		return s.ctx
+	}
+	return s.ClientStream.Context()
+}
+
+func (p *executorPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for _, conn := range p.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type ExecutorStatus struct {
+	Address string `json:"address"`
+	State   string `json:"state"`
+	Healthy bool   `json:"healthy"`
+}
+
+func (p *executorPool) status() []ExecutorStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	statuses := make([]ExecutorStatus, len(p.addrs))
+	for i, addr := range p.addrs {
+		conn := p.conns[addr]
+		statuses[i] = ExecutorStatus{
+			Address: addr,
+			State:   conn.GetState().String(),
+			Healthy: healthy(conn),
+		}
+	}
+	return statuses
+}
+
+func (s *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	statuses := s.executors.status()
+	ready := false
+	for _, status := range statuses {
+		ready = ready || status.Healthy
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"ready":     ready,
+		"executors": statuses,
+	})
+}
+
+// handleExecutors replaces the executor pool membership at runtime.
+func (s *Service) handleExecutors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if !s.isAdmin(r) {
+		writeError(w, http.StatusForbidden, APIErrorForbidden, "This endpoint requires a valid X-Admin-Token", "")
+		return
+	}
+
+	var req struct {
+		Addrs []string `json:"addrs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidBody, "Invalid request body", err.Error())
+		return
+	}
+	if err := s.executors.update(req.Addrs); err != nil {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "Failed to update executors", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.executors.status())
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	pb "request-processor/api/proto"
+)
+
+func TestExecutorFor(t *testing.T) {
+	workspaces := make([]string, 1000)
+	for i := range workspaces {
+		workspaces[i] = fmt.Sprintf("ws-%d", i)
+	}
+	owners := func(pool *executorPool) map[string]string {
+		owner := make(map[string]string, len(workspaces))
+		for _, ws := range workspaces {
+			owner[ws] = pool.executorFor("ctx", ws)
+		}
+		return owner
+	}
+
+	pool := newTestExecutorPool(t, []string{"executor-a:50051", "executor-b:50051", "executor-c:50051"}, true)
+	before := owners(pool)
+	if again := owners(pool); fmt.Sprint(again) != fmt.Sprint(before) {
+		t.Fatal("executorFor is not stable")
+	}
+	counts := make(map[string]int)
+	for _, addr := range before {
+		counts[addr]++
+	}
+	for _, addr := range pool.addrs {
+		if counts[addr] < len(workspaces)/10 {
+			t.Errorf("executor %s owns %d of %d workspaces", addr, counts[addr], len(workspaces))
+		}
+	}
+
+	tests := []struct {
+		name  string
+		addrs []string
+		moved func(from, to string) bool // Whether a move is expected
+	}{
+		{
+			name:  "executor added",
+			addrs: []string{"executor-a:50051", "executor-b:50051", "executor-c:50051", "executor-d:50051"},
+			moved: func(from, to string) bool { return to == "executor-d:50051" },
+		},
+		{
+			name:  "executor removed",
+			addrs: []string{"executor-a:50051", "executor-c:50051"},
+			moved: func(from, to string) bool { return from == "executor-b:50051" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newTestExecutorPool(t, []string{"executor-a:50051", "executor-b:50051", "executor-c:50051"}, true)
+			if err := pool.update(tt.addrs); err != nil {
+				t.Fatal(err)
+			}
+			moves := 0
+			for ws, to := range owners(pool) {
+				from := before[ws]
+				if from == to {
+					continue
+				}
+				moves++
+				if !tt.moved(from, to) {
+					t.Errorf("workspace %s moved from %s to %s", ws, from, to)
+				}
+			}
+			if moves == 0 {
+				t.Error("no workspace moved")
+			}
+		})
+	}
+}
+
+func TestStickyRouting(t *testing.T) {
+	addrs := make([]string, 3)
+	names := make(map[string]string)
+	for i := range addrs {
+		name := fmt.Sprintf("executor-%d", i)
+		addrs[i] = startExecutorServer(t, &executorServer{name: name})
+		names[addrs[i]] = name
+	}
+	pool := newTestExecutorPool(t, addrs, true)
+	client := pb.NewExecutorClient(pool)
+	ctx := context.Background()
+
+	for i := range 20 {
+		ws := fmt.Sprintf("ws-%d", i)
+		want := names[pool.executorFor("ctx", ws)]
+
+		plan, err := client.Plan(ctx, &pb.PlanRequest{Context: "ctx", Workspace: ws})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.PlanOutput != want {
+			t.Errorf("plan of %s ran on %s, want %s", ws, plan.PlanOutput, want)
+		}
+
+		stream, err := client.StreamApply(ctx, &pb.ApplyRequest{Context: "ctx", Workspace: ws})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Output != want {
+			t.Errorf("streamed apply of %s ran on %s, want %s", ws, chunk.Output, want)
+		}
+	}
+}
+
+func TestBroadcastMergesListings(t *testing.T) {
+	pool := newTestExecutorPool(t, []string{
+		startExecutorServer(t, &executorServer{workspaces: map[string][]string{"a": {"w1", "w2"}, "b": {"x"}}}),
+		startExecutorServer(t, &executorServer{workspaces: map[string][]string{"a": {"w1", "w3"}}}),
+	}, true)
+	client := pb.NewExecutorClient(pool)
+	ctx := context.Background()
+
+	contexts, err := client.ListContexts(ctx, &pb.ListContextsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !contexts.Success || !reflect.DeepEqual(contexts.Contexts, want) {
+		t.Errorf("contexts = %v (success %v), want %v", contexts.Contexts, contexts.Success, want)
+	}
+
+	tests := []struct {
+		context string
+		want    []string
+		wantErr string // Listing error when no executor has the context
+	}{
+		{"a", []string{"w1", "w2", "w3"}, ""},
+		{"b", []string{"x"}, ""},
+		{"c", nil, "context c not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.context, func(t *testing.T) {
+			resp, err := client.ListWorkspaces(ctx, &pb.ListWorkspacesRequest{Context: tt.context})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Success != (tt.wantErr == "") || resp.Error != tt.wantErr {
+				t.Errorf("success = %v, error = %q, want error %q", resp.Success, resp.Error, tt.wantErr)
+			}
+			if !reflect.DeepEqual(resp.Workspaces, tt.want) {
+				t.Errorf("workspaces = %v, want %v", resp.Workspaces, tt.want)
+			}
+		})
+	}
+}
+
+func TestBroadcastListingNeedsEveryExecutor(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := listener.Addr().String() // Nothing serves here once closed
+	listener.Close()
+	up := startExecutorServer(t, &executorServer{workspaces: map[string][]string{"a": {"w1"}}})
+	client := pb.NewExecutorClient(newTestExecutorPool(t, []string{up, down}, true))
+
+	if _, err := client.ListWorkspaces(context.Background(), &pb.ListWorkspacesRequest{Context: "a"}); err == nil {
+		t.Error("listing succeeded with an executor down, want an error rather than a partial list")
+	}
+}
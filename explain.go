@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const errorExplanationNamespace = "error_explanations"
+
+// volatileErrorText matches IDs, addresses and numbers that differ between
+// occurrences of the same error, so they are left out of its signature.
+var volatileErrorText = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f-]{27,}|\b\d+(\.\d+)*\b|"[^"]*"`)
+
+func generateErrorExplanationPrompt(description, errorText, code string) string {
+	return fmt.Sprintf(`You are helping someone who is not an infrastructure expert understand why their request failed.
+
+	What they asked for:
+	%s
+
+	Terraform Error:
+	%s
+
+	Relevant Terraform Code:
+	%s
+
+	Requirements:
+	1. Explain in plain English, in at most 4 sentences, what went wrong and why
+	2. Avoid Terraform jargon; name resources by what they are, e.g. "the web server" rather than "digitalocean_droplet.web"
+	3. End with one sentence on what they can change in their request to fix it
+	4. DO NOT include any code`,
+		description,
+		errorText,
+		code,
+	)
+}
+
+// errorSignature identifies an error independently of the IDs, names and
+// numbers in its text, so the same kind of failure shares an explanation.
+func errorSignature(causes []failureCause, errorText string) string {
+	var parts []string
+	for _, cause := range causes {
+		resourceType, _, _ := strings.Cut(cause.Resource, ".")
+		parts = append(parts, volatileErrorText.ReplaceAllString(cause.Summary, "#")+"|"+resourceType)
+	}
+	if len(parts) == 0 {
+		parts = append(parts, volatileErrorText.ReplaceAllString(errorText, "#"))
+	}
+	sort.Strings(parts)
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// explainError sets response.ErrorExplanation to a plain-English explanation
+// of the failure. Explanations are cached by error signature.
+func (s *Service) explainError(ctx context.Context, description string, response *TerraformResponse, usage *llmUsage) {
+	causes := s.failureCauses(response)
+	key := errorSignature(causes, response.Error)
+
+	if value, err := s.store.Get(ctx, errorExplanationNamespace, key); err == nil && !cacheBypassed(ctx) {
+		var gen generation
+		if err := json.Unmarshal(value, &gen); err == nil {
+			recordCacheHit(ctx, CacheErrorExplanation)
+			gen.FromCache = true
+			usage.record(&gen, s.config().ModelPricing)
+			response.ErrorExplanation = gen.Code
+			return
+		}
+	}
+
+	code := response.Code
+	if blocks, err := resourceBlocks(response.Code); err == nil {
+		var relevant []string
+		for _, cause := range causes {
+			if block, ok := blocks[resourceIndex.ReplaceAllString(cause.Resource, "")]; ok {
+				relevant = append(relevant, block)
+			}
+		}
+		if len(relevant) > 0 {
+			code = strings.Join(relevant, "\n\n")
+		}
+	}
+	errorText := response.Error
+	if len(causes) > 0 {
+		var summaries []string
+		for _, cause := range causes {
+			summaries = append(summaries, fmt.Sprintf("Error: %s (resource: %s)", cause.Summary, cause.Resource))
+		}
+		errorText = strings.Join(summaries, "\n") + "\n\n" + response.Error
+	}
+
+	gen, err := s.complete(ctx, s.auxiliaryModel(anthropic.ModelClaude3_5HaikuLatest), generateErrorExplanationPrompt(description, errorText, code), 512)
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to explain error", "error", err)
+		return
+	}
+	gen.Code = strings.TrimSpace(gen.Code)
+	usage.record(gen, s.config().ModelPricing)
+	response.ErrorExplanation = gen.Code
+
+	value, err := json.Marshal(gen)
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to encode error explanation", "error", err)
+		return
+	}
+	ttl := time.Duration(s.config().ErrorExplanationTTLSeconds) * time.Second
+	if err := s.store.Put(ctx, errorExplanationNamespace, key, value, ttl); err != nil {
+		s.runLogger(ctx).Warn("failed to cache error explanation", "error", err)
+	}
+}
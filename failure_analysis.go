@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FailureAnalysis links each terraform error to the resource it names, the
+// line of generated code it points at, and the phrase of the request that
+// most likely produced that resource.
+type FailureAnalysis struct {
+	Nodes []FailureNode `json:"nodes"`
+	Edges []FailureEdge `json:"edges"`
+}
+
+// Kinds of FailureNode.
+const (
+	FailureNodeError    = "error"
+	FailureNodeResource = "resource"
+	FailureNodeCode     = "code"
+	FailureNodeRequest  = "request"
+)
+
+type FailureNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`          // Error summary, resource address, code line or request phrase
+	Line  int    `json:"line,omitempty"` // Line in the generated code, for code nodes
+}
+
+type FailureEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"` // "affects", "reported_at", "defined_at" or "requested_by"
+}
+
+var (
+	terraformErrorLine = regexp.MustCompile(`(?m)^[ \t│╷]*Error: (.+)$`)
+	terraformErrorPos  = regexp.MustCompile(`on (\S+) line (\d+)(?:, in resource "([^"]+)" "([^"]+)")?`)
+	resourceIndex      = regexp.MustCompile(`\[[^\]]*\]$`)
+	requestPhraseSplit = regexp.MustCompile(`[.;,\n]+|\s+and\s+`)
+	attributionWord    = regexp.MustCompile(`[a-z0-9]+`)
+)
+
+// failureCause is one error parsed from terraform output or diagnostics.
+type failureCause struct {
+	Summary  string
+	Resource string
+	File     string // File the error is reported in, usually main.tf
+	Line     int
+}
+
+// failureCauses extracts the errors of a failed response. Text output is
+// split at each "Error:" line so that the resource and position printed
+// below an error are attributed to it.
+func (s *Service) failureCauses(response *TerraformResponse) []failureCause {
+	var causes []failureCause
+	seen := make(map[string]bool)
+	add := func(c failureCause) {
+		key := fmt.Sprintf("%s|%s|%d", c.Summary, c.Resource, c.Line)
+		if !seen[key] {
+			seen[key] = true
+			causes = append(causes, c)
+		}
+	}
+
+	for _, d := range response.Diagnostics {
+		if d.Severity != "error" {
+			continue
+		}
+		c := failureCause{Summary: d.Summary}
+		if d.Range != nil {
+			c.File, c.Line = d.Range.Filename, d.Range.Start.Line
+		}
+		add(c)
+	}
+
+	for _, text := range []string{response.Error, response.Output} {
+		matches := terraformErrorLine.FindAllStringSubmatchIndex(text, -1)
+		for i, m := range matches {
+			end := len(text)
+			if i+1 < len(matches) {
+				end = matches[i+1][0]
+			}
+			chunk := text[m[1]:end]
+
+			c := failureCause{Summary: strings.TrimSpace(text[m[2]:m[3]])}
+			if r := s.errorResourcePattern.FindStringSubmatch(chunk); r != nil {
+				c.Resource = r[1]
+			}
+			if p := terraformErrorPos.FindStringSubmatch(chunk); p != nil {
+				c.File = p[1]
+				c.Line, _ = strconv.Atoi(p[2])
+				if c.Resource == "" && p[3] != "" {
+					c.Resource = p[3] + "." + p[4]
+				}
+			}
+			add(c)
+		}
+	}
+	return causes
+}
+
+// codeBlock is the line span of a top-level block in the generated code.
+type codeBlock struct {
+	Address   string
+	Type      string // Resource or data source type
+	StartLine int
+	EndLine   int
+}
+
+func codeBlocks(code string) []codeBlock {
+	body, err := parseHCL(code)
+	if err != nil {
+		return nil
+	}
+
+	var blocks []codeBlock
+	for _, block := range body.Blocks {
+		b := codeBlock{
+			StartLine: block.Range().Start.Line,
+			EndLine:   block.Range().End.Line,
+		}
+		switch {
+		case block.Type == "resource" && len(block.Labels) == 2:
+			b.Address, b.Type = block.Labels[0]+"."+block.Labels[1], block.Labels[0]
+		case block.Type == "data" && len(block.Labels) == 2:
+			b.Address, b.Type = "data."+block.Labels[0]+"."+block.Labels[1], block.Labels[0]
+		default:
+			b.Address = strings.Join(append([]string{block.Type}, block.Labels...), ".")
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// analyzeFailure builds the failure graph for a failed response. It returns
+// nil when no errors can be parsed.
+func (s *Service) analyzeFailure(description, code string, response *TerraformResponse) *FailureAnalysis {
+	causes := s.failureCauses(response)
+	if len(causes) == 0 {
+		return nil
+	}
+
+	blocks := codeBlocks(code)
+	lines := strings.Split(code, "\n")
+	phrases := requestPhrases(description)
+
+	analysis := &FailureAnalysis{}
+	nodes := make(map[string]bool)
+	edges := make(map[string]bool)
+	addNode := func(n FailureNode) {
+		if !nodes[n.ID] {
+			nodes[n.ID] = true
+			analysis.Nodes = append(analysis.Nodes, n)
+		}
+	}
+	addEdge := func(from, to, relation string) {
+		if key := from + ">" + to; !edges[key] {
+			edges[key] = true
+			analysis.Edges = append(analysis.Edges, FailureEdge{From: from, To: to, Relation: relation})
+		}
+	}
+	codeNode := func(line int) string {
+		id := fmt.Sprintf("code:%d", line)
+		label := ""
+		if line > 0 && line <= len(lines) {
+			label = strings.TrimSpace(lines[line-1])
+		}
+		addNode(FailureNode{ID: id, Kind: FailureNodeCode, Label: label, Line: line})
+		return id
+	}
+
+	for i, cause := range causes {
+		errorID := fmt.Sprintf("error:%d", i+1)
+		addNode(FailureNode{ID: errorID, Kind: FailureNodeError, Label: cause.Summary})
+
+		if cause.File != "" && cause.File != "main.tf" {
+			cause.Line = 0 // Not a line of the generated code
+		}
+		var block *codeBlock
+		address := resourceIndex.ReplaceAllString(cause.Resource, "")
+		for j := range blocks {
+			if (address != "" && blocks[j].Address == address) ||
+				(address == "" && cause.Line >= blocks[j].StartLine && cause.Line <= blocks[j].EndLine) {
+				block = &blocks[j]
+				break
+			}
+		}
+		if address == "" && block != nil {
+			address = block.Address
+		}
+
+		if cause.Line > 0 {
+			addEdge(errorID, codeNode(cause.Line), "reported_at")
+		}
+		if address == "" {
+			continue
+		}
+
+		resourceID := "resource:" + address
+		addNode(FailureNode{ID: resourceID, Kind: FailureNodeResource, Label: address})
+		addEdge(errorID, resourceID, "affects")
+		if block != nil {
+			addEdge(resourceID, codeNode(block.StartLine), "defined_at")
+		}
+
+		terms := strings.ReplaceAll(address, ".", "_")
+		if cause.Line > 0 && cause.Line <= len(lines) {
+			terms += " " + lines[cause.Line-1]
+		}
+		if p := attributePhrase(phrases, terms); p >= 0 {
+			phraseID := fmt.Sprintf("request:%d", p+1)
+			addNode(FailureNode{ID: phraseID, Kind: FailureNodeRequest, Label: phrases[p]})
+			addEdge(resourceID, phraseID, "requested_by")
+		}
+	}
+	return analysis
+}
+
+func requestPhrases(description string) []string {
+	var phrases []string
+	for _, p := range requestPhraseSplit.Split(description, -1) {
+		if p = strings.TrimSpace(p); p != "" {
+			phrases = append(phrases, p)
+		}
+	}
+	return phrases
+}
+
+// attributePhrase returns the index of the phrase sharing the most words with
+// terms, or -1 if none shares any. Words match when one is a prefix of the
+// other, so "droplets" matches "droplet".
+func attributePhrase(phrases []string, terms string) int {
+	termWords := attributionWord.FindAllString(strings.ToLower(strings.ReplaceAll(terms, "_", " ")), -1)
+
+	best, bestScore := -1, 0
+	for i, phrase := range phrases {
+		score := 0
+		for _, word := range attributionWord.FindAllString(strings.ToLower(phrase), -1) {
+			if len(word) < 3 {
+				continue
+			}
+			for _, term := range termWords {
+				if len(term) >= 3 && (strings.HasPrefix(word, term) || strings.HasPrefix(term, word)) {
+					score++
+					break
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
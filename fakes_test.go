@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	pb "request-processor/api/proto"
+)
+
+// fakeGenerator replies to prompts with canned code, in order, and records
+// the prompts it was sent.
+type fakeGenerator struct {
+	mu      sync.Mutex
+	replies []string
+	prompts []string
+}
+
+func (g *fakeGenerator) Complete(ctx context.Context, model, prompt string, maxTokens int64) (*generation, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.prompts) >= len(g.replies) {
+		return nil, fmt.Errorf("fake generator: no reply for prompt %d", len(g.prompts)+1)
+	}
+	reply := g.replies[len(g.prompts)]
+	g.prompts = append(g.prompts, prompt)
+	return &generation{Code: reply, Model: model, InputTokens: 100, OutputTokens: 50, StopReason: "end_turn"}, nil
+}
+
+func (g *fakeGenerator) calls() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.prompts)
+}
+
+// newTestService returns a Service on a memory store with config defaults.
+// Tests set the fields they need on top.
+func newTestService(config *Config) *Service {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.DefaultModel == "" {
+		config.DefaultModel = "test-model"
+	}
+	if config.MaxCodeBytes == 0 {
+		config.MaxCodeBytes = 1 << 20
+	}
+	if config.MaxParallelRegions == 0 {
+		config.MaxParallelRegions = 4
+	}
+	if config.ActionTimeoutSeconds == nil {
+		config.ActionTimeoutSeconds = defaultActionTimeouts
+	}
+	if config.Retry.MaxAttempts == nil {
+		attempts, delay := 3, 0
+		config.Retry.MaxAttempts, config.Retry.DelaySeconds = &attempts, &delay
+	}
+	store := newMemoryStore(0)
+	return &Service{
+		store:          store,
+		history:        &storeHistory{store: store},
+		llmLimiter:     newLLMLimiter(1, nil),
+		workspaceCache: newWorkspaceCache(0),
+		workspaceLocks: newWorkspaceLocks(time.Second),
+		currentConfig:  config,
+		callbackClient: newCallbackClient(config.CallbackAllowedHosts),
+
+		errorResourcePattern: regexp.MustCompile(defaultErrorResourcePattern),
+	}
+}
+
+// fakeWorkspace is a workspace as the fake executor keeps it.
+type fakeWorkspace struct {
+	code      string
+	variables map[string]string
+	applied   string // Code of the last successful apply
+	destroyed bool
+}
+
+// fakeExecutor is an in-memory executor. Workspaces exist once created or
+// seeded. Methods it doesn't fake panic through the nil embedded client.
+type fakeExecutor struct {
+	pb.ExecutorClient
+
+	mu         sync.Mutex
+	workspaces map[string]*fakeWorkspace // By "context/workspace"
+	calls      []string                  // "Method context/workspace", in order
+	errs       map[string]error          // Returned once by the next "Method workspace" call
+	failApply  map[string]bool           // Workspaces whose applies report failure
+	planJSON   map[string]string         // Plan JSON by workspace; no changes when unset
+	planFiles  map[string]string         // Plan file each workspace's last apply used
+	secrets    map[string][]string       // Secret values injected into each workspace
+	output     map[string]string         // Apply output by workspace
+	initErrs   map[string]string         // terraform init error plans report, by workspace
+}
+
+func newFakeExecutor() *fakeExecutor {
+	return &fakeExecutor{
+		workspaces: make(map[string]*fakeWorkspace),
+		errs:       make(map[string]error),
+		failApply:  make(map[string]bool),
+		planJSON:   make(map[string]string),
+		planFiles:  make(map[string]string),
+		secrets:    make(map[string][]string),
+		output:     make(map[string]string),
+		initErrs:   make(map[string]string),
+	}
+}
+
+// seed creates a workspace with code and variables, as if applied.
+func (e *fakeExecutor) seed(contextName, workspace, code string, variables map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.workspaces[contextName+"/"+workspace] = &fakeWorkspace{code: code, variables: variables, applied: code}
+}
+
+func (e *fakeExecutor) workspace(contextName, workspace string) *fakeWorkspace {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.workspaces[contextName+"/"+workspace]
+}
+
+// called returns the calls made to method, as "context/workspace", sorted.
+func (e *fakeExecutor) called(method string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var calls []string
+	for _, call := range e.calls {
+		if m, target, _ := strings.Cut(call, " "); m == method {
+			calls = append(calls, target)
+		}
+	}
+	sort.Strings(calls)
+	return calls
+}
+
+// call records a call and returns its workspace, the configured error, and
+// whether the workspace exists. The caller must not hold e.mu.
+func (e *fakeExecutor) call(method, contextName, workspace string) (*fakeWorkspace, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, method+" "+contextName+"/"+workspace)
+	if err := e.errs[method+" "+workspace]; err != nil {
+		delete(e.errs, method+" "+workspace)
+		return nil, err
+	}
+	return e.workspaces[contextName+"/"+workspace], nil
+}
+
+func (e *fakeExecutor) CreateContext(ctx context.Context, in *pb.CreateContextRequest, opts ...grpc.CallOption) (*pb.CreateContextResponse, error) {
+	return &pb.CreateContextResponse{Success: true}, nil
+}
+
+func (e *fakeExecutor) CreateWorkspace(ctx context.Context, in *pb.CreateWorkspaceRequest, opts ...grpc.CallOption) (*pb.CreateWorkspaceResponse, error) {
+	ws, err := e.call("CreateWorkspace", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		e.mu.Lock()
+		e.workspaces[in.Context+"/"+in.Workspace] = &fakeWorkspace{}
+		e.mu.Unlock()
+	}
+	return &pb.CreateWorkspaceResponse{Success: true}, nil
+}
+
+func (e *fakeExecutor) GetMainTf(ctx context.Context, in *pb.GetMainTfRequest, opts ...grpc.CallOption) (*pb.GetMainTfResponse, error) {
+	ws, err := e.call("GetMainTf", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, status.Error(codes.NotFound, "workspace not found")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return &pb.GetMainTfResponse{Content: ws.code}, nil
+}
+
+func (e *fakeExecutor) GetVariables(ctx context.Context, in *pb.GetVariablesRequest, opts ...grpc.CallOption) (*pb.GetVariablesResponse, error) {
+	ws, err := e.call("GetVariables", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, status.Error(codes.NotFound, "workspace not found")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return &pb.GetVariablesResponse{Success: true, Variables: ws.variables}, nil
+}
+
+func (e *fakeExecutor) GetSecretHashes(ctx context.Context, in *pb.GetSecretHashesRequest, opts ...grpc.CallOption) (*pb.GetSecretHashesResponse, error) {
+	if _, err := e.call("GetSecretHashes", in.Context, in.Workspace); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resp := &pb.GetSecretHashesResponse{Success: true}
+	for _, secret := range e.secrets[in.Workspace] {
+		sum := sha256.Sum256([]byte(secret))
+		resp.Sha256Hashes = append(resp.Sha256Hashes, hex.EncodeToString(sum[:]))
+	}
+	return resp, nil
+}
+
+func (e *fakeExecutor) ClearCode(ctx context.Context, in *pb.ClearCodeRequest, opts ...grpc.CallOption) (*pb.ClearCodeResponse, error) {
+	ws, err := e.call("ClearCode", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws != nil {
+		e.mu.Lock()
+		ws.code = ""
+		e.mu.Unlock()
+	}
+	return &pb.ClearCodeResponse{Success: true}, nil
+}
+
+func (e *fakeExecutor) AppendCode(ctx context.Context, in *pb.AppendCodeRequest, opts ...grpc.CallOption) (*pb.AppendCodeResponse, error) {
+	ws, err := e.call("AppendCode", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, status.Error(codes.NotFound, "workspace not found")
+	}
+	e.mu.Lock()
+	ws.code += in.Code
+	e.mu.Unlock()
+	return &pb.AppendCodeResponse{Success: true}, nil
+}
+
+func (e *fakeExecutor) SetVariables(ctx context.Context, in *pb.SetVariablesRequest, opts ...grpc.CallOption) (*pb.SetVariablesResponse, error) {
+	ws, err := e.call("SetVariables", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, status.Error(codes.NotFound, "workspace not found")
+	}
+	e.mu.Lock()
+	ws.variables = in.Variables
+	e.mu.Unlock()
+	return &pb.SetVariablesResponse{Success: true}, nil
+}
+
+func (e *fakeExecutor) Plan(ctx context.Context, in *pb.PlanRequest, opts ...grpc.CallOption) (*pb.PlanResponse, error) {
+	if _, err := e.call("Plan", in.Context, in.Workspace); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resp := &pb.PlanResponse{Success: true, PlanOutput: "Plan: 1 to add, 0 to change, 0 to destroy.", PlanJson: `{"resource_changes":[]}`}
+	if plan, ok := e.planJSON[in.Workspace]; ok {
+		resp.PlanJson = plan
+	}
+	if initErr, ok := e.initErrs[in.Workspace]; ok {
+		resp = &pb.PlanResponse{Success: false, InitOutput: "Initializing provider plugins...", InitError: initErr}
+	}
+	if in.Save {
+		resp.PlanFile = in.Context + "/" + in.Workspace + "/tfplan"
+	}
+	return resp, nil
+}
+
+func (e *fakeExecutor) Apply(ctx context.Context, in *pb.ApplyRequest, opts ...grpc.CallOption) (*pb.ApplyResponse, error) {
+	ws, err := e.call("Apply", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.planFiles[in.Workspace] = in.PlanFile
+	if ws == nil || e.failApply[in.Workspace] {
+		return &pb.ApplyResponse{Success: false, Error: "Error: apply failed"}, nil
+	}
+	ws.applied, ws.destroyed = ws.code, false
+	output := "Apply complete! Resources: 1 added, 0 changed, 0 destroyed."
+	if o, ok := e.output[in.Workspace]; ok {
+		output = o
+	}
+	return &pb.ApplyResponse{Success: true, ApplyOutput: output}, nil
+}
+
+func (e *fakeExecutor) Destroy(ctx context.Context, in *pb.DestroyRequest, opts ...grpc.CallOption) (*pb.DestroyResponse, error) {
+	ws, err := e.call("Destroy", in.Context, in.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws != nil {
+		e.mu.Lock()
+		ws.applied, ws.destroyed = "", true
+		e.mu.Unlock()
+	}
+	return &pb.DestroyResponse{Success: true, DestroyOutput: "Destroy complete! Resources: 1 destroyed."}, nil
+}
+
+func (e *fakeExecutor) UpgradeTerraform(ctx context.Context, in *pb.UpgradeTerraformRequest, opts ...grpc.CallOption) (*pb.UpgradeTerraformResponse, error) {
+	if _, err := e.call("UpgradeTerraform", in.Context, in.Workspace); err != nil {
+		return nil, err
+	}
+	return &pb.UpgradeTerraformResponse{Success: true, Version: in.MinVersion}, nil
+}
+
+// Output reports no outputs.
+func (e *fakeExecutor) Output(ctx context.Context, in *pb.OutputRequest, opts ...grpc.CallOption) (*pb.OutputResponse, error) {
+	if _, err := e.call("Output", in.Context, in.Workspace); err != nil {
+		return nil, err
+	}
+	return &pb.OutputResponse{Success: true, OutputJson: "{}"}, nil
+}
+
+// executorServer is a gRPC executor for tests that need real connections,
+// such as those of the executor pool. Methods it doesn't fake are
+// unimplemented.
+type executorServer struct {
+	pb.UnimplementedExecutorServer
+
+	name       string              // Reported as the output of plans and applies
+	notServing string              // Health reports not serving, with this error
+	workspaces map[string][]string // Workspaces held, by context
+}
+
+func (e *executorServer) ListContexts(ctx context.Context, in *pb.ListContextsRequest) (*pb.ListContextsResponse, error) {
+	var contexts []string
+	for contextName := range e.workspaces {
+		contexts = append(contexts, contextName)
+	}
+	sort.Strings(contexts)
+	return &pb.ListContextsResponse{Success: true, Contexts: contexts}, nil
+}
+
+func (e *executorServer) ListWorkspaces(ctx context.Context, in *pb.ListWorkspacesRequest) (*pb.ListWorkspacesResponse, error) {
+	workspaces, ok := e.workspaces[in.Context]
+	if !ok {
+		return &pb.ListWorkspacesResponse{Success: false, Error: "context " + in.Context + " not found"}, nil
+	}
+	return &pb.ListWorkspacesResponse{Success: true, Workspaces: workspaces}, nil
+}
+
+func (e *executorServer) Plan(ctx context.Context, in *pb.PlanRequest) (*pb.PlanResponse, error) {
+	return &pb.PlanResponse{Success: true, PlanOutput: e.name}, nil
+}
+
+func (e *executorServer) StreamApply(in *pb.ApplyRequest, stream grpc.ServerStreamingServer[pb.ApplyChunk]) error {
+	if err := stream.Send(&pb.ApplyChunk{Output: e.name}); err != nil {
+		return err
+	}
+	return stream.Send(&pb.ApplyChunk{Result: &pb.ApplyResponse{Success: true, ApplyOutput: e.name}})
+}
+
+func (e *executorServer) Health(ctx context.Context, in *pb.HealthRequest) (*pb.HealthResponse, error) {
+	if e.notServing != "" {
+		return &pb.HealthResponse{Serving: false, Error: e.notServing}, nil
+	}
+	return &pb.HealthResponse{Serving: true}, nil
+}
+
+// startExecutorServer serves srv on a local port until the test ends and
+// returns its address.
+func startExecutorServer(t *testing.T, srv pb.ExecutorServer) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterExecutorServer(server, srv)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+// newTestExecutorPool returns a pool of the executors at addrs, closed when
+// the test ends.
+func newTestExecutorPool(t *testing.T, addrs []string, sticky bool) *executorPool {
+	t.Helper()
+	pool, err := newExecutorPool(addrs, sticky, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
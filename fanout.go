@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Outcomes of a fan-out apply, returned in TerraformResponse.Transaction.
+const (
+	TransactionCommitted      = "committed"
+	TransactionRolledBack     = "rolled_back"
+	TransactionRollbackFailed = "rollback_failed"
+	TransactionFailed         = "failed" // Some workspaces failed and auto-rollback is off
+)
+
+// Stages a workspace reaches in a fan-out apply, which decide how it is
+// rolled back.
+const (
+	fanOutUntouched = iota // Nothing changed, nothing to roll back
+	fanOutChanged          // Code and variables written but not applied
+	fanOutApplied          // Apply ran, whatever its outcome
+)
+
+// workspaceSnapshot is a workspace's configuration before a fan-out apply.
+type workspaceSnapshot struct {
+	Code      string            // "" if the workspace had none
+	Variables map[string]string // terraform.tfvars values
+}
+
+// snapshotWorkspace reads a workspace's code and variables. A workspace that
+// doesn't exist yet has an empty snapshot.
+func (s *Service) snapshotWorkspace(ctx context.Context, contextName, workspace string) (workspaceSnapshot, error) {
+	code, err := s.workspaceCode(ctx, contextName, workspace)
+	if status.Code(err) == codes.NotFound {
+		return workspaceSnapshot{}, nil
+	}
+	if err != nil {
+		return workspaceSnapshot{}, fmt.Errorf("failed to read the code of %s: %w", workspace, err)
+	}
+	variables, err := s.getVariables(ctx, contextName, workspace)
+	if status.Code(err) == codes.NotFound {
+		return workspaceSnapshot{Code: code}, nil
+	}
+	if err != nil {
+		return workspaceSnapshot{}, fmt.Errorf("failed to read the variables of %s: %w", workspace, err)
+	}
+	return workspaceSnapshot{Code: code, Variables: variables}, nil
+}
+
+// processFanOutApply generates one configuration and applies it to every
+// workspace in req.Workspaces with all-or-nothing semantics. If any apply
+// fails and the context has auto-rollback on, every workspace that was
+// applied is rolled back to the code and variables it had before: the old
+// code is re-applied, or the workspace is destroyed if it had none.
+// Workspaces whose files were written but never applied get their old files
+// back without an apply.
+func (s *Service) processFanOutApply(ctx context.Context, req TerraformRequest) (*TerraformResponse, error) {
+	usage := &llmUsage{}
+	gen, err := s.generateTerraformCode(ctx, req.Model, req.Provider, describeVariables(req.Description, req.Variables), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCodeGeneration, err)
+	}
+	usage.record(gen, s.config().ModelPricing)
+	if strings.TrimSpace(gen.Code) == "" {
+		return nil, errNotInfrastructure
+	}
+	code, invalid := s.validateGeneratedCode(ctx, gen.Code, req.features.PolicyChecks, true)
+	if invalid != nil {
+		addSuggestions(invalid, req.Provider)
+		return invalid, nil
+	}
+
+	// Without every workspace's previous configuration a rollback can't be
+	// done right, so stop before anything is applied
+	previous := make(map[string]workspaceSnapshot, len(req.Workspaces))
+	for _, workspace := range req.Workspaces {
+		snapshot, err := s.snapshotWorkspace(ctx, req.Context, workspace)
+		if err != nil {
+			return nil, err
+		}
+		previous[workspace] = snapshot
+	}
+
+	var stagesMu sync.Mutex
+	stages := make(map[string]int, len(req.Workspaces))
+	results := s.forEachWorkspace(req.Workspaces, func(workspace string) *TerraformResponse {
+		resp, stage := s.applyToWorkspace(ctx, req, workspace, code)
+		stagesMu.Lock()
+		stages[workspace] = stage
+		stagesMu.Unlock()
+		return resp
+	})
+
+	response := &TerraformResponse{
+		Success:     true,
+		Code:        code,
+		Workspaces:  results,
+		Transaction: TransactionCommitted,
+	}
+	var failed []string
+	for _, workspace := range req.Workspaces {
+		if !results[workspace].Success {
+			failed = append(failed, workspace)
+		}
+	}
+
+	if len(failed) > 0 && !req.features.AutoRollback {
+		response.Success = false
+		response.Transaction = TransactionFailed
+		response.Error = fmt.Sprintf("fan-out apply failed in: %s; auto-rollback is disabled", strings.Join(failed, ", "))
+	} else if len(failed) > 0 {
+		response.Success = false
+		response.Transaction = TransactionRolledBack
+		response.Error = fmt.Sprintf("fan-out apply failed in: %s", strings.Join(failed, ", "))
+
+		var changed []string
+		for _, workspace := range req.Workspaces {
+			if stages[workspace] != fanOutUntouched {
+				changed = append(changed, workspace)
+			}
+		}
+		s.runLogger(ctx).Warn("fan-out apply failed, rolling back", "context", req.Context, "failed", failed, "rolling_back", changed)
+		rollbacks := s.forEachWorkspace(changed, func(workspace string) *TerraformResponse {
+			return s.rollbackWorkspace(ctx, req.Context, workspace, previous[workspace], stages[workspace] == fanOutApplied)
+		})
+		for _, workspace := range changed {
+			if rb := rollbacks[workspace]; rb.Success {
+				results[workspace].RolledBack = stages[workspace] == fanOutApplied
+			} else {
+				reason := rb.Error
+				if reason == "" {
+					reason = "executor reported failure"
+				}
+				response.Transaction = TransactionRollbackFailed
+				results[workspace].Warnings = append(results[workspace].Warnings, fmt.Sprintf("rollback failed: %s", reason))
+			}
+		}
+	}
+
+	var summary []string
+	for _, workspace := range req.Workspaces {
+		result := results[workspace]
+		status := "succeeded"
+		if !result.Success {
+			status = "failed"
+		}
+		if result.RolledBack {
+			status += ", rolled back"
+		} else if stages[workspace] == fanOutApplied && (response.Transaction == TransactionRolledBack || response.Transaction == TransactionRollbackFailed) {
+			status += ", rollback failed"
+		}
+		summary = append(summary, fmt.Sprintf("%s: %s", workspace, status))
+
+		workspaceReq := req
+		workspaceReq.Workspace = workspace
+		s.recordRun(ctx, workspaceReq, result, usage.Generations)
+	}
+	response.Output = fmt.Sprintf("Transaction %s\n%s", response.Transaction, strings.Join(summary, "\n"))
+	response.OutputNames = outputNames(code)
+	response.CacheSavings = usage.cacheSavings()
+	if req.CanonicalCode {
+		setCanonicalCode(response)
+	}
+	addSuggestions(response, req.Provider)
+	s.addQuotaHint(response)
+
+	return response, nil
+}
+
+// forEachWorkspace runs fn for every workspace, at most MaxParallelRegions at
+// a time, and collects the results by workspace.
+func (s *Service) forEachWorkspace(workspaces []string, fn func(workspace string) *TerraformResponse) map[string]*TerraformResponse {
+	results := make(map[string]*TerraformResponse, len(workspaces))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.config().MaxParallelRegions)
+
+	for _, workspace := range workspaces {
+		wg.Add(1)
+		go func(workspace string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			resp := fn(workspace)
+
+			mu.Lock()
+			results[workspace] = resp
+			mu.Unlock()
+		}(workspace)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// applyToWorkspace applies code to one workspace of a fan-out apply. It also
+// returns the stage the workspace reached.
+func (s *Service) applyToWorkspace(ctx context.Context, req TerraformRequest, workspace, code string) (*TerraformResponse, int) {
+	ctx = s.withInjectedSecrets(ctx, req.Context, workspace)
+	s.touchWorkspace(ctx, req.Context, workspace)
+	unlock, err := s.workspaceLocks.lock(ctx, req.Context, workspace)
+	if err != nil {
+		return &TerraformResponse{Error: err.Error()}, fanOutUntouched
+	}
+	defer unlock()
+	if err := s.prepareWorkspace(ctx, req.Context, workspace, code, req.Variables); err != nil {
+		return &TerraformResponse{Error: err.Error()}, fanOutChanged
+	}
+
+	applyCtx := ctx
+	if s.checkPlanBeforeApply(req) {
+		plan, err := s.savedPlan(ctx, req.Context, workspace, nil)
+		if err != nil {
+			return &TerraformResponse{Error: err.Error()}, fanOutChanged
+		}
+		blocked, err := s.checkProtectedReplacements(req, plan)
+		if err != nil {
+			return &TerraformResponse{Error: err.Error()}, fanOutChanged
+		}
+		if len(blocked) > 0 {
+			return &TerraformResponse{
+				Error:            fmt.Sprintf("apply blocked: plan replaces protected resources: %s", strings.Join(blocked, ", ")),
+				BlockedResources: blocked,
+			}, fanOutChanged
+		}
+		decision, err := s.checkValidationWebhook(ctx, req, workspace, code, plan)
+		if err != nil {
+			return &TerraformResponse{Error: err.Error()}, fanOutChanged
+		}
+		if decision != nil && !decision.Allow {
+			return &TerraformResponse{Error: webhookDeniedError(decision), ValidationWebhook: decision}, fanOutChanged
+		}
+		if plan.planFile != "" {
+			applyCtx = withPlanFile(ctx, plan.planFile)
+		}
+	}
+
+	resp, err := s.executeAction(applyCtx, ActionApply, req.Context, workspace)
+	if err != nil {
+		return &TerraformResponse{Error: err.Error()}, fanOutApplied
+	}
+	if resp.Error != "" {
+		resp.Success = false
+	}
+	if resp.InitError != "" {
+		resp.Success = false
+		if resp.Error == "" {
+			resp.Error = fmt.Sprintf("terraform init failed: %s", resp.InitError)
+		}
+	}
+	resp.Warnings = lockFileWarnings(resp.Output, resp.Error, resp.InitOutput, resp.InitError)
+	if req.IncludePlan {
+		setPlannedChanges(resp)
+	}
+	resp.ResourceResults = s.resourceResults(resp)
+	s.truncateResponseOutputs(ctx, resp)
+	return resp, fanOutApplied
+}
+
+// rollbackWorkspace restores a workspace's previous code and variables. An
+// applied workspace is then re-applied, or destroyed and cleared if it had
+// no code before.
+func (s *Service) rollbackWorkspace(ctx context.Context, contextName, workspace string, previous workspaceSnapshot, applied bool) *TerraformResponse {
+	ctx = s.withInjectedSecrets(ctx, contextName, workspace)
+	unlock, err := s.workspaceLocks.lock(ctx, contextName, workspace)
+	if err != nil {
+		return &TerraformResponse{Error: err.Error()}
+	}
+	defer unlock()
+
+	if previous.Code == "" {
+		if applied {
+			resp, err := s.executeAction(ctx, ActionDestroy, contextName, workspace)
+			if err != nil {
+				return &TerraformResponse{Error: err.Error()}
+			}
+			if !resp.Success || resp.Error != "" {
+				resp.Success = false
+				return resp
+			}
+		}
+		if err := s.restoreFiles(ctx, contextName, workspace, previous); err != nil {
+			return &TerraformResponse{Error: err.Error()}
+		}
+		return &TerraformResponse{Success: true}
+	}
+
+	if err := s.restoreFiles(ctx, contextName, workspace, previous); err != nil {
+		return &TerraformResponse{Error: err.Error()}
+	}
+	if !applied {
+		return &TerraformResponse{Success: true}
+	}
+	resp, err := s.executeAction(ctx, ActionApply, contextName, workspace)
+	if err != nil {
+		return &TerraformResponse{Error: err.Error()}
+	}
+	if resp.Error != "" {
+		resp.Success = false
+	}
+	return resp
+}
+
+// restoreFiles writes a workspace's previous code and variables back,
+// replacing the variables a fan-out apply set.
+func (s *Service) restoreFiles(ctx context.Context, contextName, workspace string, previous workspaceSnapshot) error {
+	if err := s.prepareWorkspace(ctx, contextName, workspace, previous.Code, nil); err != nil {
+		return err
+	}
+	if err := s.setVariables(ctx, contextName, workspace, previous.Variables); err != nil {
+		return fmt.Errorf("set variables failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	fanOutOldCode = `resource "digitalocean_droplet" "old" {}`
+	fanOutNewCode = "resource \"digitalocean_droplet\" \"web\" {\n  name = \"web\"\n}"
+)
+
+func TestFanOutApply(t *testing.T) {
+	oldVariables := map[string]string{"size": "s-1vcpu-1gb"}
+	newVariables := map[string]string{"size": "s-2vcpu-2gb"}
+	tests := []struct {
+		name         string
+		autoRollback bool
+		setup        func(e *fakeExecutor, s *Service) // Workspace "a" is seeded with old code and variables
+		wantErr      bool
+		wantTx       string
+		wantApply    []string
+		wantDestroy  []string
+		wantCode     map[string]string // Code of each workspace afterwards
+		wantVars     map[string]map[string]string
+		rolledBack   []string
+	}{
+		{
+			name:         "committed",
+			autoRollback: true,
+			wantTx:       TransactionCommitted,
+			wantApply:    []string{"ctx/a", "ctx/b", "ctx/c"},
+			wantCode:     map[string]string{"a": fanOutNewCode, "b": fanOutNewCode, "c": fanOutNewCode},
+			wantVars:     map[string]map[string]string{"a": newVariables, "b": newVariables},
+		},
+		{
+			name:         "rolled back",
+			autoRollback: true,
+			setup:        func(e *fakeExecutor, s *Service) { e.failApply["c"] = true },
+			wantTx:       TransactionRolledBack,
+			// a and b are applied, then a gets its old code re-applied
+			wantApply:   []string{"ctx/a", "ctx/a", "ctx/b", "ctx/c"},
+			wantDestroy: []string{"ctx/b", "ctx/c"},
+			wantCode:    map[string]string{"a": fanOutOldCode, "b": "", "c": ""},
+			wantVars:    map[string]map[string]string{"a": oldVariables, "b": nil},
+			rolledBack:  []string{"a", "b", "c"},
+		},
+		{
+			name:         "auto-rollback off",
+			autoRollback: false,
+			setup:        func(e *fakeExecutor, s *Service) { e.failApply["c"] = true },
+			wantTx:       TransactionFailed,
+			wantApply:    []string{"ctx/a", "ctx/b", "ctx/c"},
+			wantCode:     map[string]string{"a": fanOutNewCode, "b": fanOutNewCode},
+		},
+		{
+			name:         "workspace never reached apply",
+			autoRollback: true,
+			setup: func(e *fakeExecutor, s *Service) {
+				e.failApply["c"] = true
+				e.errs["AppendCode b"] = status.Error(codes.Unavailable, "connection reset")
+			},
+			wantTx: TransactionRolledBack,
+			// b's files are restored, but it's neither applied nor destroyed
+			wantApply:   []string{"ctx/a", "ctx/a", "ctx/c"},
+			wantDestroy: []string{"ctx/c"},
+			wantCode:    map[string]string{"a": fanOutOldCode, "b": "", "c": ""},
+			wantVars:    map[string]map[string]string{"a": oldVariables},
+			rolledBack:  []string{"a", "c"},
+		},
+		{
+			name:         "workspace locked",
+			autoRollback: true,
+			setup: func(e *fakeExecutor, s *Service) {
+				e.failApply["c"] = true
+				s.workspaceLocks = newWorkspaceLocks(10 * time.Millisecond)
+				s.workspaceLocks.lock(context.Background(), "ctx", "b") // Never released
+			},
+			wantTx:      TransactionRolledBack,
+			wantApply:   []string{"ctx/a", "ctx/a", "ctx/c"},
+			wantDestroy: []string{"ctx/c"},
+			wantCode:    map[string]string{"a": fanOutOldCode, "c": ""},
+			rolledBack:  []string{"a", "c"},
+		},
+		{
+			name:         "previous code unreadable",
+			autoRollback: true,
+			setup: func(e *fakeExecutor, s *Service) {
+				e.errs["GetMainTf b"] = status.Error(codes.Unavailable, "connection refused")
+			},
+			wantErr:  true,
+			wantCode: map[string]string{"a": fanOutOldCode},
+		},
+		{
+			name:         "previous variables unreadable",
+			autoRollback: true,
+			setup: func(e *fakeExecutor, s *Service) {
+				e.errs["GetVariables a"] = status.Error(codes.Internal, "permission denied")
+			},
+			wantErr:  true,
+			wantCode: map[string]string{"a": fanOutOldCode},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newFakeExecutor()
+			executor.seed("ctx", "a", fanOutOldCode, oldVariables)
+			s := newTestService(nil)
+			s.generator = &fakeGenerator{replies: []string{fanOutNewCode}}
+			s.executorClient = executor
+			if tt.setup != nil {
+				tt.setup(executor, s)
+			}
+
+			req := TerraformRequest{
+				Description: "a droplet",
+				Context:     "ctx",
+				Action:      ActionApply,
+				Workspaces:  []string{"a", "b", "c"},
+				Variables:   newVariables,
+			}
+			req.features.AutoRollback = tt.autoRollback
+			response, err := s.processFanOutApply(context.Background(), req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("processFanOutApply() = %+v, want an error", response)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if response.Transaction != tt.wantTx {
+					t.Errorf("Transaction = %q, want %q\n%s", response.Transaction, tt.wantTx, response.Output)
+				}
+				if success := tt.wantTx == TransactionCommitted; response.Success != success {
+					t.Errorf("Success = %v, want %v", response.Success, success)
+				}
+				var rolledBack []string
+				for _, workspace := range req.Workspaces {
+					if response.Workspaces[workspace].RolledBack {
+						rolledBack = append(rolledBack, workspace)
+					}
+				}
+				if !reflect.DeepEqual(rolledBack, tt.rolledBack) {
+					t.Errorf("rolled back %v, want %v", rolledBack, tt.rolledBack)
+				}
+			}
+
+			if got := executor.called("Apply"); !reflect.DeepEqual(got, tt.wantApply) {
+				t.Errorf("applied %v, want %v", got, tt.wantApply)
+			}
+			if got := executor.called("Destroy"); !reflect.DeepEqual(got, tt.wantDestroy) {
+				t.Errorf("destroyed %v, want %v", got, tt.wantDestroy)
+			}
+			for workspace, want := range tt.wantCode {
+				ws := executor.workspace("ctx", workspace)
+				if ws == nil {
+					t.Errorf("workspace %s doesn't exist", workspace)
+					continue
+				}
+				if strings.TrimSpace(ws.code) != want {
+					t.Errorf("workspace %s code = %q, want %q", workspace, ws.code, want)
+				}
+			}
+			for workspace, want := range tt.wantVars {
+				if got := executor.workspace("ctx", workspace).variables; (len(got) > 0 || len(want) > 0) && !reflect.DeepEqual(got, want) {
+					t.Errorf("workspace %s variables = %v, want %v", workspace, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFanOutProtectedResources(t *testing.T) {
+	const replacesDatabase = `{"resource_changes":[{"address":"digitalocean_database_cluster.db","type":"digitalocean_database_cluster","change":{"actions":["delete","create"]}}]}`
+	tests := []struct {
+		name          string
+		policyChecks  bool
+		force         bool
+		wantBlocked   bool
+		wantPlanFiles map[string]string // Plan file each workspace's apply used
+	}{
+		{
+			name:          "blocked",
+			policyChecks:  true,
+			wantBlocked:   true,
+			wantPlanFiles: map[string]string{"a": "ctx/a/tfplan"},
+		},
+		{
+			name:          "blocked without policy checks",
+			policyChecks:  false,
+			wantBlocked:   true,
+			wantPlanFiles: map[string]string{"a": "ctx/a/tfplan"},
+		},
+		{
+			name:          "forced",
+			policyChecks:  true,
+			force:         true,
+			wantPlanFiles: map[string]string{"a": "", "b": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newFakeExecutor()
+			executor.planJSON["b"] = replacesDatabase
+			s := newTestService(&Config{ProtectedResourceTypes: []string{"digitalocean_database_*"}})
+			s.generator = &fakeGenerator{replies: []string{fanOutNewCode}}
+			s.executorClient = executor
+
+			req := TerraformRequest{Description: "a database", Context: "ctx", Action: ActionApply, Workspaces: []string{"a", "b"}, Force: tt.force}
+			req.features.PolicyChecks = tt.policyChecks
+			response, err := s.processFanOutApply(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocked := response.Workspaces["b"].BlockedResources
+			if wantBlocked := []string{"digitalocean_database_cluster.db"}; tt.wantBlocked != reflect.DeepEqual(blocked, wantBlocked) {
+				t.Errorf("b blocked resources = %v, want blocked %v", blocked, tt.wantBlocked)
+			}
+			// The checked plan is the one applied
+			if !reflect.DeepEqual(executor.planFiles, tt.wantPlanFiles) {
+				t.Errorf("applied plan files = %v, want %v", executor.planFiles, tt.wantPlanFiles)
+			}
+		})
+	}
+}
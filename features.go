@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const featuresNamespace = "context_features"
+
+// FeatureFlags are the guardrails in effect for a request.
+type FeatureFlags struct {
+	PolicyChecks               bool `json:"policy_checks"`                // Protected-resource, resource-name and validation webhook checks
+	CostEstimation             bool `json:"cost_estimation"`              // Estimate the monthly cost of plans, when the cost_estimation config sets an estimator
+	AutoRollback               bool `json:"auto_rollback"`                // Roll back fan-out applies when a workspace fails
+	DestroyConfirmation        bool `json:"destroy_confirmation"`         // Destroy requests must set confirm
+	DestructiveCooldownSeconds int  `json:"destructive_cooldown_seconds"` // Minimum time between applies/destroys of a workspace; 0 disables
+}
+
+var defaultFeatureFlags = FeatureFlags{
+	PolicyChecks:   true,
+	CostEstimation: true,
+	AutoRollback:   true,
+}
+
+// FeatureOverrides changes some feature flags; unset fields keep the value
+// from the level below. They are used for the deployment-wide config and for
+// per-context settings stored in the Store.
+type FeatureOverrides struct {
+	PolicyChecks               *bool `json:"policy_checks,omitempty" yaml:"policy_checks"`
+	CostEstimation             *bool `json:"cost_estimation,omitempty" yaml:"cost_estimation"`
+	AutoRollback               *bool `json:"auto_rollback,omitempty" yaml:"auto_rollback"`
+	DestroyConfirmation        *bool `json:"destroy_confirmation,omitempty" yaml:"destroy_confirmation"`
+	DestructiveCooldownSeconds *int  `json:"destructive_cooldown_seconds,omitempty" yaml:"destructive_cooldown_seconds"`
+}
+
+func (o FeatureOverrides) apply(flags FeatureFlags) FeatureFlags {
+	if o.PolicyChecks != nil {
+		flags.PolicyChecks = *o.PolicyChecks
+	}
+	if o.CostEstimation != nil {
+		flags.CostEstimation = *o.CostEstimation
+	}
+	if o.AutoRollback != nil {
+		flags.AutoRollback = *o.AutoRollback
+	}
+	if o.DestroyConfirmation != nil {
+		flags.DestroyConfirmation = *o.DestroyConfirmation
+	}
+	if o.DestructiveCooldownSeconds != nil {
+		flags.DestructiveCooldownSeconds = *o.DestructiveCooldownSeconds
+	}
+	return flags
+}
+
+func (s *Service) contextFeatureOverrides(ctx context.Context, contextName string) (*FeatureOverrides, error) {
+	value, err := s.store.Get(ctx, featuresNamespace, contextName)
+	if errors.Is(err, ErrNotFound) {
+		return &FeatureOverrides{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides FeatureOverrides
+	if err := json.Unmarshal(value, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to decode feature overrides: %v", err)
+	}
+	return &overrides, nil
+}
+
+// resolveFeatures returns the flags for a context: built-in defaults, then
+// the deployment config, then the context's stored overrides. If the stored
+// overrides cannot be read the deployment flags are used.
+func (s *Service) resolveFeatures(ctx context.Context, contextName string) FeatureFlags {
+	flags := s.config().Features.apply(defaultFeatureFlags)
+
+	overrides, err := s.contextFeatureOverrides(ctx, contextName)
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to load feature flags", "context", contextName, "error", err)
+		return flags
+	}
+	return overrides.apply(flags)
+}
+
+// handleContextFeatures shows the effective flags of a context (GET) or
+// replaces its overrides (PUT, admin only).
+func (s *Service) handleContextFeatures(w http.ResponseWriter, r *http.Request) {
+	contextName := r.URL.Query().Get("context")
+	if contextName == "" {
+		contextName = "default"
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if !s.isAdmin(r) {
+			writeError(w, http.StatusForbidden, APIErrorForbidden, "This endpoint requires a valid X-Admin-Token", "")
+			return
+		}
+		var overrides FeatureOverrides
+		if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidBody, "Invalid request body", err.Error())
+			return
+		}
+		value, err := json.Marshal(overrides)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to encode feature flags", err.Error())
+			return
+		}
+		if err := s.store.Put(r.Context(), featuresNamespace, contextName, value, 0); err != nil {
+			writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to save feature flags", err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	overrides, err := s.contextFeatureOverrides(r.Context(), contextName)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to load feature flags", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"context":   contextName,
+		"overrides": overrides,
+		"effective": overrides.apply(s.config().Features.apply(defaultFeatureFlags)),
+	})
+}
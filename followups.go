@@ -0,0 +1,52 @@
+package main
+
+// FollowUp is a ready-to-submit request for a likely next step.
+type FollowUp struct {
+	Label   string           `json:"label"`
+	Request TerraformRequest `json:"request"`
+}
+
+// followUps returns the next steps worth offering after a successful request.
+func followUps(req TerraformRequest, response *TerraformResponse) []FollowUp {
+	if !response.Success || response.Error != "" {
+		return nil
+	}
+
+	base := TerraformRequest{
+		Context:   req.Context,
+		Workspace: req.Workspace,
+		Debug:     req.Debug,
+	}
+	apply := base
+	apply.Action = "apply"
+	apply.ReuseExistingCode = true // Apply the code now in the workspace
+	destroy := base
+	destroy.Action = "destroy"
+	destroy.Confirm = req.features.DestroyConfirmation
+
+	switch {
+	case response.ChangePreview != "":
+		confirmed := req
+		confirmed.PreviewChanges = false
+		return []FollowUp{{Label: "Confirm and proceed", Request: confirmed}}
+	case req.Action == "plan" && (response.AutoApply == nil || !response.AutoApply.Applied):
+		if response.PlanID != "" {
+			// Apply exactly the planned code
+			apply.ReuseExistingCode = false
+			apply.PlanID = response.PlanID
+		}
+		return []FollowUp{{Label: "Apply this plan", Request: apply}}
+	case req.Action == ActionImport && !response.NoChanges:
+		return []FollowUp{{Label: "Apply to reconcile the imported resource with the code", Request: apply}}
+	case req.Action == ActionRefresh && len(response.Drift) > 0:
+		return []FollowUp{{Label: "Apply to revert the drift", Request: apply}}
+	case req.Action == "apply" || response.AutoApply != nil && response.AutoApply.Applied:
+		replan := base
+		replan.Action = "plan"
+		return []FollowUp{
+			{Label: "Re-plan to check for drift", Request: replan},
+			{Label: "Destroy these resources", Request: destroy},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runGenerate implements the "generate" subcommand: it generates Terraform
+// code for a description and prints it to stdout, without starting the
+// server or contacting an executor. The description is taken from the
+// arguments, from -file, or from stdin. Logs go to stderr.
+func runGenerate(config *Config, args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	file := flags.String("file", "", "read the description from this file")
+	model := flags.String("model", config.DefaultModel, "model to generate with")
+	provider := flags.String("provider", "", "cloud provider whose conventions to follow: "+strings.Join(knownCloudProviders(), ", "))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := validateCloudProvider(*provider); err != nil {
+		return err
+	}
+	if _, ok := config.ModelPricing[*model]; !ok {
+		return fmt.Errorf("unknown model %q", *model)
+	}
+
+	var description string
+	switch {
+	case *file != "":
+		content, err := os.ReadFile(*file)
+		if err != nil {
+			return fmt.Errorf("failed to read description file: %v", err)
+		}
+		description = string(content)
+	case flags.NArg() > 0 && flags.Arg(0) != "-":
+		description = strings.Join(flags.Args(), " ")
+	default:
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read description from stdin: %v", err)
+		}
+		description = string(content)
+	}
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return fmt.Errorf("description is empty")
+	}
+
+	store, err := NewStore(config.Store)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %v", err)
+	}
+	generator, err := newCodeGenerator(*config)
+	if err != nil {
+		return err
+	}
+	s := &Service{
+		generator:     generator,
+		currentConfig: config,
+		store:         store,
+		llmLimiter:    newLLMLimiter(config.MaxConcurrentLLMCalls, nil),
+	}
+
+	gen, err := s.generateTerraformCode(context.Background(), *model, *provider, description, nil, "")
+	if err != nil {
+		return err
+	}
+	fmt.Println(gen.Code)
+	return nil
+}
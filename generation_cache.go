@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const generationCacheNamespace = "generation_cache"
+
+func generationCacheKey(model, prompt string) string {
+	sum := sha256.Sum256([]byte(model + "\n" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedGeneration returns a previous generation for the same model and
+// prompt, or nil when caching is disabled, bypassed or there is none.
+func (s *Service) cachedGeneration(ctx context.Context, key string) *generation {
+	if s.config().GenerationCacheTTLSeconds <= 0 || cacheBypassed(ctx) {
+		return nil
+	}
+
+	value, err := s.store.Get(ctx, generationCacheNamespace, key)
+	if err != nil {
+		s.metrics.observeGenerationCacheMiss()
+		return nil
+	}
+
+	var gen generation
+	if err := json.Unmarshal(value, &gen); err != nil {
+		s.runLogger(ctx).Warn("failed to decode cached generation", "error", err)
+		return nil
+	}
+	gen.FromCache = true
+
+	s.metrics.observeGenerationCacheHit(gen.InputTokens, gen.OutputTokens, s.config().ModelPricing[gen.Model].cost(gen.InputTokens, gen.OutputTokens))
+	s.runLogger(ctx).Info("generation cache hit", "saved_input_tokens", gen.InputTokens, "saved_output_tokens", gen.OutputTokens)
+
+	return &gen
+}
+
+func (s *Service) cacheGeneration(ctx context.Context, key string, gen *generation) {
+	if s.config().GenerationCacheTTLSeconds <= 0 {
+		return
+	}
+
+	value, err := json.Marshal(gen)
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to encode generation for cache", "error", err)
+		return
+	}
+	ttl := time.Duration(s.config().GenerationCacheTTLSeconds) * time.Second
+	if err := s.store.Put(ctx, generationCacheNamespace, key, value, ttl); err != nil {
+		s.runLogger(ctx).Warn("failed to cache generation", "error", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+const testCode = "```hcl\nresource \"digitalocean_droplet\" \"web\" {\n  name = \"web\"\n}\n```"
+
+func TestGenerationCache(t *testing.T) {
+	tfError := &TerraformError{Message: "Unsupported argument"}
+	tests := []struct {
+		name          string
+		ttl           int
+		existingCode  string
+		previousError *TerraformError
+		wantCalls     int // Generator calls for two identical generations
+	}{
+		{name: "initial prompt", ttl: 60, wantCalls: 1},
+		{name: "modification prompt", ttl: 60, existingCode: "resource \"a\" \"b\" {}", wantCalls: 1},
+		{name: "error fix", ttl: 60, existingCode: "resource \"a\" \"b\" {}", previousError: tfError, wantCalls: 2},
+		{name: "cache disabled", ttl: 0, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := &fakeGenerator{replies: []string{testCode, testCode}}
+			s := newTestService(&Config{GenerationCacheTTLSeconds: tt.ttl})
+			s.generator = generator
+
+			var gens []*generation
+			for range 2 {
+				gen, err := s.generateTerraformCode(context.Background(), "test-model", "digitalocean", "a droplet", tt.previousError, tt.existingCode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gens = append(gens, gen)
+			}
+			if calls := generator.calls(); calls != tt.wantCalls {
+				t.Errorf("generator called %d times, want %d", calls, tt.wantCalls)
+			}
+			if cached := tt.wantCalls == 1; gens[1].FromCache != cached {
+				t.Errorf("second generation FromCache = %v, want %v", gens[1].FromCache, cached)
+			}
+			if gens[0].Code != gens[1].Code {
+				t.Errorf("generations differ: %q and %q", gens[0].Code, gens[1].Code)
+			}
+		})
+	}
+}
+
+func TestGenerationCacheKey(t *testing.T) {
+	tests := []struct {
+		name            string
+		model1, prompt1 string
+		model2, prompt2 string
+		same            bool
+	}{
+		{name: "same", model1: "m", prompt1: "p", model2: "m", prompt2: "p", same: true},
+		{name: "other model", model1: "m", prompt1: "p", model2: "n", prompt2: "p"},
+		{name: "other prompt", model1: "m", prompt1: "p", model2: "m", prompt2: "q"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same := generationCacheKey(tt.model1, tt.prompt1) == generationCacheKey(tt.model2, tt.prompt2)
+			if same != tt.same {
+				t.Errorf("keys equal = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ResourceGraph is the dependency graph from `terraform graph`, parsed from
+// its DOT output for clients that don't read DOT.
+type ResourceGraph struct {
+	Nodes      []GraphNode `json:"nodes"`
+	Edges      []GraphEdge `json:"edges"`
+	Truncated  bool        `json:"truncated,omitempty"` // Nodes beyond max_graph_nodes, and their edges, were left out
+	TotalNodes int         `json:"total_nodes"`         // Nodes in the full graph
+}
+
+type GraphNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// GraphEdge points from a node to a node it depends on.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+var (
+	dotEdge  = regexp.MustCompile(`^\s*"((?:[^"\\]|\\.)+)"\s*->\s*"((?:[^"\\]|\\.)+)"`)
+	dotNode  = regexp.MustCompile(`^\s*"((?:[^"\\]|\\.)+)"\s*\[(.*)\]`)
+	dotLabel = regexp.MustCompile(`label\s*=\s*"((?:[^"\\]|\\.)*)"`)
+)
+
+// graphNodeID unescapes a DOT node name and strips the "[root] " prefix and
+// the " (expand)" or " (close)" suffix older Terraform versions add to it.
+func graphNodeID(name string) string {
+	name = strings.ReplaceAll(name, `\"`, `"`)
+	name = strings.TrimPrefix(name, "[root] ")
+	if i := strings.LastIndex(name, " ("); i > 0 && strings.HasSuffix(name, ")") {
+		name = name[:i]
+	}
+	return name
+}
+
+// parseGraph parses the DOT output of `terraform graph`. Nodes are kept in the
+// order they first appear; past maxNodes the rest, and any edges touching
+// them, are dropped and the graph is marked truncated. maxNodes <= 0 keeps
+// all nodes.
+func parseGraph(dot string, maxNodes int) *ResourceGraph {
+	graph := &ResourceGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	labels := make(map[string]string)
+	var order []string
+	addNode := func(id string) {
+		if _, ok := labels[id]; !ok {
+			labels[id] = id
+			order = append(order, id)
+		}
+	}
+
+	var edges []GraphEdge
+	seenEdges := make(map[GraphEdge]bool)
+	for _, line := range strings.Split(dot, "\n") {
+		if m := dotEdge.FindStringSubmatch(line); m != nil {
+			edge := GraphEdge{From: graphNodeID(m[1]), To: graphNodeID(m[2])}
+			if edge.From == edge.To || seenEdges[edge] {
+				continue
+			}
+			seenEdges[edge] = true
+			addNode(edge.From)
+			addNode(edge.To)
+			edges = append(edges, edge)
+			continue
+		}
+		if m := dotNode.FindStringSubmatch(line); m != nil {
+			id := graphNodeID(m[1])
+			addNode(id)
+			if label := dotLabel.FindStringSubmatch(m[2]); label != nil && label[1] != "" {
+				labels[id] = strings.ReplaceAll(label[1], `\"`, `"`)
+			}
+		}
+	}
+
+	graph.TotalNodes = len(order)
+	kept := make(map[string]bool, len(order))
+	for _, id := range order {
+		if maxNodes > 0 && len(graph.Nodes) >= maxNodes {
+			graph.Truncated = true
+			break
+		}
+		kept[id] = true
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: id, Label: labels[id]})
+	}
+	for _, edge := range edges {
+		if kept[edge.From] && kept[edge.To] {
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+	return graph
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// executorCredentials returns the transport credentials for dialing
+// executors. TLS is required unless grpc_insecure is set; grpc_tls_ca pins
+// the CA that signed the executors' certificates, and grpc_tls_cert and
+// grpc_tls_key present a client certificate for mTLS.
+func executorCredentials(config Config) (grpc.DialOption, error) {
+	if config.GRPCInsecure {
+		if config.GRPCTLSCA != "" || config.GRPCTLSCert != "" || config.GRPCTLSKey != "" {
+			return nil, fmt.Errorf("grpc_insecure cannot be combined with grpc_tls_ca, grpc_tls_cert or grpc_tls_key")
+		}
+		slog.Warn("dialing executors without TLS; executor traffic, including code and state, is unencrypted")
+		return grpc.WithTransportCredentials(insecure.NewCredentials()), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.GRPCTLSCA != "" {
+		pem, err := os.ReadFile(config.GRPCTLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read grpc_tls_ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("grpc_tls_ca %s contains no PEM certificates", config.GRPCTLSCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (config.GRPCTLSCert == "") != (config.GRPCTLSKey == "") {
+		return nil, fmt.Errorf("grpc_tls_cert and grpc_tls_key must be set together")
+	}
+	if config.GRPCTLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.GRPCTLSCert, config.GRPCTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load grpc_tls_cert and grpc_tls_key: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
+}
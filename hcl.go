@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// parseHCL parses generated terraform code.
+func parseHCL(code string) (*hclsyntax.Body, error) {
+	file, diags := hclsyntax.ParseConfig([]byte(code), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return file.Body.(*hclsyntax.Body), nil
+}
+
+type resourceName struct {
+	Address string
+	Name    string
+}
+
+// resourceNames returns the literal `name` attributes of all resource blocks.
+// Names built from references or functions can't be checked statically and
+// are skipped.
+func resourceNames(body *hclsyntax.Body) []resourceName {
+	var names []resourceName
+	for _, block := range body.Blocks {
+		if block.Type != "resource" || len(block.Labels) != 2 {
+			continue
+		}
+		attr, ok := block.Body.Attributes["name"]
+		if !ok {
+			continue
+		}
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || !value.IsKnown() || value.IsNull() || !value.Type().Equals(cty.String) {
+			continue
+		}
+		names = append(names, resourceName{
+			Address: block.Labels[0] + "." + block.Labels[1],
+			Name:    value.AsString(),
+		})
+	}
+	return names
+}
+
+// resourceNameViolations returns the resources whose name doesn't match pattern.
+func resourceNameViolations(body *hclsyntax.Body, pattern *regexp.Regexp) []string {
+	var violations []string
+	for _, n := range resourceNames(body) {
+		if !pattern.MatchString(n.Name) {
+			violations = append(violations, fmt.Sprintf("%s: %q", n.Address, n.Name))
+		}
+	}
+	return violations
+}
+
+// disallowedResourceTypes returns the resource types in body that match none
+// of the allowed patterns (globs), sorted and without duplicates.
+func disallowedResourceTypes(body *hclsyntax.Body, allowed []string) []string {
+	seen := make(map[string]bool)
+	var disallowed []string
+	for _, block := range body.Blocks {
+		if block.Type != "resource" || len(block.Labels) != 2 || seen[block.Labels[0]] {
+			continue
+		}
+		resourceType := block.Labels[0]
+		seen[resourceType] = true
+		if !slices.ContainsFunc(allowed, func(pattern string) bool {
+			ok, _ := path.Match(pattern, resourceType)
+			return ok
+		}) {
+			disallowed = append(disallowed, resourceType)
+		}
+	}
+	sort.Strings(disallowed)
+	return disallowed
+}
+
+// outputNames returns the names of the output blocks declared in code, in
+// declaration order, or nil if the code does not parse.
+func outputNames(code string) []string {
+	body, err := parseHCL(code)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, block := range body.Blocks {
+		if block.Type == "output" && len(block.Labels) == 1 {
+			names = append(names, block.Labels[0])
+		}
+	}
+	return names
+}
+
+// variableReferences returns the sorted names of the variables referenced as
+// var.<name> in code, less those the code declares itself.
+func variableReferences(body *hclsyntax.Body) []string {
+	referenced := make(map[string]bool)
+	declared := make(map[string]bool)
+
+	var walk func(body *hclsyntax.Body)
+	walk = func(body *hclsyntax.Body) {
+		for _, attr := range body.Attributes {
+			for _, traversal := range attr.Expr.Variables() {
+				if traversal.RootName() != "var" || len(traversal) < 2 {
+					continue
+				}
+				if step, ok := traversal[1].(hcl.TraverseAttr); ok {
+					referenced[step.Name] = true
+				}
+			}
+		}
+		for _, block := range body.Blocks {
+			if block.Type == "variable" && len(block.Labels) == 1 {
+				declared[block.Labels[0]] = true
+			}
+			walk(block.Body)
+		}
+	}
+	walk(body)
+
+	var names []string
+	for name := range referenced {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resourceBlocks returns the source text of every resource block in code,
+// keyed by resource address.
+func resourceBlocks(code string) (map[string]string, error) {
+	body, err := parseHCL(code)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make(map[string]string)
+	for _, block := range body.Blocks {
+		if block.Type != "resource" || len(block.Labels) != 2 {
+			continue
+		}
+		r := block.Range()
+		blocks[block.Labels[0]+"."+block.Labels[1]] = code[r.Start.Byte:r.End.Byte]
+	}
+	return blocks, nil
+}
+
+// canonicalHCL re-emits code with top-level blocks sorted by type and labels
+// (for resources, by address) and attributes sorted by name, so equivalent
+// code generated in a different order formats identically. Nested blocks keep
+// their relative order within a type, since it can be significant. Comments
+// are dropped.
+func canonicalHCL(code string) (string, error) {
+	file, diags := hclwrite.ParseConfig([]byte(code), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	blocks := file.Body().Blocks()
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blockSortKey(blocks[i]) < blockSortKey(blocks[j])
+	})
+
+	out := hclwrite.NewEmptyFile()
+	writeCanonicalAttributes(out.Body(), file.Body())
+	for i, block := range blocks {
+		if i > 0 || len(file.Body().Attributes()) > 0 {
+			out.Body().AppendNewline()
+		}
+		writeCanonicalBlock(out.Body(), block)
+	}
+	return string(hclwrite.Format(out.Bytes())), nil
+}
+
+// setCanonicalCode fills response.CanonicalCode from response.Code. Code that
+// does not parse is left without a canonical form.
+func setCanonicalCode(response *TerraformResponse) {
+	if response.Code == "" {
+		return
+	}
+	canonical, err := canonicalHCL(response.Code)
+	if err != nil {
+		slog.Warn("failed to canonicalize code", "error", err)
+		return
+	}
+	response.CanonicalCode = canonical
+}
+
+func blockSortKey(block *hclwrite.Block) string {
+	return block.Type() + "\x00" + strings.Join(block.Labels(), "\x00")
+}
+
+func writeCanonicalAttributes(dst, src *hclwrite.Body) {
+	attrs := src.Attributes()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dst.SetAttributeRaw(name, attrs[name].Expr().BuildTokens(nil))
+	}
+}
+
+func writeCanonicalBlock(dst *hclwrite.Body, block *hclwrite.Block) {
+	copied := dst.AppendNewBlock(block.Type(), block.Labels())
+	writeCanonicalAttributes(copied.Body(), block.Body())
+
+	nested := block.Body().Blocks()
+	sort.SliceStable(nested, func(i, j int) bool { return nested[i].Type() < nested[j].Type() })
+	for _, child := range nested {
+		writeCanonicalBlock(copied.Body(), child)
+	}
+}
+
+// mergeDuplicateResources folds resource and data blocks that repeat an
+// address into the first block with that address. A duplicate can be merged
+// when every attribute and nested block type it shares with the first block
+// has the same content; anything else is a conflict, returned as an error so
+// the code can be regenerated. It returns the rewritten code and the merged
+// addresses. Code that does not parse is returned unchanged.
+func mergeDuplicateResources(code string) (string, []string, error) {
+	file, diags := hclwrite.ParseConfig([]byte(code), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return code, nil, nil
+	}
+
+	body := file.Body()
+	first := make(map[string]*hclwrite.Block)
+	var merged, conflicts []string
+	for _, block := range body.Blocks() {
+		if (block.Type() != "resource" && block.Type() != "data") || len(block.Labels()) != 2 {
+			continue
+		}
+		address := strings.Join(block.Labels(), ".")
+		if block.Type() == "data" {
+			address = "data." + address
+		}
+
+		original, ok := first[address]
+		if !ok {
+			first[address] = block
+			continue
+		}
+		if err := mergeConflict(original, block); err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%v)", address, err))
+			continue
+		}
+		mergeBlockInto(original, block)
+		body.RemoveBlock(block)
+		merged = append(merged, address)
+	}
+
+	if len(conflicts) > 0 {
+		return code, nil, fmt.Errorf("duplicate blocks with conflicting contents: %s", strings.Join(conflicts, "; "))
+	}
+	if len(merged) == 0 {
+		return code, nil, nil
+	}
+	return strings.TrimSpace(string(hclwrite.Format(file.Bytes()))), merged, nil
+}
+
+// forbiddenBlockTypes are the top-level blocks the prompts tell the model not
+// to generate: the workspace provides providers, backend and variables.
+var forbiddenBlockTypes = map[string]bool{
+	"provider":  true,
+	"terraform": true,
+	"variable":  true,
+	"locals":    true,
+}
+
+// sanitizeGeneratedCode removes forbidden top-level blocks from code and
+// returns the cleaned code and the removed blocks, e.g. `provider "aws"`.
+// Code that does not parse is returned unchanged.
+func sanitizeGeneratedCode(code string) (string, []string) {
+	file, diags := hclwrite.ParseConfig([]byte(code), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return code, nil
+	}
+
+	body := file.Body()
+	var removed []string
+	for _, block := range body.Blocks() {
+		if !forbiddenBlockTypes[block.Type()] {
+			continue
+		}
+		section := block.Type()
+		for _, label := range block.Labels() {
+			section += fmt.Sprintf(" %q", label)
+		}
+		body.RemoveBlock(block)
+		removed = append(removed, section)
+	}
+	if len(removed) == 0 {
+		return code, nil
+	}
+	return strings.TrimSpace(string(hclwrite.Format(file.Bytes()))), removed
+}
+
+// normalizedTokens renders tokens with whitespace collapsed, for comparing
+// content regardless of formatting.
+func normalizedTokens(tokens hclwrite.Tokens) string {
+	return strings.Join(strings.Fields(string(tokens.Bytes())), " ")
+}
+
+func nestedBlocksByType(body *hclwrite.Body) map[string]string {
+	byType := make(map[string]string)
+	for _, block := range body.Blocks() {
+		byType[block.Type()] += normalizedTokens(block.BuildTokens(nil)) + "\n"
+	}
+	return byType
+}
+
+func mergeConflict(dst, src *hclwrite.Block) error {
+	dstAttrs := dst.Body().Attributes()
+	for name, attr := range src.Body().Attributes() {
+		existing, ok := dstAttrs[name]
+		if ok && normalizedTokens(existing.Expr().BuildTokens(nil)) != normalizedTokens(attr.Expr().BuildTokens(nil)) {
+			return fmt.Errorf("attribute %s differs", name)
+		}
+	}
+
+	dstBlocks := nestedBlocksByType(dst.Body())
+	for blockType, content := range nestedBlocksByType(src.Body()) {
+		if existing, ok := dstBlocks[blockType]; ok && existing != content {
+			return fmt.Errorf("%s blocks differ", blockType)
+		}
+	}
+	return nil
+}
+
+// mergeBlockInto copies the attributes and nested block types of src that dst
+// lacks. mergeConflict must have accepted the pair.
+func mergeBlockInto(dst, src *hclwrite.Block) {
+	dstAttrs, srcAttrs := dst.Body().Attributes(), src.Body().Attributes()
+	names := make([]string, 0, len(srcAttrs))
+	for name := range srcAttrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := dstAttrs[name]; !ok {
+			dst.Body().SetAttributeRaw(name, srcAttrs[name].Expr().BuildTokens(nil))
+		}
+	}
+
+	dstBlocks := nestedBlocksByType(dst.Body())
+	for _, block := range src.Body().Blocks() {
+		if _, ok := dstBlocks[block.Type()]; !ok {
+			dst.Body().AppendBlock(block)
+		}
+	}
+}
+
+// hclFenceTags are the code fence language tags taken as Terraform code.
+// Untagged fences are taken too when their content looks like HCL.
+var hclFenceTags = map[string]bool{"hcl": true, "terraform": true, "tf": true}
+
+var hclBlockStart = regexp.MustCompile(`(?m)^\s*(resource|data|output|module|locals|variable|terraform|provider)\s*["{]`)
+
+// extractCode returns the Terraform code in a model reply. Replies with code
+// fences yield their HCL blocks joined, dropping prose and other languages;
+// an unterminated last fence runs to the end of the reply. Replies without
+// fences are returned as is.
+func extractCode(reply string) string {
+	var blocks, lines []string
+	var tag string
+	inFence, fenced := false, false
+	closeFence := func() {
+		code := strings.TrimSpace(strings.Join(lines, "\n"))
+		if hclFenceTags[tag] || tag == "" && hclBlockStart.MatchString(code) {
+			blocks = append(blocks, code)
+		}
+	}
+	for _, line := range strings.Split(reply, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !strings.HasPrefix(trimmed, "```"):
+			if inFence {
+				lines = append(lines, line)
+			}
+		case inFence:
+			closeFence()
+			inFence = false
+		default:
+			tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(trimmed, "```")))
+			inFence, fenced, lines = true, true, nil
+		}
+	}
+	if inFence {
+		closeFence()
+	}
+	if !fenced {
+		return strings.TrimSpace(reply)
+	}
+	return strings.Join(blocks, "\n\n")
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeDuplicateResources(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		want       string // Code after merging; the input when empty
+		wantMerged []string
+		wantErr    bool
+	}{
+		{
+			name: "no duplicates",
+			code: `resource "aws_instance" "web" {
+  ami = "ami-1"
+}
+
+resource "aws_instance" "db" {
+  ami = "ami-1"
+}`,
+		},
+		{
+			name: "identical duplicate",
+			code: `resource "aws_instance" "web" {
+  ami = "ami-1"
+}
+
+resource "aws_instance" "web" {
+  ami   =   "ami-1"
+}`,
+			want: `resource "aws_instance" "web" {
+  ami = "ami-1"
+}`,
+			wantMerged: []string{"aws_instance.web"},
+		},
+		{
+			name: "complementary attributes and blocks",
+			code: `resource "aws_instance" "web" {
+  ami = "ami-1"
+}
+
+resource "aws_instance" "web" {
+  instance_type = "t3.micro"
+  tags = {
+    Name = "web"
+  }
+  root_block_device {
+    volume_size = 20
+  }
+}`,
+			want: `resource "aws_instance" "web" {
+  ami           = "ami-1"
+  instance_type = "t3.micro"
+  tags = {
+    Name = "web"
+  }
+  root_block_device {
+    volume_size = 20
+  }
+}`,
+			wantMerged: []string{"aws_instance.web"},
+		},
+		{
+			name: "data source",
+			code: `data "aws_ami" "ubuntu" {
+  most_recent = true
+}
+
+data "aws_ami" "ubuntu" {
+  owners = ["099720109477"]
+}`,
+			want: `data "aws_ami" "ubuntu" {
+  most_recent = true
+  owners      = ["099720109477"]
+}`,
+			wantMerged: []string{"data.aws_ami.ubuntu"},
+		},
+		{
+			name: "resource and data source with the same labels",
+			code: `resource "aws_ami" "ubuntu" {
+  name = "a"
+}
+
+data "aws_ami" "ubuntu" {
+  name = "b"
+}`,
+		},
+		{
+			name: "conflicting attribute",
+			code: `resource "aws_instance" "web" {
+  ami = "ami-1"
+}
+
+resource "aws_instance" "web" {
+  ami = "ami-2"
+}`,
+			wantErr: true,
+		},
+		{
+			name: "conflicting nested block",
+			code: `resource "aws_instance" "web" {
+  root_block_device {
+    volume_size = 20
+  }
+}
+
+resource "aws_instance" "web" {
+  root_block_device {
+    volume_size = 40
+  }
+}`,
+			wantErr: true,
+		},
+		{
+			name: "does not parse",
+			code: `resource "aws_instance" "web" {`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, merged, err := mergeDuplicateResources(tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeDuplicateResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.code
+			}
+			if got != want {
+				t.Errorf("mergeDuplicateResources() code =\n%s\nwant\n%s", got, want)
+			}
+			if !reflect.DeepEqual(merged, tt.wantMerged) {
+				t.Errorf("merged = %v, want %v", merged, tt.wantMerged)
+			}
+		})
+	}
+}
+
+func TestOutputNames(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{"none", `resource "digitalocean_droplet" "web" {}`, nil},
+		{
+			name: "declaration order",
+			code: `output "ip" {
+  value = digitalocean_droplet.web.ipv4_address
+}
+
+resource "digitalocean_droplet" "web" {}
+
+output "id" {
+  value = digitalocean_droplet.web.id
+}
+`,
+			want: []string{"ip", "id"},
+		},
+		{"nested blocks ignored", `module "db" {
+  output "inner" {}
+}
+`, nil},
+		{"unparseable", `output "ip" {`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outputNames(tt.code); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outputNames() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeGeneratedCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        string
+		want        string // The input when empty
+		wantRemoved []string
+	}{
+		{"clean", `resource "aws_instance" "web" {}`, "", nil},
+		{
+			name: "forbidden blocks",
+			code: `terraform {
+  required_version = ">= 1.5"
+}
+
+variable "size" {}
+
+locals {
+  name = "web"
+}
+
+resource "aws_instance" "web" {}
+
+provider "aws" {
+  region = "us-east-1"
+}
+`,
+			want:        `resource "aws_instance" "web" {}`,
+			wantRemoved: []string{"terraform", `variable "size"`, "locals", `provider "aws"`},
+		},
+		{"nested blocks kept", "resource \"aws_instance\" \"web\" {\n  lifecycle {\n    create_before_destroy = true\n  }\n}", "", nil},
+		{"unparseable", `variable "size" {`, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want == "" {
+				want = tt.code
+			}
+			got, removed := sanitizeGeneratedCode(tt.code)
+			if got != want {
+				t.Errorf("sanitizeGeneratedCode() code = %q, want %q", got, want)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("sanitizeGeneratedCode() removed = %q, want %q", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestExtractCode(t *testing.T) {
+	const droplet = `resource "digitalocean_droplet" "web" {}`
+	const output = `output "ip" {
+  value = digitalocean_droplet.web.ipv4_address
+}`
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{"no fences", "\n" + droplet + "\n", droplet},
+		{"hcl fence", "```hcl\n" + droplet + "\n```", droplet},
+		{"terraform and tf tags", "```terraform\n" + droplet + "\n```\n```tf\n" + output + "\n```", droplet + "\n\n" + output},
+		{"tag case ignored", "```HCL\n" + droplet + "\n```", droplet},
+		{"prose around fences dropped", "Here is the code:\n```hcl\n" + droplet + "\n```\nIt creates a droplet.", droplet},
+		{"several fences joined", "```hcl\n" + droplet + "\n```\nAnd the output:\n```hcl\n" + output + "\n```", droplet + "\n\n" + output},
+		{"other languages dropped", "```bash\nterraform apply\n```\n```hcl\n" + droplet + "\n```", droplet},
+		{"untagged fence with hcl kept", "```\n" + droplet + "\n```", droplet},
+		{"untagged fence with prose dropped", "```\nrun terraform apply\n```\n```hcl\n" + droplet + "\n```", droplet},
+		{"unterminated fence runs to the end", "```hcl\n" + droplet + "\n", droplet},
+		{"indented fences", "  ```hcl\n" + droplet + "\n  ```", droplet},
+		{"fences without hcl", "```bash\nterraform apply\n```", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractCode(tt.reply); got != tt.want {
+				t.Errorf("extractCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	pb "request-processor/api/proto"
+)
+
+// healthCheckTimeout bounds the executor calls made by /healthz, so a hung
+// executor fails the probe instead of stalling it.
+const healthCheckTimeout = 2 * time.Second
+
+type DependencyHealth struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ExecutorHealth is the outcome of probing one executor of the pool.
+type ExecutorHealth struct {
+	Address string `json:"address"`
+	State   string `json:"state"` // gRPC connection state before the probe
+	DependencyHealth
+}
+
+// handleHealthz is a readiness probe that, unlike /readyz, makes a real call
+// to every executor. The LLM is checked for credentials only, without making
+// a paid call. It returns 503 when any executor or dependency is unhealthy:
+// with sticky routing, the workspaces of an unhealthy executor are
+// unavailable.
+func (s *Service) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	executors := s.executorHealth(r.Context())
+	checks := map[string]DependencyHealth{
+		"llm": s.llmHealth(),
+	}
+	healthy := true
+	for _, check := range checks {
+		healthy = healthy && check.Healthy
+	}
+	for _, executor := range executors {
+		healthy = healthy && executor.Healthy
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"healthy":      healthy,
+		"executors":    executors,
+		"dependencies": checks,
+	})
+}
+
+// executorHealth probes every executor of the pool in parallel.
+func (s *Service) executorHealth(ctx context.Context) []ExecutorHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	statuses := s.executors.status()
+	results := make([]ExecutorHealth, len(statuses))
+	var wg sync.WaitGroup
+	for i, status := range statuses {
+		results[i] = ExecutorHealth{Address: status.Address, State: status.State}
+		conn, ok := s.executors.conn(status.Address)
+		if !ok {
+			results[i].Error = "executor was removed from the pool"
+			continue
+		}
+		wg.Add(1)
+		go func(result *ExecutorHealth) {
+			defer wg.Done()
+			resp, err := pb.NewExecutorClient(conn).Health(ctx, &pb.HealthRequest{})
+			switch {
+			case err != nil:
+				result.Error = err.Error()
+			case !resp.Serving:
+				result.Error = resp.Error
+			default:
+				result.Healthy = true
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *Service) llmHealth() DependencyHealth {
+	switch s.config().LLMProvider {
+	case ProviderAnthropic:
+		if s.config().AnthropicAPIKey == "" {
+			return DependencyHealth{Error: "anthropic_api_key is not set"}
+		}
+	case ProviderOpenAI:
+		if s.config().OpenAI.BaseURL == "" {
+			return DependencyHealth{Error: "openai.base_url is not set"}
+		}
+	}
+	return DependencyHealth{Healthy: true}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	serving := startExecutorServer(t, &executorServer{})
+	notServing := startExecutorServer(t, &executorServer{notServing: "terraform binary not found"})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name        string
+		addrs       []string
+		want        int
+		wantHealthy map[string]bool
+	}{
+		{"all serving", []string{serving}, http.StatusOK, map[string]bool{serving: true}},
+		{"one not serving", []string{serving, notServing}, http.StatusServiceUnavailable, map[string]bool{serving: true, notServing: false}},
+		{"one unreachable", []string{serving, unreachable}, http.StatusServiceUnavailable, map[string]bool{serving: true, unreachable: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&Config{LLMProvider: ProviderAnthropic, AnthropicAPIKey: "key"})
+			s.executors = newTestExecutorPool(t, tt.addrs, false)
+
+			w := httptest.NewRecorder()
+			s.handleHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var body struct {
+				Executors []ExecutorHealth `json:"executors"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Executors) != len(tt.addrs) {
+				t.Fatalf("executors = %+v, want %d", body.Executors, len(tt.addrs))
+			}
+			for _, executor := range body.Executors {
+				if executor.Healthy != tt.wantHealthy[executor.Address] || executor.Healthy != (executor.Error == "") {
+					t.Errorf("executor %s: healthy = %v, error = %q; want healthy %v", executor.Address, executor.Healthy, executor.Error, tt.wantHealthy[executor.Address])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const historyNamespace = "history"
+
+// HistoryEntry is a completed request, recorded as an audit trail and so
+// runs can be compared later.
+type HistoryEntry struct {
+	ID          string    `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Context     string    `json:"context"`
+	Workspace   string    `json:"workspace"`
+	Action      string    `json:"action"`
+	Description string    `json:"description"`
+	Code        string    `json:"code,omitempty"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+
+	Generations []GenerationInfo `json:"generations,omitempty"` // Model calls made for the run, in attempt order
+}
+
+// HistoryStore keeps the history of every workspace. Implement it to keep
+// history in a database of your own.
+type HistoryStore interface {
+	Record(ctx context.Context, entry HistoryEntry) error
+	// List returns a workspace's entries, oldest first.
+	List(ctx context.Context, contextName, workspace string) ([]HistoryEntry, error)
+}
+
+type HistoryConfig struct {
+	Dir string `yaml:"dir"` // Keep history in files under this directory; empty keeps it in the store
+}
+
+// newHistoryStore returns the history store config selects: files under
+// the configured directory, or else the shared store. History in the memory
+// store is lost on restart.
+func newHistoryStore(config HistoryConfig, storeConfig StoreConfig, store Store) (HistoryStore, error) {
+	if config.Dir != "" {
+		return newFileHistory(config.Dir)
+	}
+	if storeConfig.Driver == "" || storeConfig.Driver == "memory" {
+		slog.Warn("history is kept in memory and lost on restart; set history.dir or a persistent store driver")
+	}
+	return &storeHistory{store: store}, nil
+}
+
+// fileHistory keeps each workspace's history in a file of its own under
+// dir, one JSON entry per line, appended as runs complete.
+type fileHistory struct {
+	dir string
+	mu  sync.Mutex // Serializes writes, so entries of concurrent runs don't interleave
+}
+
+func newFileHistory(dir string) (*fileHistory, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileHistory{dir: dir}, nil
+}
+
+// historyFileName escapes a context or workspace name for use in a path.
+// Dots are escaped too, so names like ".." stay inside the directory.
+func historyFileName(name string) string {
+	return strings.ReplaceAll(url.PathEscape(name), ".", "%2E")
+}
+
+func (h *fileHistory) path(contextName, workspace string) string {
+	return filepath.Join(h.dir, historyFileName(contextName), historyFileName(workspace)+".jsonl")
+}
+
+func (h *fileHistory) Record(ctx context.Context, entry HistoryEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %v", err)
+	}
+	path := h.path(entry.Context, entry.Workspace)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(value, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (h *fileHistory) List(ctx context.Context, contextName, workspace string) ([]HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.Open(h.path(contextName, workspace))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	decoder := json.NewDecoder(f)
+	for {
+		var entry HistoryEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode history of %s/%s: %v", contextName, workspace, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// storeHistory keeps history in the shared store, so it persists when the
+// store does, as with the sqlite driver.
+type storeHistory struct {
+	store Store
+}
+
+// historyKey returns the store key of a history entry. Names are escaped so
+// that a "/" in them can't make one workspace's prefix match another's.
+func historyKey(contextName, workspace, id string) string {
+	return url.PathEscape(contextName) + "/" + url.PathEscape(workspace) + "/" + id
+}
+
+func (h *storeHistory) Record(ctx context.Context, entry HistoryEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %v", err)
+	}
+	return h.store.Put(ctx, historyNamespace, historyKey(entry.Context, entry.Workspace, entry.ID), value, 0)
+}
+
+func (h *storeHistory) List(ctx context.Context, contextName, workspace string) ([]HistoryEntry, error) {
+	items, err := h.store.List(ctx, historyNamespace, historyKey(contextName, workspace, ""))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]HistoryEntry, 0, len(items))
+	for _, item := range items {
+		var entry HistoryEntry
+		if err := json.Unmarshal(item.Value, &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode history entry %s: %v", item.Key, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// newRunID returns an ID that sorts by creation time.
+func newRunID() string {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(buf))
+}
+
+// recordRun records the outcome of a request and sets response.RunID.
+func (s *Service) recordRun(ctx context.Context, req TerraformRequest, response *TerraformResponse, generations []GenerationInfo) {
+	entry := HistoryEntry{
+		ID:          newRunID(),
+		Timestamp:   time.Now().UTC(),
+		Context:     req.Context,
+		Workspace:   req.Workspace,
+		Action:      string(req.Action),
+		Description: req.Description,
+		Code:        response.Code,
+		Success:     response.Success,
+		Error:       response.Error,
+		Generations: generations,
+	}
+	if err := s.history.Record(ctx, entry); err != nil {
+		s.runLogger(ctx).Warn("failed to record history run", "error", err)
+		return
+	}
+	response.RunID = entry.ID
+}
+
+func (s *Service) loadRun(ctx context.Context, contextName, workspace, id string) (*HistoryEntry, error) {
+	entries, err := s.history.List(ctx, contextName, workspace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].ID == id {
+			return &entries[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+type RunSummary struct {
+	ID          string    `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Action      string    `json:"action"`
+	Description string    `json:"description"`
+	Success     bool      `json:"success"`
+}
+
+type RunComparison struct {
+	From      RunSummary       `json:"from"`
+	To        RunSummary       `json:"to"`
+	CodeDiff  string           `json:"code_diff"`
+	Resources *ResourceChanges `json:"resources,omitempty"`
+}
+
+func summarizeRun(run *HistoryEntry) RunSummary {
+	return RunSummary{
+		ID:          run.ID,
+		Timestamp:   run.Timestamp,
+		Action:      run.Action,
+		Description: run.Description,
+		Success:     run.Success,
+	}
+}
+
+func (s *Service) handleHistoryCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	query := r.URL.Query()
+	contextName := query.Get("context")
+	if contextName == "" {
+		contextName = "default"
+	}
+	workspace := query.Get("workspace")
+	fromID, toID := query.Get("from"), query.Get("to")
+	if fromID == "" || toID == "" {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "from and to run IDs are required", "")
+		return
+	}
+
+	var runs [2]*HistoryEntry
+	for i, id := range []string{fromID, toID} {
+		run, err := s.loadRun(r.Context(), contextName, workspace, id)
+		if errors.Is(err, ErrNotFound) {
+			writeError(w, http.StatusNotFound, APIErrorNotFound, fmt.Sprintf("Run %s not found in %s/%s", id, contextName, workspace), "")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, APIErrorInternal, fmt.Sprintf("Failed to load run %s", id), err.Error())
+			return
+		}
+		runs[i] = run
+	}
+	from, to := runs[0], runs[1]
+
+	fromCode, toCode := from.Code, to.Code
+	if query.Get("canonical") == "true" {
+		fromCode, toCode = canonicalOrRaw(fromCode), canonicalOrRaw(toCode)
+	}
+
+	comparison := RunComparison{
+		From:      summarizeRun(from),
+		To:        summarizeRun(to),
+		CodeDiff:  unifiedDiff(fromCode, toCode, "run/"+from.ID, "run/"+to.ID),
+		Resources: diffResources(from.Code, to.Code),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// canonicalOrRaw returns the canonical form of code, or code itself if it
+// does not parse.
+func canonicalOrRaw(code string) string {
+	if canonical, err := canonicalHCL(code); err == nil {
+		return canonical
+	}
+	return code
+}
+
+// handleHistory lists a workspace's history, oldest first.
+func (s *Service) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	query := r.URL.Query()
+	contextName := query.Get("context")
+	if contextName == "" {
+		contextName = "default"
+	}
+	workspace := query.Get("workspace")
+	if workspace == "" {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "workspace is required", "")
+		return
+	}
+
+	entries, err := s.history.List(r.Context(), contextName, workspace)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to load history", err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []HistoryEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
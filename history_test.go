@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryStores(t *testing.T) {
+	stores := []struct {
+		name       string
+		newHistory func(t *testing.T) HistoryStore
+	}{
+		{"store", func(t *testing.T) HistoryStore { return &storeHistory{store: newMemoryStore(0)} }},
+		{"file", func(t *testing.T) HistoryStore {
+			history, err := newFileHistory(filepath.Join(t.TempDir(), "history"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return history
+		}},
+	}
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			testHistory(t, store.newHistory(t))
+		})
+	}
+}
+
+// testHistory checks that history keeps each workspace's entries apart, in
+// order, whatever the names.
+func testHistory(t *testing.T, history HistoryStore) {
+	ctx := context.Background()
+	entries := []HistoryEntry{
+		{ID: "1-a", Context: "a/b", Workspace: "c", Action: "apply"},
+		{ID: "2-b", Context: "a", Workspace: "b/c", Action: "apply"},
+		{ID: "3-c", Context: "a", Workspace: "b", Action: "plan"},
+		{ID: "4-d", Context: "a", Workspace: "b", Action: "apply"},
+		{ID: "5-e", Context: "a", Workspace: "b%2Fc", Action: "destroy"},
+		{ID: "6-f", Context: "..", Workspace: "..", Action: "apply"},
+	}
+	for _, entry := range entries {
+		if err := history.Record(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		context, workspace string
+		want               []string // Entry IDs
+	}{
+		{"a/b", "c", []string{"1-a"}},
+		{"a", "b/c", []string{"2-b"}},
+		{"a", "b", []string{"3-c", "4-d"}},
+		{"a", "b%2Fc", []string{"5-e"}},
+		{"..", "..", []string{"6-f"}},
+		{"a", "missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.context+" "+tt.workspace, func(t *testing.T) {
+			got, err := history.List(ctx, tt.context, tt.workspace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, entry := range got {
+				ids = append(ids, entry.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("entries = %q, want %q", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Errorf("entries = %q, want %q", ids, tt.want)
+				}
+			}
+		})
+	}
+}
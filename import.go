@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	pb "request-processor/api/proto"
+)
+
+type importTargetKey struct{}
+
+// importTarget is the existing resource an import request brings under
+// management.
+type importTarget struct {
+	Address string
+	ID      string
+}
+
+// withImportTarget records the resource an import action imports in ctx.
+func withImportTarget(ctx context.Context, address, id string) context.Context {
+	return context.WithValue(ctx, importTargetKey{}, importTarget{Address: address, ID: id})
+}
+
+func importTargetFrom(ctx context.Context) (importTarget, bool) {
+	target, ok := ctx.Value(importTargetKey{}).(importTarget)
+	return target, ok
+}
+
+// checkImportAddress checks that code declares the resource at address, which
+// terraform import requires. Addresses inside modules can't be checked
+// statically and are accepted.
+func checkImportAddress(code, address string) error {
+	if strings.HasPrefix(address, "module.") {
+		return nil
+	}
+	if strings.HasPrefix(address, "data.") {
+		return fmt.Errorf("cannot import %s: data sources are read, not managed, and can't be imported", address)
+	}
+	blocks, err := resourceBlocks(code)
+	if err != nil {
+		return fmt.Errorf("cannot check the import address: %w", err)
+	}
+	resource, _, _ := strings.Cut(address, "[") // aws_instance.web[0] is declared as aws_instance.web
+	if _, ok := blocks[resource]; ok {
+		return nil
+	}
+
+	declared := make([]string, 0, len(blocks))
+	for addr := range blocks {
+		declared = append(declared, addr)
+	}
+	sort.Strings(declared)
+	if len(declared) == 0 {
+		return fmt.Errorf("resource %s is not declared in the code, which has no resources; add a resource block describing the existing resource before importing it", resource)
+	}
+	return fmt.Errorf("resource %s is not declared in the code; add a block for it before importing, or import into one of the declared resources: %s", resource, strings.Join(declared, ", "))
+}
+
+// importResource imports the request's import target into the workspace's
+// state, then plans so the response shows how the code differs from the
+// imported resource.
+func (s *Service) importResource(ctx context.Context, contextName, workspace string) (*TerraformResponse, error) {
+	target, ok := importTargetFrom(ctx)
+	if !ok {
+		return nil, fmt.Errorf("import without an import target")
+	}
+	resp, err := s.executorClient.Import(ctx, &pb.ImportRequest{
+		Context:   contextName,
+		Workspace: workspace,
+		Address:   target.Address,
+		Id:        target.ID,
+	})
+	s.workspaceCache.invalidate(contextName, workspace, CacheEventApplied)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success || resp.Error != "" {
+		return &TerraformResponse{
+			Success:      false,
+			Output:       resp.ImportOutput,
+			ImportOutput: resp.ImportOutput,
+			Error:        resp.Error,
+			InitOutput:   resp.InitOutput,
+			InitError:    resp.InitError,
+		}, nil
+	}
+
+	plan, err := s.executorClient.Plan(ctx, &pb.PlanRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		// The import is done and can't be retried as is, so report instead of failing the call
+		return &TerraformResponse{
+			Success:      false,
+			Output:       resp.ImportOutput,
+			ImportOutput: resp.ImportOutput,
+			Error:        fmt.Sprintf("imported %s, but the plan that followed failed: %v", target.Address, err),
+			InitOutput:   resp.InitOutput,
+		}, nil
+	}
+	return &TerraformResponse{
+		Success:      plan.Success,
+		Output:       plan.PlanOutput,
+		PlanOutput:   plan.PlanOutput,
+		ImportOutput: resp.ImportOutput,
+		Error:        plan.Error,
+		InitOutput:   resp.InitOutput,
+		NoChanges:    plan.Success && plan.Error == "" && planHasNoChanges(plan.PlanOutput),
+		planJSON:     plan.PlanJson,
+	}, nil
+}
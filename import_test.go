@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckImportAddress(t *testing.T) {
+	const code = `resource "aws_instance" "web" {}
+
+resource "aws_s3_bucket" "logs" {}
+`
+	tests := []struct {
+		name    string
+		code    string
+		address string
+		wantErr string // Expected in the error; no error when empty
+	}{
+		{"declared", code, "aws_instance.web", ""},
+		{"indexed", code, "aws_instance.web[0]", ""},
+		{"keyed", code, `aws_instance.web["a"]`, ""},
+		{"module", code, "module.vpc.aws_vpc.main", ""},
+		{"data source", code, "data.aws_ami.ubuntu", "data sources are read, not managed"},
+		{"undeclared", code, "aws_instance.db", "import into one of the declared resources: aws_instance.web, aws_s3_bucket.logs"},
+		{"no resources", `output "x" { value = 1 }`, "aws_instance.web", "the code, which has no resources"},
+		{"unparseable", `resource "aws_instance" "web" {`, "aws_instance.web", "cannot check the import address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImportAddress(tt.code, tt.address)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkImportAddress() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkImportAddress() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const jobNamespace = "jobs"
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded" // Processed; the response may still report a failed action
+	JobFailed    = "failed"    // Could not be processed, see error
+)
+
+// Job is the status of an async /terraform request, kept in the store so it
+// can be polled at /jobs/{id}.
+type Job struct {
+	ID        string             `json:"job_id"`
+	Status    string             `json:"status"`
+	Response  *TerraformResponse `json:"response,omitempty"` // Set once the job succeeded
+	Error     *ErrorResponse     `json:"error,omitempty"`    // Set when the job failed, as a synchronous request would have reported it
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// queuedJob is work waiting for a worker. abandon runs instead of run when
+// the queue is closed before the job starts.
+type queuedJob struct {
+	run     func()
+	abandon func()
+}
+
+// jobQueue runs async requests on a fixed number of workers, so a burst of
+// them can't start unbounded applies.
+type jobQueue struct {
+	jobs    chan queuedJob
+	ctx     context.Context // Cancelled when close stops waiting for running jobs
+	cancel  context.CancelFunc
+	closed  atomic.Bool
+	closeMu sync.RWMutex // Held for writing while closing, so enqueue never sends on a closed channel
+	wg      sync.WaitGroup
+}
+
+func newJobQueue(workers, size int) *jobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &jobQueue{jobs: make(chan queuedJob, size), ctx: ctx, cancel: cancel}
+	for range workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func (q *jobQueue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		if q.closed.Load() {
+			job.abandon()
+			continue
+		}
+		job.run()
+	}
+}
+
+// enqueue queues a job. It returns false when the queue is full or closed.
+func (q *jobQueue) enqueue(job queuedJob) bool {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed.Load() {
+		return false
+	}
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// detach returns a context for running a job queued from ctx: it keeps the
+// values of ctx but not its cancellation, and is cancelled only when close
+// gives up on the running jobs. Call cancel once the job is done.
+func (q *jobQueue) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(q.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// close stops taking jobs and waits for the running ones to finish, until
+// ctx is done; then it cancels them and returns an error. Jobs that haven't
+// started are abandoned.
+func (q *jobQueue) close(ctx context.Context) error {
+	q.closeMu.Lock()
+	if !q.closed.Swap(true) {
+		close(q.jobs)
+	}
+	q.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return fmt.Errorf("cancelled the async jobs still running at shutdown: %w", ctx.Err())
+	}
+}
+
+// startJob queues process as an async job and responds 202 with its ID.
+// process runs without the request's cancellation, since the client is gone
+// by the time it runs; it is cancelled only if it is still running when
+// shutdown times out. When callbackURL is set, the outcome is posted to it
+// once the job finishes. It returns whether the job was queued.
+func (s *Service) startJob(ctx context.Context, w http.ResponseWriter, callbackURL string, process func(context.Context) (*TerraformResponse, error)) bool {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	job := &Job{ID: hex.EncodeToString(buf), Status: JobQueued, CreatedAt: time.Now()}
+	if err := s.saveJob(ctx, job); err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to save the job", err.Error())
+		return false
+	}
+
+	ctx, cancel := s.jobs.detach(ctx)
+	queued := s.jobs.enqueue(queuedJob{
+		run: func() {
+			defer cancel()
+			job.Status = JobRunning
+			s.updateJob(ctx, job)
+			response, err := process(ctx)
+			if err != nil {
+				_, body := processingError(err)
+				job.Status, job.Error = JobFailed, &body
+			} else {
+				job.Status, job.Response = JobSucceeded, response
+			}
+			s.updateJob(ctx, job)
+			if callbackURL != "" {
+				s.deliverCallback(ctx, callbackURL, job)
+			}
+		},
+		abandon: func() {
+			defer cancel()
+			job.Status = JobFailed
+			job.Error = &ErrorResponse{Code: APIErrorShuttingDown, Message: "The service shut down before the job started; resubmit the request"}
+			s.updateJob(ctx, job)
+		},
+	})
+	if !queued {
+		defer cancel()
+		job.Status = JobFailed
+		job.Error = &ErrorResponse{Code: APIErrorQueueFull, Message: "Too many async requests are queued"}
+		s.updateJob(ctx, job)
+		writeError(w, http.StatusServiceUnavailable, APIErrorQueueFull, "Too many async requests are queued, retry later", "")
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": job.ID})
+	return true
+}
+
+func (s *Service) saveJob(ctx context.Context, job *Job) error {
+	job.UpdatedAt = time.Now()
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(ctx, jobNamespace, job.ID, value, time.Duration(s.config().Jobs.TTLSeconds)*time.Second)
+}
+
+// updateJob saves a job's progress. Failures are only logged: the job runs
+// on regardless.
+func (s *Service) updateJob(ctx context.Context, job *Job) {
+	if err := s.saveJob(ctx, job); err != nil {
+		s.runLogger(ctx).Warn("failed to save job", "job_id", job.ID, "error", err)
+	}
+}
+
+func (s *Service) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	id := r.PathValue("id")
+	value, err := s.store.Get(r.Context(), jobNamespace, id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, APIErrorNotFound, "Job not found", "")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to load job", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(value)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJobQueueClose(t *testing.T) {
+	tests := []struct {
+		name      string
+		jobTime   time.Duration // How long the running job takes unless cancelled
+		timeout   time.Duration
+		wantErr   bool
+		cancelled bool // Whether the job's context should be cancelled
+	}{
+		{name: "job finishes in time", jobTime: 10 * time.Millisecond, timeout: 10 * time.Second},
+		{name: "job outlives the deadline", jobTime: time.Minute, timeout: 50 * time.Millisecond, wantErr: true, cancelled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newJobQueue(1, 1)
+			jobCtx, cancel := q.detach(context.Background())
+			defer cancel()
+			started, finished := make(chan struct{}), make(chan bool, 1)
+			q.enqueue(queuedJob{
+				run: func() {
+					close(started)
+					select {
+					case <-time.After(tt.jobTime):
+						finished <- false
+					case <-jobCtx.Done():
+						finished <- true
+					}
+				},
+				abandon: func() {},
+			})
+			<-started
+
+			ctx, cancelClose := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancelClose()
+			start := time.Now()
+			err := q.close(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("close error = %v, want error %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > tt.timeout+5*time.Second {
+				t.Errorf("close took %v, want at most about %v", elapsed, tt.timeout)
+			}
+			if cancelled := <-finished; cancelled != tt.cancelled {
+				t.Errorf("job cancelled = %v, want %v", cancelled, tt.cancelled)
+			}
+		})
+	}
+}
+
+func TestJobQueueAbandonsQueuedJobs(t *testing.T) {
+	q := newJobQueue(1, 2)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	q.enqueue(queuedJob{run: func() { close(started); <-release }, abandon: func() {}})
+	<-started
+
+	abandoned := make(chan struct{})
+	if !q.enqueue(queuedJob{run: func() { t.Error("queued job ran after close") }, abandon: func() { close(abandoned) }}) {
+		t.Fatal("enqueue failed with room in the queue")
+	}
+	closed := make(chan error)
+	go func() { closed <- q.close(context.Background()) }()
+	for !q.closed.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	if q.enqueue(queuedJob{run: func() {}, abandon: func() {}}) {
+		t.Error("enqueue succeeded on a closed queue")
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-abandoned:
+	default:
+		t.Error("queued job was not abandoned")
+	}
+}
+
+func TestStartJob(t *testing.T) {
+	tests := []struct {
+		name       string
+		process    func(context.Context) (*TerraformResponse, error)
+		queueSize  int // Also the number of workers
+		wantStatus int // Of the request starting the job
+		wantJob    string
+		wantError  string // Error code of the job
+	}{
+		{
+			name: "succeeded",
+			process: func(context.Context) (*TerraformResponse, error) {
+				return &TerraformResponse{Success: true, Output: "applied"}, nil
+			},
+			queueSize:  1,
+			wantStatus: http.StatusAccepted,
+			wantJob:    JobSucceeded,
+		},
+		{
+			name:       "failed",
+			process:    func(context.Context) (*TerraformResponse, error) { return nil, errWorkspaceBusy },
+			queueSize:  1,
+			wantStatus: http.StatusAccepted,
+			wantJob:    JobFailed,
+			wantError:  APIErrorWorkspaceBusy,
+		},
+		{
+			name: "queue full",
+			process: func(context.Context) (*TerraformResponse, error) {
+				t.Error("job ran with a full queue")
+				return nil, nil
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			config.Jobs.TTLSeconds = 60
+			s := newTestService(config)
+			s.jobs = newJobQueue(tt.queueSize, tt.queueSize)
+			defer s.jobs.close(context.Background())
+
+			w := httptest.NewRecorder()
+			s.startJob(context.Background(), w, "", tt.process)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				return
+			}
+			var started struct {
+				JobID string `json:"job_id"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&started); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Header().Get("Location"); got != "/jobs/"+started.JobID {
+				t.Errorf("Location = %q, want /jobs/%s", got, started.JobID)
+			}
+
+			var job Job
+			for deadline := time.Now().Add(5 * time.Second); job.Status != JobSucceeded && job.Status != JobFailed && time.Now().Before(deadline); {
+				r := httptest.NewRequest(http.MethodGet, "/jobs/"+started.JobID, nil)
+				r.SetPathValue("id", started.JobID)
+				w = httptest.NewRecorder()
+				s.handleJob(w, r)
+				if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if job.Status != tt.wantJob {
+				t.Errorf("job status = %q, want %q", job.Status, tt.wantJob)
+			}
+			if tt.wantError != "" && (job.Error == nil || job.Error.Code != tt.wantError) {
+				t.Errorf("job error = %+v, want code %q", job.Error, tt.wantError)
+			}
+			if tt.wantJob == JobSucceeded && (job.Response == nil || job.Response.Output != "applied") {
+				t.Errorf("job response = %+v, want the processed response", job.Response)
+			}
+		})
+	}
+}
+
+func TestHandleJobNotFound(t *testing.T) {
+	s := newTestService(nil)
+	r := httptest.NewRequest(http.MethodGet, "/jobs/missing", nil)
+	r.SetPathValue("id", "missing")
+	w := httptest.NewRecorder()
+	s.handleJob(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+type DescriptionLanguageConfig struct {
+	Target    string `yaml:"target"`    // Expected language as an ISO 639-1 code, e.g. "en"; empty disables detection
+	Translate bool   `yaml:"translate"` // Translate other languages to the target before generation, at the cost of an extra LLM call
+}
+
+// scriptLanguages maps non-Latin scripts to the language they most likely
+// indicate in a description.
+var scriptLanguages = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Cyrillic, "ru"},
+	{unicode.Han, "zh"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Arabic, "ar"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+}
+
+// stopWords are common function words of Latin-script languages. Technical
+// terms are shared across languages, so only these are counted.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "with", "for", "create", "add", "to", "of", "in", "on", "a", "an", "that", "should"},
+	"es": {"el", "la", "los", "las", "con", "para", "crear", "de", "del", "en", "un", "una", "que", "y"},
+	"fr": {"le", "la", "les", "avec", "pour", "créer", "de", "des", "du", "un", "une", "et", "dans", "qui"},
+	"de": {"der", "die", "das", "mit", "für", "erstelle", "und", "ein", "eine", "einen", "im", "auf", "zu", "den"},
+	"pt": {"o", "os", "as", "com", "para", "criar", "de", "do", "da", "um", "uma", "e", "em", "que"},
+	"it": {"il", "lo", "gli", "con", "per", "creare", "di", "del", "della", "un", "una", "e", "che", "nel"},
+}
+
+var languageWord = regexp.MustCompile(`[\p{L}]+`)
+
+// detectLanguage guesses the language of a description. Non-Latin scripts
+// decide by script; Latin text by stop words. It returns "" when unsure.
+func detectLanguage(text string) string {
+	var letters int
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, sl := range scriptLanguages {
+			if unicode.Is(sl.table, r) {
+				scripts[sl.language]++
+				break
+			}
+		}
+	}
+	for language, count := range scripts {
+		if count*2 > letters {
+			return language
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, word := range languageWord.FindAllString(strings.ToLower(text), -1) {
+		for language, words := range stopWords {
+			for _, stop := range words {
+				if word == stop {
+					counts[language]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestCount, tied := "", 0, false
+	for language, count := range counts {
+		if count > bestCount {
+			best, bestCount, tied = language, count, false
+		} else if count == bestCount {
+			tied = true
+		}
+	}
+	if bestCount < 2 || tied {
+		return ""
+	}
+	return best
+}
+
+func generateTranslationPrompt(description, target string) string {
+	return fmt.Sprintf(`Translate this infrastructure change request into the language with ISO 639-1 code %q.
+
+	Request:
+	%s
+
+	Requirements:
+	1. Keep resource names, regions, sizes, images and other identifiers unchanged
+	2. Respond ONLY with the translated request`,
+		target,
+		description,
+	)
+}
+
+// checkDescriptionLanguage compares the language of req.Description with the
+// configured target. When translation is on, the description is replaced by
+// its translation. It returns a warning for the response, or "" if the
+// description is in the target language, and the translation call, if any.
+func (s *Service) checkDescriptionLanguage(ctx context.Context, req *TerraformRequest) (string, *generation) {
+	config := s.config().DescriptionLanguage
+	if config.Target == "" || req.Description == "" {
+		return "", nil
+	}
+	language := detectLanguage(req.Description)
+	if language == "" || language == config.Target {
+		return "", nil
+	}
+	if !config.Translate {
+		return fmt.Sprintf("description appears to be in %q rather than %q, which may degrade generation", language, config.Target), nil
+	}
+
+	gen, err := s.complete(ctx, s.auxiliaryModel(anthropic.ModelClaude3_5HaikuLatest), generateTranslationPrompt(req.Description, config.Target), 1024)
+	if err != nil {
+		return fmt.Sprintf("description appears to be in %q rather than %q and could not be translated: %v", language, config.Target, err), nil
+	}
+	req.Description = strings.TrimSpace(gen.Code)
+	return fmt.Sprintf("description was translated from %q to %q before generation", language, config.Target), gen
+}
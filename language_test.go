@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Create a droplet with 2GB of memory in the fra1 region", "en"},
+		{"Crear un droplet con 2GB de memoria en la región fra1", "es"},
+		{"Erstelle einen Droplet mit 2GB und eine Firewall für den Port 22", "de"},
+		{"Создай дроплет с 2GB памяти в регионе fra1", "ru"},
+		{"在fra1区域创建一个服务器和防火墙", "zh"},
+		{"droplet fra1 s-1vcpu-1gb", ""}, // Only technical terms
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.want {
+				t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDescriptionLanguage(t *testing.T) {
+	const spanish = "Crear un droplet con 2GB de memoria en la región fra1"
+	tests := []struct {
+		name        string
+		config      DescriptionLanguageConfig
+		description string
+		wantWarning string // Prefix
+		wantDesc    string
+		wantCalls   int // Translation calls
+	}{
+		{"detection off", DescriptionLanguageConfig{}, spanish, "", spanish, 0},
+		{"target language", DescriptionLanguageConfig{Target: "en"}, "Create a droplet with 2GB of memory", "", "Create a droplet with 2GB of memory", 0},
+		{"warning", DescriptionLanguageConfig{Target: "en"}, spanish, `description appears to be in "es" rather than "en"`, spanish, 0},
+		{"translated", DescriptionLanguageConfig{Target: "en", Translate: true}, spanish, `description was translated from "es" to "en"`, "Create a droplet with 2GB of memory in the fra1 region", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := &fakeGenerator{replies: []string{"Create a droplet with 2GB of memory in the fra1 region\n"}}
+			s := newTestService(&Config{DescriptionLanguage: tt.config})
+			s.generator = generator
+
+			req := TerraformRequest{Description: tt.description}
+			warning, translation := s.checkDescriptionLanguage(context.Background(), &req)
+			if !strings.HasPrefix(warning, tt.wantWarning) || (tt.wantWarning == "") != (warning == "") {
+				t.Errorf("warning = %q, want %q", warning, tt.wantWarning)
+			}
+			if req.Description != tt.wantDesc {
+				t.Errorf("description = %q, want %q", req.Description, tt.wantDesc)
+			}
+			if got := generator.calls(); got != tt.wantCalls || (translation != nil) != (tt.wantCalls > 0) {
+				t.Errorf("translation calls = %d (translation %v), want %d", got, translation, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDescriptionLength(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        int
+	}{
+		{"too long", strings.Repeat("a", 11), http.StatusBadRequest},
+		{"multibyte runes count once", strings.Repeat("я", 10), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&Config{MaxDescriptionLength: 10})
+			s.executorClient = newFakeExecutor()
+			s.generator = &fakeGenerator{replies: []string{"```hcl\n" + `resource "digitalocean_droplet" "web" {}` + "\n```"}}
+			body := `{"action":"apply","dry_run":true,"workspace":"ws","description":"` + tt.description + `"}`
+			w := httptest.NewRecorder()
+			s.handleTerraformRequest(w, httptest.NewRequest(http.MethodPost, "/terraform", strings.NewReader(body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Finding severities, lowest first. Tools that don't rate a finding get
+// SeverityMedium.
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3, SeverityCritical: 4}
+
+type LintToolConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"` // Binary to run; defaults to the tool's name on PATH
+}
+
+// LintConfig enables static analysis of generated code. The tools run on
+// this host, so they must be installed alongside the service.
+type LintConfig struct {
+	Tflint         LintToolConfig `yaml:"tflint"`
+	Checkov        LintToolConfig `yaml:"checkov"`
+	Tfsec          LintToolConfig `yaml:"tfsec"`
+	BlockSeverity  string         `yaml:"block_severity"`  // Regenerate instead of applying when a finding is at least this severe; empty never blocks
+	TimeoutSeconds int            `yaml:"timeout_seconds"` // Per tool; default 60
+}
+
+func (c LintConfig) enabled() bool {
+	return c.Tflint.Enabled || c.Checkov.Enabled || c.Tfsec.Enabled
+}
+
+type LintFinding struct {
+	Tool     string `json:"tool"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Resource string `json:"resource,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+func (f LintFinding) String() string {
+	s := fmt.Sprintf("[%s %s] %s", f.Tool, f.Rule, f.Message)
+	if f.Resource != "" {
+		s += " (" + f.Resource + ")"
+	}
+	if f.Line > 0 {
+		s += fmt.Sprintf(" at line %d", f.Line)
+	}
+	return s
+}
+
+// lintCode runs the enabled tools on code and returns their findings, most
+// severe first. A tool that fails to run is skipped with an error, but the
+// findings of the others are still returned.
+func (s *Service) lintCode(ctx context.Context, code string) ([]LintFinding, error) {
+	config := s.config().Lint
+	dir, err := os.MkdirTemp("", "lint-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lint directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(code), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write code for linting: %v", err)
+	}
+
+	tools := []struct {
+		name   string
+		config LintToolConfig
+		args   []string
+		parse  func([]byte) ([]LintFinding, error)
+	}{
+		{"tflint", config.Tflint, []string{"--format=json"}, parseTflint},
+		{"checkov", config.Checkov, []string{"-d", ".", "-o", "json", "--quiet", "--compact", "--framework", "terraform"}, parseCheckov},
+		{"tfsec", config.Tfsec, []string{".", "--format", "json", "--no-colour"}, parseTfsec},
+	}
+
+	var findings []LintFinding
+	var errs []string
+	for _, tool := range tools {
+		if !tool.config.Enabled {
+			continue
+		}
+		path := tool.config.Path
+		if path == "" {
+			path = tool.name
+		}
+		toolCtx, cancel := context.WithTimeout(ctx, time.Duration(config.TimeoutSeconds)*time.Second)
+		cmd := exec.CommandContext(toolCtx, path, tool.args...)
+		cmd.Dir = dir
+		output, err := cmd.Output()
+		cancel()
+		// The tools exit non-zero when they have findings
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			errs = append(errs, fmt.Sprintf("%s: %v", tool.name, err))
+			continue
+		}
+		toolFindings, err := tool.parse(output)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", tool.name, err))
+			continue
+		}
+		findings = append(findings, toolFindings...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] > severityRank[findings[j].Severity]
+	})
+	if len(errs) > 0 {
+		return findings, fmt.Errorf("lint tools failed: %s", strings.Join(errs, "; "))
+	}
+	return findings, nil
+}
+
+// blockingFindings returns the findings at or above the block_severity.
+func (s *Service) blockingFindings(findings []LintFinding) []LintFinding {
+	threshold, ok := severityRank[s.config().Lint.BlockSeverity]
+	if !ok {
+		return nil
+	}
+	var blocking []LintFinding
+	for _, finding := range findings {
+		if severityRank[finding.Severity] >= threshold {
+			blocking = append(blocking, finding)
+		}
+	}
+	return blocking
+}
+
+func normalizeSeverity(severity string) string {
+	severity = strings.ToLower(severity)
+	switch severity {
+	case "error":
+		return SeverityHigh
+	case "warning":
+		return SeverityMedium
+	case "notice", "info":
+		return SeverityLow
+	}
+	if _, ok := severityRank[severity]; ok {
+		return severity
+	}
+	return SeverityMedium
+}
+
+func parseTflint(output []byte) ([]LintFinding, error) {
+	var result struct {
+		Issues []struct {
+			Rule struct {
+				Name     string `json:"name"`
+				Severity string `json:"severity"`
+			} `json:"rule"`
+			Message string `json:"message"`
+			Range   struct {
+				Start struct {
+					Line int `json:"line"`
+				} `json:"start"`
+			} `json:"range"`
+		} `json:"issues"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse output: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, errors.New(result.Errors[0].Message)
+	}
+
+	var findings []LintFinding
+	for _, issue := range result.Issues {
+		findings = append(findings, LintFinding{
+			Tool:     "tflint",
+			Rule:     issue.Rule.Name,
+			Severity: normalizeSeverity(issue.Rule.Severity),
+			Message:  issue.Message,
+			Line:     issue.Range.Start.Line,
+		})
+	}
+	return findings, nil
+}
+
+type checkovReport struct {
+	Results struct {
+		FailedChecks []struct {
+			CheckID       string `json:"check_id"`
+			CheckName     string `json:"check_name"`
+			Resource      string `json:"resource"`
+			FileLineRange []int  `json:"file_line_range"`
+			Severity      string `json:"severity"`
+		} `json:"failed_checks"`
+	} `json:"results"`
+}
+
+// parseCheckov parses checkov's JSON report, which is a single object for one
+// framework and a list otherwise.
+func parseCheckov(output []byte) ([]LintFinding, error) {
+	var reports []checkovReport
+	if err := json.Unmarshal(output, &reports); err != nil {
+		var report checkovReport
+		if err := json.Unmarshal(output, &report); err != nil {
+			return nil, fmt.Errorf("failed to parse output: %v", err)
+		}
+		reports = []checkovReport{report}
+	}
+
+	var findings []LintFinding
+	for _, report := range reports {
+		for _, check := range report.Results.FailedChecks {
+			finding := LintFinding{
+				Tool:     "checkov",
+				Rule:     check.CheckID,
+				Severity: normalizeSeverity(check.Severity),
+				Message:  check.CheckName,
+				Resource: check.Resource,
+			}
+			if len(check.FileLineRange) > 0 {
+				finding.Line = check.FileLineRange[0]
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+func parseTfsec(output []byte) ([]LintFinding, error) {
+	var result struct {
+		Results []struct {
+			LongID      string `json:"long_id"`
+			Description string `json:"description"`
+			Severity    string `json:"severity"`
+			Resource    string `json:"resource"`
+			Location    struct {
+				StartLine int `json:"start_line"`
+			} `json:"location"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse output: %v", err)
+	}
+
+	var findings []LintFinding
+	for _, r := range result.Results {
+		findings = append(findings, LintFinding{
+			Tool:     "tfsec",
+			Rule:     r.LongID,
+			Severity: normalizeSeverity(r.Severity),
+			Message:  r.Description,
+			Resource: r.Resource,
+			Line:     r.Location.StartLine,
+		})
+	}
+	return findings, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// LLM providers selectable with llm_provider.
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai" // Any OpenAI-compatible chat completions endpoint
+)
+
+// CodeGenerator sends a prompt to an LLM and returns the reply text with its
+// token usage. model is one of the provider's models.
+type CodeGenerator interface {
+	Complete(ctx context.Context, model, prompt string, maxTokens int64) (*generation, error)
+}
+
+func newCodeGenerator(config Config) (CodeGenerator, error) {
+	switch config.LLMProvider {
+	case ProviderAnthropic:
+		return &AnthropicGenerator{
+			client: anthropic.NewClient(option.WithAPIKey(config.AnthropicAPIKey)),
+			model:  config.DefaultModel,
+		}, nil
+	case ProviderOpenAI:
+		return &OpenAIGenerator{
+			baseURL: strings.TrimSuffix(config.OpenAI.BaseURL, "/"),
+			apiKey:  config.OpenAI.APIKey,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown llm_provider %q", config.LLMProvider)
+	}
+}
+
+// AnthropicGenerator generates with the Anthropic Messages API.
+type AnthropicGenerator struct {
+	client *anthropic.Client
+	model  string // Model validateAPIKey calls
+}
+
+func (g *AnthropicGenerator) Complete(ctx context.Context, model, prompt string, maxTokens int64) (*generation, error) {
+	message, err := g.client.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:     anthropic.F(anthropic.Model(model)),
+		MaxTokens: anthropic.F(maxTokens),
+		Messages: anthropic.F([]anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
+		}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var text string
+	for _, content := range message.Content {
+		text += content.Text
+	}
+
+	return &generation{
+		Code:         text,
+		Model:        model,
+		InputTokens:  message.Usage.InputTokens,
+		OutputTokens: message.Usage.OutputTokens,
+		StopReason:   string(message.StopReason),
+		StopSequence: message.StopSequence,
+	}, nil
+}
+
+// validateAPIKey makes a one-token call so a rejected key fails startup
+// rather than the first request. Other failures, such as an unreachable API,
+// are only logged: they may well be transient.
+func (g *AnthropicGenerator) validateAPIKey(ctx context.Context) error {
+	_, err := g.Complete(ctx, g.model, "ping", 1)
+	return checkAPIKeyResult(err)
+}
+
+// checkAPIKeyResult returns the startup error for the result of the
+// validation call: an error when the key was rejected, nil otherwise.
+func checkAPIKeyResult(err error) error {
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("anthropic_api_key was rejected by the Anthropic API (%d %s); check the key, or set validate_api_key_on_start to false to skip this check", apiErr.StatusCode, http.StatusText(apiErr.StatusCode))
+	}
+	if err != nil {
+		slog.Warn("could not validate anthropic_api_key", "error", err)
+	}
+	return nil
+}
+
+// OpenAIGenerator generates with an OpenAI-compatible chat completions API.
+type OpenAIGenerator struct {
+	baseURL string // e.g. https://api.openai.com/v1
+	apiKey  string
+}
+
+// openAIStopReasons maps OpenAI finish reasons to the Anthropic stop reasons
+// used elsewhere, so truncated generations are detected the same way.
+var openAIStopReasons = map[string]string{
+	"stop":   string(anthropic.MessageStopReasonEndTurn),
+	"length": string(anthropic.MessageStopReasonMaxTokens),
+}
+
+func (g *OpenAIGenerator) Complete(ctx context.Context, model, prompt string, maxTokens int64) (*generation, error) {
+	body, err := json.Marshal(map[string]any{
+		"model":      model,
+		"max_tokens": maxTokens,
+		"messages":   []map[string]string{{"role": "user", "content": prompt}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode completion request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("completion request returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return nil, fmt.Errorf("failed to decode completion response: %v", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("completion response has no choices")
+	}
+
+	choice := completion.Choices[0]
+	stopReason, ok := openAIStopReasons[choice.FinishReason]
+	if !ok {
+		stopReason = choice.FinishReason
+	}
+	return &generation{
+		Code:         choice.Message.Content,
+		Model:        model,
+		InputTokens:  completion.Usage.PromptTokens,
+		OutputTokens: completion.Usage.CompletionTokens,
+		StopReason:   stopReason,
+	}, nil
+}
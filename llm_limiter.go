@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// llmLimiter bounds the number of simultaneous LLM calls. Callers over the
+// limit wait in line until a slot frees up or their context ends.
+type llmLimiter struct {
+	slots   chan struct{}
+	metrics *metrics // Tracks the queue depth and calls in flight; nil in the generate subcommand
+}
+
+func newLLMLimiter(limit int, m *metrics) *llmLimiter {
+	return &llmLimiter{slots: make(chan struct{}, limit), metrics: m}
+}
+
+func (l *llmLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		l.metrics.addLLMInFlight(1)
+		return nil
+	default:
+	}
+
+	l.metrics.addLLMWaiting(1)
+	defer l.metrics.addLLMWaiting(-1)
+
+	select {
+	case l.slots <- struct{}{}:
+		l.metrics.addLLMInFlight(1)
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for an LLM slot: %v", ctx.Err())
+	}
+}
+
+func (l *llmLimiter) release() {
+	<-l.slots
+	l.metrics.addLLMInFlight(-1)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func TestOpenAIGenerator(t *testing.T) {
+	var request struct {
+		Model     string `json:"model"`
+		MaxTokens int64  `json:"max_tokens"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"choices":[{"message":{"content":"resource \"aws_instance\" \"web\" {}"},"finish_reason":"length"}],"usage":{"prompt_tokens":12,"completion_tokens":34}}`))
+	}))
+	defer server.Close()
+
+	generator, err := newCodeGenerator(Config{LLMProvider: ProviderOpenAI, OpenAI: struct {
+		BaseURL string `yaml:"base_url"`
+		APIKey  string `yaml:"api_key"`
+	}{BaseURL: server.URL + "/v1/", APIKey: "key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := generator.Complete(context.Background(), "gpt-4o", "prompt", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "gpt-4o" || request.MaxTokens != 100 {
+		t.Errorf("request model = %q, max tokens = %d; want gpt-4o, 100", request.Model, request.MaxTokens)
+	}
+	want := generation{Code: `resource "aws_instance" "web" {}`, Model: "gpt-4o", InputTokens: 12, OutputTokens: 34, StopReason: "max_tokens"}
+	if gen.Code != want.Code || gen.Model != want.Model || gen.InputTokens != want.InputTokens || gen.OutputTokens != want.OutputTokens || gen.StopReason != want.StopReason {
+		t.Errorf("generation = %+v, want %+v", *gen, want)
+	}
+}
+
+func TestModelsByProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		known   []string
+		unknown []string
+		wantErr string
+	}{
+		{
+			name:    "anthropic",
+			config:  "anthropic_api_key: key\n",
+			known:   []string{"claude-3-5-sonnet-latest", "claude-3-5-haiku-latest"},
+			unknown: []string{"gpt-4o"},
+		},
+		{
+			name:    "openai",
+			config:  "llm_provider: openai\nopenai:\n  base_url: http://localhost\ndefault_model: gpt-4o\nmodel_pricing:\n  gpt-4o:\n    input_per_mtok: 2.5\n    output_per_mtok: 10\n",
+			known:   []string{"gpt-4o"},
+			unknown: []string{"claude-3-5-sonnet-latest"},
+		},
+		{
+			name:    "openai default model without pricing",
+			config:  "llm_provider: openai\nopenai:\n  base_url: http://localhost\ndefault_model: gpt-4o\n",
+			wantErr: `default_model "gpt-4o" is not a known model`,
+		},
+		{
+			name:    "openai with a Claude default model",
+			config:  "llm_provider: openai\nopenai:\n  base_url: http://localhost\ndefault_model: claude-3-5-sonnet-latest\n",
+			wantErr: `default_model "claude-3-5-sonnet-latest" is not a known model`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, model := range tt.known {
+				if _, ok := config.ModelPricing[model]; !ok {
+					t.Errorf("model %s is unknown", model)
+				}
+			}
+			for _, model := range tt.unknown {
+				if _, ok := config.ModelPricing[model]; ok {
+					t.Errorf("model %s is known", model)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAPIKeyResult(t *testing.T) {
+	apiError := func(status int) *anthropic.Error {
+		return &anthropic.Error{
+			StatusCode: status,
+			Request:    httptest.NewRequest(http.MethodPost, "https://api.anthropic.com/v1/messages", nil),
+			Response:   &http.Response{StatusCode: status},
+		}
+	}
+	tests := []struct {
+		name    string
+		err     error
+		wantErr string // Expected in the startup error; none when empty
+	}{
+		{"accepted", nil, ""},
+		{"unauthorized", apiError(http.StatusUnauthorized), "rejected by the Anthropic API (401 Unauthorized)"},
+		{"forbidden", apiError(http.StatusForbidden), "rejected by the Anthropic API (403 Forbidden)"},
+		{"wrapped", fmt.Errorf("calling the API: %w", apiError(http.StatusUnauthorized)), "validate_api_key_on_start"},
+		{"other API error", apiError(http.StatusTooManyRequests), ""},
+		{"unreachable", errors.New("dial tcp: connection refused"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAPIKeyResult(tt.err)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkAPIKeyResult() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkAPIKeyResult() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
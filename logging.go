@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Log formats selectable with log_format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// logLevel is the configured log_level, shared by every handler so event
+// streams log at the same level as the service.
+var logLevel = new(slog.LevelVar)
+
+// parseLogLevel parses a log_level: debug, info, warn or error.
+func parseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("log_level must be one of debug, info, warn or error, got %q", level)
+	}
+	return l, nil
+}
+
+func newLogHandler(w io.Writer, format string) slog.Handler {
+	options := &slog.HandlerOptions{Level: logLevel}
+	if format == LogFormatJSON {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// setupLogging makes slog log to w at the configured level and format. Output
+// of the log package goes through the same handler.
+func setupLogging(config *Config, w io.Writer) {
+	level, _ := parseLogLevel(config.LogLevel) // Validated by LoadConfig
+	logLevel.Set(level)
+	slog.SetDefault(slog.New(newLogHandler(w, config.LogFormat)))
+}
+
+func validateLogging(config *Config) error {
+	if _, err := parseLogLevel(config.LogLevel); err != nil {
+		return err
+	}
+	if config.LogFormat != LogFormatText && config.LogFormat != LogFormatJSON {
+		return fmt.Errorf("log_format must be %s or %s, got %q", LogFormatText, LogFormatJSON, config.LogFormat)
+	}
+	return nil
+}
+
+// teeHandler passes each record to all of its handlers.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// redactingHandler redacts the message and attributes of each record before
+// passing it on.
+type redactingHandler struct {
+	next   slog.Handler
+	redact func(string) string
+}
+
+func (h redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, h.redact(r.Message), r.PC)
+	r.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// redactAttr redacts an attribute's value. Values other than strings and
+// groups, such as errors and slices of output lines, are formatted and
+// replaced by their redacted text, since they can carry secrets too.
+func (h redactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		attrs := attr.Value.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redacted[i] = h.redactAttr(a)
+		}
+		attr.Value = slog.GroupValue(redacted...)
+	case slog.KindString:
+		attr.Value = slog.StringValue(h.redact(attr.Value.String()))
+	default:
+		attr.Value = slog.StringValue(h.redact(fmt.Sprint(attr.Value.Any())))
+	}
+	return attr
+}
+
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+	return redactingHandler{next: h.next.WithAttrs(redacted), redact: h.redact}
+}
+
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{next: h.next.WithGroup(name), redact: h.redact}
+}
+
+// runLogger returns the logger of a run: the default logger, also writing to
+// the client's event stream if it asked for one. Secrets are redacted, since
+// run logs include prompts, code and terraform output at debug level.
+func (s *Service) runLogger(ctx context.Context) *slog.Logger {
+	handler := slog.Default().Handler()
+	if eventStreamFrom(ctx) != nil {
+		stream := slog.NewTextHandler(streamLogWriter{s: s, ctx: ctx}, &slog.HandlerOptions{Level: logLevel})
+		handler = teeHandler{handler, stream}
+	}
+	return slog.New(redactingHandler{
+		next:   handler,
+		redact: func(text string) string { return s.redact(ctx, text) },
+	})
+}
@@ -3,64 +3,369 @@ package main
 import (
 	// "bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 
 	// "io"
-	"log"
+	"log/slog"
+	"math"
+	"math/rand/v2"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"regexp"
 	pb "request-processor/api/proto"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/anthropics/anthropic-sdk-go/option"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"gopkg.in/yaml.v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type TerraformError struct {
-	Message         string // Full error message
-	TerraformOutput string // Complete Terraform output including plan/apply details
-	Resource        string // Affected resource
+	Message         string         // Full error message
+	TerraformOutput string         // Complete Terraform output including plan/apply details
+	Resource        string         // Affected resource of the first error that names one
+	Diagnostics     []Diagnostic   // Structured diagnostics, when terraform reported them as JSON
+	Errors          []failureCause // Every error, with its resource and position when reported
 }
 
+// Diagnostic mirrors a single entry of `terraform validate -json` output.
+type Diagnostic struct {
+	Severity string           `json:"severity"`
+	Summary  string           `json:"summary"`
+	Detail   string           `json:"detail,omitempty"`
+	Range    *DiagnosticRange `json:"range,omitempty"`
+}
+
+type DiagnosticRange struct {
+	Filename string        `json:"filename"`
+	Start    DiagnosticPos `json:"start"`
+	End      DiagnosticPos `json:"end"`
+}
+
+type DiagnosticPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+// Backoff modes for the delay between retries.
+const (
+	BackoffConstant    = "constant"
+	BackoffExponential = "exponential"
+)
+
 type RetryConfig struct {
 	MaxAttempts int
 	Delay       time.Duration
+	Backoff     string        // BackoffConstant or BackoffExponential
+	MaxDelay    time.Duration // Cap on exponential delays; 0 means no cap
+}
+
+// delay returns how long to wait after the given zero-based attempt. With
+// exponential backoff it is a random duration up to Delay * 2^attempt, capped
+// at MaxDelay (full jitter), so retries from concurrent requests spread out.
+func (c RetryConfig) delay(attempt int) time.Duration {
+	if c.Backoff != BackoffExponential || c.Delay <= 0 {
+		return c.Delay
+	}
+	ceiling := c.Delay
+	for i := 0; i < attempt && (c.MaxDelay <= 0 || ceiling < c.MaxDelay) && ceiling < time.Hour; i++ {
+		ceiling *= 2
+	}
+	if c.MaxDelay > 0 && ceiling > c.MaxDelay {
+		ceiling = c.MaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// retryConfig returns the retry policy for a request: the configured one,
+// with the request's overrides applied.
+func (s *Service) retryConfig(req TerraformRequest) RetryConfig {
+	retryConfig := RetryConfig{
+		MaxAttempts: *s.config().Retry.MaxAttempts,
+		Delay:       time.Duration(*s.config().Retry.DelaySeconds) * time.Second,
+		Backoff:     s.config().Retry.Backoff,
+		MaxDelay:    time.Duration(s.config().Retry.MaxDelaySeconds) * time.Second,
+	}
+	if req.MaxAttempts > 0 {
+		retryConfig.MaxAttempts = req.MaxAttempts
+	}
+	if req.RetryDelaySeconds != nil {
+		retryConfig.Delay = time.Duration(*req.RetryDelaySeconds) * time.Second
+	}
+	return retryConfig
 }
 
 type Config struct {
+	LLMProvider string `yaml:"llm_provider"` // "anthropic" (default) or "openai" for an OpenAI-compatible endpoint
+	OpenAI      struct {
+		BaseURL string `yaml:"base_url"` // e.g. https://api.openai.com/v1
+		APIKey  string `yaml:"api_key"`
+	} `yaml:"openai"`
 	AnthropicAPIKey string `yaml:"anthropic_api_key"`
 	GRPCServerAddr  string `yaml:"grpc_server_addr"`
-	Server          struct {
-		Port int `yaml:"port"`
+	GRPCTLSCA       string `yaml:"grpc_tls_ca"`   // PEM CA bundle executor certificates are verified against; defaults to the system roots
+	GRPCTLSCert     string `yaml:"grpc_tls_cert"` // Client certificate presented to executors for mTLS
+	GRPCTLSKey      string `yaml:"grpc_tls_key"`  // Key for grpc_tls_cert
+	GRPCInsecure    bool   `yaml:"grpc_insecure"` // Dial executors without TLS; only for executors on a trusted network
+	Executors       struct {
+		Addrs                 []string `yaml:"addrs"`                   // Executor addresses; defaults to grpc_server_addr
+		StickyRouting         bool     `yaml:"sticky_routing"`          // Pin each workspace to one executor, for executors with local state
+		ConnectTimeoutSeconds int      `yaml:"connect_timeout_seconds"` // How long startup waits for every executor to be reachable; default 10
+	} `yaml:"executors"`
+	MaxParallelRegions      int      `yaml:"max_parallel_regions"`         // Concurrency limit for multi-region and fan-out requests
+	MaxConcurrentLLMCalls   int      `yaml:"max_concurrent_llm_calls"`     // Simultaneous Anthropic calls; further calls queue
+	ValidateAPIKeyOnStart   bool     `yaml:"validate_api_key_on_start"`    // Fail startup if Anthropic rejects anthropic_api_key; costs a one-token call, so off for air-gapped setups
+	MaxLLMCostUSDPerRequest float64  `yaml:"max_llm_cost_usd_per_request"` // Stop retrying before a request's LLM spend exceeds this; 0 disables
+	MaxDescriptionLength    int      `yaml:"max_description_length"`       // Longer descriptions are rejected with 400; 0 disables
+	MaxCodeBytes            int      `yaml:"max_code_bytes"`               // Larger generated or existing code is rejected before it reaches the executor; default 1 MiB
+	ProtectedResourceTypes  []string `yaml:"protected_resource_types"`     // Resource types (globs allowed) an apply must never replace
+	AllowedResourceTypes    []string `yaml:"allowed_resource_types"`       // Resource types (globs allowed) code may use, in every context; empty allows all
+	AdminToken              string   `yaml:"admin_token"`                  // Required in X-Admin-Token to use admin-only flags
+	WebhookSecret           string   `yaml:"webhook_secret"`               // Signs job callback bodies with HMAC-SHA256 in X-Signature-256 when set
+	CallbackAllowedHosts    []string `yaml:"callback_allowed_hosts"`       // Hosts callback_url may name even though they are, or resolve to, private, loopback or link-local addresses
+	RateLimitPerMinute      int      `yaml:"rate_limit_per_minute"`        // /terraform requests per minute per client (bearer token, else IP); 0 disables
+	RateLimitBurst          int      `yaml:"rate_limit_burst"`             // Requests a client may make at once; defaults to rate_limit_per_minute
+	LogLevel                string   `yaml:"log_level"`                    // debug, info (default), warn or error; code and terraform output are logged at debug
+	LogFormat               string   `yaml:"log_format"`                   // text (default) or json
+	OutputTruncation        struct {
+		MaxLines  int `yaml:"max_lines"`  // Truncate outputs longer than this; 0 disables truncation
+		HeadLines int `yaml:"head_lines"` // Lines kept from the start
+		TailLines int `yaml:"tail_lines"` // Lines kept from the end
+	} `yaml:"output_truncation"`
+	ArtifactTTLSeconds        int                       `yaml:"artifact_ttl_seconds"` // How long full outputs are kept for /artifacts
+	CodeTTLSeconds            int                       `yaml:"code_ttl_seconds"`     // How long code is kept by code_id; 0 keeps it forever
+	PlanTTLSeconds            int                       `yaml:"plan_ttl_seconds"`     // How long a plan can be applied by plan_id; default 24 hours
+	Store                     StoreConfig               `yaml:"store"`
+	History                   HistoryConfig             `yaml:"history"`
+	GenerationCacheTTLSeconds int                       `yaml:"generation_cache_ttl_seconds"` // 0 disables the generation cache
+	WorkspaceCacheTTLSeconds  int                       `yaml:"workspace_cache_ttl_seconds"`  // How long workspace code read from executors is cached; 0 disables
+	LockTimeoutSeconds        int                       `yaml:"lock_timeout_seconds"`         // How long a request waits for another run on its workspace before failing with 409; default 30
+	ModelPricing              map[string]ModelPricing   `yaml:"model_pricing"`                // USD per million tokens, by model; Anthropic models are built in, other providers need theirs here
+	DefaultModel              string                    `yaml:"default_model"`                // Model used when a request doesn't set one; must have pricing
+	ResourceNamePattern       string                    `yaml:"resource_name_pattern"`        // Regex every resource name attribute must match
+	ErrorResourcePattern      string                    `yaml:"error_resource_pattern"`       // Regex whose first group is the failing resource in terraform errors
+	ImplicitCodeReuse         bool                      `yaml:"implicit_code_reuse"`          // Legacy: an apply without description reuses the existing code without reuse_existing_code
+	TimeoutSeconds            int                       `yaml:"timeout_seconds"`              // Timeout for each LLM call and each executor call other than actions; default 120
+	ActionTimeoutSeconds      map[Action]int            `yaml:"action_timeout_seconds"`       // Executor call timeout by action; defaults: plan, import and refresh 10m, apply and destroy 30m, graph and validate 2m, fmt 1m
+	RejectUnintendedChanges   bool                      `yaml:"reject_unintended_changes"`    // Regenerate when a modification changes resources the description doesn't mention
+	WarningsAsErrors          []string                  `yaml:"warnings_as_errors"`           // Regexes; plan, apply and validate warnings matching one fail the attempt and are fixed by regeneration, e.g. "(?i)deprecated"
+	RedactPatterns            []string                  `yaml:"redact_patterns"`              // Extra secret regexes masked in logs, events and responses; a first group is kept and the quoted value after it masked, e.g. "ghp_[A-Za-z0-9]{36}"
+	EmptyGenerationRetries    int                       `yaml:"empty_generation_retries"`     // Extra generation calls, with a stricter prompt, when the model returns no usable code; 0 disables
+	FormatGeneratedCode       bool                      `yaml:"format_generated_code"`        // Run terraform fmt on code once it is in the workspace, so stored code is canonical
+	QuotaHints                []QuotaHintRule           `yaml:"quota_hints"`                  // Extra provider quota error patterns, checked before the built-in ones
+	DescriptionLanguage       DescriptionLanguageConfig `yaml:"description_language"`         // Detect, and optionally translate, descriptions not in the target language
+	Features                  FeatureOverrides          `yaml:"features"`                     // Deployment-wide feature flags; contexts can override them
+	Telemetry                 TelemetryConfig           `yaml:"telemetry"`
+	OTELEndpoint              string                    `yaml:"otel_endpoint"` // host:port of an OTLP/HTTP collector to export traces to; shorthand for telemetry.traces
+	Eviction                  EvictionConfig            `yaml:"eviction"`
+	Lint                      LintConfig                `yaml:"lint"`               // tflint, checkov and tfsec runs on generated code before plans and applies
+	ValidationWebhook         ValidationWebhookConfig   `yaml:"validation_webhook"` // External allow/deny check run before every apply
+	CostEstimation            CostEstimationConfig      `yaml:"cost_estimation"`    // Monthly cost estimate of successful plans
+	TerraformUpgrade          struct {
+		Enabled bool `yaml:"enabled"` // Let the executor upgrade Terraform when state was written by a newer version
+	} `yaml:"terraform_upgrade"`
+	ErrorExplanationTTLSeconds int `yaml:"error_explanation_ttl_seconds"` // How long explain_error explanations are cached; default 7 days
+	MaxGraphNodes              int `yaml:"max_graph_nodes"`               // Nodes returned in a parsed graph before it is truncated; default 500
+	Sessions                   struct {
+		TTLSeconds int `yaml:"ttl_seconds"` // How long an unused session is kept; default 24 hours
+		MaxTurns   int `yaml:"max_turns"`   // Earlier requests given to the model; default 10
+	} `yaml:"sessions"`
+	Jobs struct {
+		Workers    int `yaml:"workers"`     // Async requests run at once; default 4
+		QueueSize  int `yaml:"queue_size"`  // Async requests waiting for a worker before more are refused with 503; default 100
+		TTLSeconds int `yaml:"ttl_seconds"` // How long job results are kept for /jobs; default 24 hours
+	} `yaml:"jobs"`
+	AutoApply struct {
+		ConfidenceThreshold      float64 `yaml:"confidence_threshold"`        // Minimum critique confidence to auto-apply; default 0.9
+		AllowWithoutPolicyChecks bool    `yaml:"allow_without_policy_checks"` // Auto-apply in contexts with policy checks turned off
+	} `yaml:"auto_apply"`
+	Retry struct {
+		MaxAttempts     *int   `yaml:"max_attempts"`      // Attempts per request, including the first; 1 disables retries; default 5
+		DelaySeconds    *int   `yaml:"delay_seconds"`     // Wait between attempts, or the base delay with exponential backoff; default 3
+		Backoff         string `yaml:"backoff"`           // "constant" (default) or "exponential", which doubles the delay each attempt, with jitter
+		MaxDelaySeconds int    `yaml:"max_delay_seconds"` // Cap on exponential delays; default 60
+	} `yaml:"retry"`
+	Server struct {
+		Port                   int `yaml:"port"`
+		ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"` // How long SIGINT/SIGTERM waits for in-flight requests and async jobs, such as applies, to finish; default 5 minutes
 	} `yaml:"server"`
 }
 
 type TerraformRequest struct {
-	Description string `json:"description"`
-	Context     string `json:"context"`
-	Workspace   string `json:"workspace"`
-	Action      string `json:"action"` // "plan", "apply", or "destroy"
+	Description       string            `json:"description"`
+	Context           string            `json:"context"`
+	Workspace         string            `json:"workspace"`
+	Action            Action            `json:"action"`                        // "plan", "apply", "destroy", "graph", "validate", "fmt", "import" or "refresh"
+	Regions           []string          `json:"regions,omitempty"`             // Run once per region in "<workspace>-<region>" workspaces
+	Workspaces        []string          `json:"workspaces,omitempty"`          // Apply one generated config to all of these workspaces, all or nothing
+	Force             bool              `json:"force,omitempty"`               // Apply even if protected resources are replaced; admin only
+	Debug             bool              `json:"debug,omitempty"`               // Include routing and execution details in the response
+	PreviewChanges    bool              `json:"preview_changes,omitempty"`     // Only describe the planned changes; resubmit without it to proceed
+	Confirm           bool              `json:"confirm,omitempty"`             // Confirms a destroy when the context requires it
+	AutoApply         bool              `json:"auto_apply,omitempty"`          // Plan, then apply if the plan critique is confident enough and policy checks pass
+	CanonicalCode     bool              `json:"canonical_code,omitempty"`      // Also return the code with blocks and attributes in canonical order
+	MaxLLMCostUSD     float64           `json:"max_llm_cost_usd,omitempty"`    // Per-request LLM spend cap; cannot raise max_llm_cost_usd_per_request
+	ReuseExistingCode bool              `json:"reuse_existing_code,omitempty"` // Run the workspace's current code instead of generating new code
+	IncludePlan       bool              `json:"include_plan,omitempty"`        // With apply, also return the changes planned before applying
+	ExplainError      bool              `json:"explain_error,omitempty"`       // On failure, add a plain-English explanation; costs an extra LLM call unless cached
+	SessionID         string            `json:"session_id,omitempty"`          // Continue a conversation; earlier requests of the session are given to the model
+	Model             string            `json:"model,omitempty"`               // Anthropic model for code generation; defaults to default_model
+	Provider          string            `json:"provider,omitempty"`            // Cloud provider whose examples and conventions the prompts use: aws, digitalocean or gcp; generic when empty
+	MaxAttempts       int               `json:"max_attempts,omitempty"`        // Overrides retry.max_attempts for this request
+	RetryDelaySeconds *int              `json:"retry_delay_seconds,omitempty"` // Overrides retry.delay_seconds for this request
+	TimeoutSeconds    int               `json:"timeout_seconds,omitempty"`     // Timeout for each LLM and executor call, actions included; overrides the configured timeouts
+	NoCache           bool              `json:"no_cache,omitempty"`            // Bypass the generation, error explanation and workspace code caches, refreshing them
+	CodeID            string            `json:"code_id,omitempty"`             // Run exactly the code with this ID from an earlier response, without regenerating
+	PlanID            string            `json:"plan_id,omitempty"`             // With apply, apply the approved plan with this ID from an earlier plan response
+	DryRun            bool              `json:"dry_run,omitempty"`             // Return the code that would run without executing it; pass the returned code_id to run it
+	Async             bool              `json:"async,omitempty"`               // Respond 202 with a job_id at once and run in the background; poll /jobs/{job_id} for the result
+	CallbackURL       string            `json:"callback_url,omitempty"`        // With async, POST the final response here when the job finishes, signed with webhook_secret
+	Variables         map[string]string `json:"variables,omitempty"`           // Terraform variable values written to terraform.tfvars; generated code references them as var.<name>
+	Address           string            `json:"address,omitempty"`             // With import, the address of the resource in the code, e.g. aws_instance.web
+	ID                string            `json:"id,omitempty"`                  // With import, the provider ID of the existing resource
+
+	features FeatureFlags // Resolved for the request's context by handleTerraformRequest
+	session  *session     // Loaded by handleTerraformRequest for single-workspace requests
+
+	previousCode string // Workspace code the request modifies, for the unintended changes check
+	reusedCode   bool   // The code to run is the user's, not LLM output: reused, or from code_id or plan_id
 }
 
 type TerraformResponse struct {
+	Success     bool         `json:"success"`
+	Code        string       `json:"code,omitempty"`
+	CodeID      string       `json:"code_id,omitempty"` // Content address of code; pass as code_id to run it again
+	Diff        string       `json:"diff,omitempty"`    // Unified diff from the workspace's previous main.tf to code; omitted when it had none
+	PlanID      string       `json:"plan_id,omitempty"` // Set for successful plans; pass as plan_id with apply once the plan is approved
+	Output      string       `json:"output"`
+	PlanOutput  string       `json:"plan_output,omitempty"`  // Plan phase output, set for apply
+	ApplyOutput string       `json:"apply_output,omitempty"` // Apply phase output, set for apply
+	Error       string       `json:"error,omitempty"`
+	Warnings    []string     `json:"warnings,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	InitOutput  string       `json:"init_output,omitempty"` // terraform init output, kept apart from the plan/apply output
+	InitError   string       `json:"init_error,omitempty"`  // Set when terraform init failed; the code was not regenerated
+	TimedOut    bool         `json:"timed_out,omitempty"`   // The executor call ran out of time; the code was retried as is
+	NoChanges   bool         `json:"no_changes,omitempty"`  // The plan found nothing to change; an apply was skipped
+
+	CanonicalCode        string                        `json:"canonical_code,omitempty"`         // Code with blocks and attributes sorted, for stable diffs
+	BlockedResources     []string                      `json:"blocked_resources,omitempty"`      // Protected resources the plan would replace
+	ValidationWebhook    *WebhookDecision              `json:"validation_webhook,omitempty"`     // Verdict of the validation webhook when it denied the apply
+	Artifacts            map[string]string             `json:"artifacts,omitempty"`              // Artifact IDs of truncated outputs, by field name
+	CacheSavings         *CacheSavings                 `json:"cache_savings,omitempty"`          // LLM usage avoided by the generation cache
+	FromCache            bool                          `json:"from_cache,omitempty"`             // Part of the response was served from a cache, see cache_hits
+	CacheHits            []string                      `json:"cache_hits,omitempty"`             // Caches that served part of the response
+	LLMCostUSD           float64                       `json:"llm_cost_usd,omitempty"`           // LLM spend of the request, from token usage and model pricing
+	CostBudgetExceeded   bool                          `json:"cost_budget_exceeded,omitempty"`   // Retries stopped because another attempt would exceed the cost cap
+	Timings              *Timings                      `json:"timings,omitempty"`                // Where the request's time went
+	NameViolations       []string                      `json:"name_violations,omitempty"`        // Resources whose name breaks resource_name_pattern
+	MissingVariables     []string                      `json:"missing_variables,omitempty"`      // Variables the code uses that the workspace does not declare
+	UnintendedChanges    []string                      `json:"unintended_changes,omitempty"`     // Resources changed or removed although the description doesn't mention them
+	LintFindings         []LintFinding                 `json:"lint_findings,omitempty"`          // Static analysis findings for the code, when lint tools are configured
+	RunID                string                        `json:"run_id,omitempty"`                 // History run ID, usable with /history/compare
+	SessionID            string                        `json:"session_id,omitempty"`             // Pass as session_id to continue the conversation
+	ChangePreview        string                        `json:"change_preview,omitempty"`         // Planned changes in plain language, for preview_changes requests
+	PlannedChanges       []PlannedChange               `json:"planned_changes,omitempty"`        // Changes planned before the apply, for include_plan requests
+	ImportOutput         string                        `json:"import_output,omitempty"`          // Import phase output, set for import; output is the plan that followed
+	Drift                []DriftedResource             `json:"drift,omitempty"`                  // Resources changed outside terraform, for refresh requests
+	OutputNames          []string                      `json:"output_names,omitempty"`           // Outputs declared by the code, available after apply
+	Outputs              map[string]string             `json:"outputs,omitempty"`                // Output values after a successful apply; non-string values are JSON
+	ResourceResults      map[string]ResourceResult     `json:"resource_results,omitempty"`       // Outcome of each resource touched by an apply or destroy
+	Placements           map[string]ResourcePlacement  `json:"placements,omitempty"`             // Provider and region each resource uses, for plans and applies
+	CostEstimate         *CostEstimate                 `json:"cost_estimate,omitempty"`          // Estimated monthly cost of a successful plan, when cost_estimation is configured
+	Graph                *ResourceGraph                `json:"graph,omitempty"`                  // Parsed dependency graph for graph requests; the DOT is in output
+	FollowUps            []FollowUp                    `json:"follow_ups,omitempty"`             // Ready-to-submit requests for likely next steps
+	AutoApply            *AutoApplyDecision            `json:"auto_apply,omitempty"`             // Outcome and rationale of an auto_apply request
+	ErrorCode            string                        `json:"error_code,omitempty"`             // Classified cause of a failure
+	Suggestions          []string                      `json:"suggestions,omitempty"`            // Next steps for a failure, based on error_code
+	QuotaHint            *QuotaHint                    `json:"quota_hint,omitempty"`             // Provider limit that was hit and how to raise it
+	StateVersionMismatch *StateVersionMismatch         `json:"state_version_mismatch,omitempty"` // Set when the state was written by a newer Terraform
+	FailureAnalysis      *FailureAnalysis              `json:"failure_analysis,omitempty"`       // Links between errors, resources, code lines and request phrases
+	ErrorExplanation     string                        `json:"error_explanation,omitempty"`      // Plain-English explanation of the failure, for explain_error requests
+	ChatSummary          string                        `json:"chat_summary,omitempty"`           // The outcome in a sentence or two, for chat clients
+	Regions              map[string]*TerraformResponse `json:"regions,omitempty"`                // Per-region results for multi-region requests
+	Workspaces           map[string]*TerraformResponse `json:"workspaces,omitempty"`             // Per-workspace results for fan-out applies
+	Transaction          string                        `json:"transaction,omitempty"`            // Fan-out outcome: committed, rolled_back or rollback_failed
+	RolledBack           bool                          `json:"rolled_back,omitempty"`            // The workspace was restored after a failed fan-out apply
+	Debug                *DebugInfo                    `json:"debug,omitempty"`                  // Set when the request asked for debug
+
+	planJSON string // Plan of a plan, or that preceded an apply
+	planFile string // Saved plan of a plan run with withSavePlan
+}
+
+// DebugInfo carries details about how a request was handled.
+type DebugInfo struct {
+	Executor    string           `json:"executor,omitempty"`    // Executor holding the workspace, with sticky routing
+	Generations []GenerationInfo `json:"generations,omitempty"` // Model calls in attempt order, with stop reasons
+	Features    *FeatureFlags    `json:"features,omitempty"`    // Effective feature flags of the context
+}
+type LockFileRequest struct {
+	Context   string `json:"context"`
+	Workspace string `json:"workspace"`
+	Content   string `json:"content"` // New lock file, for PUT; POST regenerates it instead
+}
+
+type LockFileResponse struct {
 	Success bool   `json:"success"`
-	Code    string `json:"code,omitempty"`
-	Output  string `json:"output"`
+	Content string `json:"content,omitempty"`
 	Error   string `json:"error,omitempty"`
 }
 
 type Service struct {
-	anthropicClient *anthropic.Client
-	executorClient  pb.ExecutorClient
-	config          Config
+	generator      CodeGenerator
+	executorClient pb.ExecutorClient
+	executors      *executorPool
+	store          Store
+	history        HistoryStore
+
+	resourceNamePattern *regexp.Regexp
+	llmLimiter          *llmLimiter
+	workspaceCache      *workspaceCache
+	workspaceLocks      *workspaceLocks
+	metrics             *metrics
+
+	errorResourcePattern *regexp.Regexp
+	quotaHints           []quotaHintMatcher
+	warningsAsErrors     []*regexp.Regexp
+	redactPatterns       []*regexp.Regexp
+	costEstimator        CostEstimator // nil when cost_estimation is off
+	rateLimiter          *rateLimiter  // nil when rate_limit_per_minute is 0
+	jobs                 *jobQueue
+	callbackClient       *http.Client // Refuses to connect to internal addresses, see newCallbackClient
+	cooldownMu           sync.Mutex   // Serializes reserving destructive operations, so two requests can't both pass the cooldown
+
+	configMu      sync.RWMutex
+	currentConfig *Config // Replaced, never modified, by reloadConfig
+	configPath    string  // File reloadConfig reads; reloading is off when empty
 }
 
-func generateModificationPrompt(description string, existingCode string) string {
+// config returns the current config. Callers must not modify it.
+func (s *Service) config() *Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.currentConfig
+}
+
+func generateModificationPrompt(description string, existingCode string, provider string) string {
 	return fmt.Sprintf(`You are a DevOps engineer. There is existing infrastructure that needs modification.
     
 	Current Infrastructure:
@@ -74,13 +379,14 @@ func generateModificationPrompt(description string, existingCode string) string
 	2. Keep all other resources unchanged
 	3. Preserve resource names and references
 	4. Use existing naming conventions
-	...`,
+	...%s`,
 		existingCode,
 		description,
+		providerGuidance(provider),
 	)
 }
 
-func generateErrorPrompt(originalDescription string, code string, tfError *TerraformError) string {
+func generateErrorPrompt(originalDescription string, code string, tfError *TerraformError, provider string) string {
 	return fmt.Sprintf(`You are a DevOps engineer. Previous Terraform code generated an error. Please fix and regenerate the code.
 
 	Original Task: %s
@@ -93,10 +399,10 @@ func generateErrorPrompt(originalDescription string, code string, tfError *Terra
 
 	Error:
 	%s
-
+%s%s
 	Requirements:
 	1. Analyze the Terraform execution output and error message
-	2. Fix the issues identified in the error messages
+	2. Fix ALL of the issues identified in the error messages, not just the first
 	3. Generate ONLY resource and output blocks
 	4. DO NOT include:
 	- provider configurations
@@ -105,16 +411,81 @@ func generateErrorPrompt(originalDescription string, code string, tfError *Terra
 	- locals
 	5. DO NOT include any explanations or comments
 	6. DO NOT include code block markers
-
+%s
 	Output ONLY the corrected Terraform code.`,
 		originalDescription,
 		code,
 		tfError.TerraformOutput,
 		tfError.Message,
+		formatErrors(tfError.Errors),
+		formatDiagnostics(tfError.Diagnostics),
+		providerGuidance(provider),
 	)
 }
 
-func generateInitialInfrastructurePrompt(description string) string {
+// formatErrors renders the errors to fix as a numbered prompt section, each
+// with the resource and line it points at, or "" when there are none.
+func formatErrors(causes []failureCause) string {
+	if len(causes) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\tErrors to fix:\n")
+	for i, e := range causes {
+		fmt.Fprintf(&b, "\t%d. %s", i+1, e.Summary)
+		var where []string
+		if e.Resource != "" {
+			where = append(where, "resource "+e.Resource)
+		}
+		if e.Line > 0 {
+			file := e.File
+			if file == "" {
+				file = "main.tf"
+			}
+			where = append(where, fmt.Sprintf("%s line %d", file, e.Line))
+		}
+		if len(where) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(where, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatDiagnostics renders diagnostics as a prompt section, or "" when there are none.
+func formatDiagnostics(diagnostics []Diagnostic) string {
+	if len(diagnostics) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\tDiagnostics:\n")
+	for _, d := range diagnostics {
+		location := ""
+		if d.Range != nil {
+			location = fmt.Sprintf(" (%s:%d:%d)", d.Range.Filename, d.Range.Start.Line, d.Range.Start.Column)
+		}
+		fmt.Fprintf(&b, "\t- %s: %s%s", d.Severity, d.Summary, location)
+		if d.Detail != "" {
+			fmt.Fprintf(&b, ": %s", d.Detail)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// generateStricterPrompt repeats a generation prompt after the model returned
+// empty or unparseable output, with a firmer instruction each attempt.
+func generateStricterPrompt(prompt string, attempt int) string {
+	instruction := "Your previous response was empty or not valid Terraform HCL. If the task is about infrastructure, respond with valid Terraform HCL blocks."
+	if attempt > 1 {
+		instruction = fmt.Sprintf("Your previous %d responses were empty or not valid Terraform HCL. Respond with ONLY valid Terraform HCL blocks: no prose, no markdown, no code block markers. Return an empty response only if the task is clearly not about infrastructure.", attempt)
+	}
+	return prompt + "\n\n\t" + instruction
+}
+
+func generateInitialInfrastructurePrompt(description string, provider string) string {
 	return fmt.Sprintf(`You are a DevOps engineer specialized in writing Terraform code. You will receive an infrastructure-related task and must output ONLY the Terraform resource and output blocks - nothing else.
 
 	Task description:
@@ -132,39 +503,121 @@ func generateInitialInfrastructurePrompt(description string) string {
 		* data sources (unless specifically required)
 	- DO NOT include any explanations or comments
 	- DO NOT include code block markers (terraform)
+%s
+	%s
 
-	Example task: "Create a droplet in Frankfurt region with 1GB RAM"
-	Example output:
-	resource "digitalocean_droplet" "web" {
-	name   = "web-1"
-	region = "fra1"
-	size   = "s-1vcpu-1gb"
-	image  = "ubuntu-20-04-x64"
+	Your response should contain ONLY Terraform code, nothing else.`, description, providerGuidance(provider), providerExample(provider))
+}
+
+func NewService(config Config) (*Service, error) {
+	generator, err := newCodeGenerator(config)
+	if err != nil {
+		return nil, err
+	}
+	if anthropicGenerator, ok := generator.(*AnthropicGenerator); ok && config.ValidateAPIKeyOnStart {
+		validateCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.TimeoutSeconds)*time.Second)
+		err := anthropicGenerator.validateAPIKey(validateCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	output "droplet_ip" {
-	value = digitalocean_droplet.web.ipv4_address
+	addrs := config.Executors.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{config.GRPCServerAddr}
+	}
+	creds, err := executorCredentials(config)
+	if err != nil {
+		return nil, err
+	}
+	executors, err := newExecutorPool(addrs, config.Executors.StickyRouting, creds, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to gRPC server: %v", err)
+	}
+	connectCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Executors.ConnectTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := executors.waitReady(connectCtx); err != nil {
+		executors.Close()
+		return nil, fmt.Errorf("failed to connect to gRPC server: %w", err)
 	}
 
-	Your response should contain ONLY Terraform code, nothing else.`, description)
-}
+	executorClient := pb.NewExecutorClient(timeoutConn{
+		ClientConnInterface: executors,
+		timeout:             time.Duration(config.TimeoutSeconds) * time.Second,
+	})
 
-func NewService(config Config) (*Service, error) {
-	anthropicClient := anthropic.NewClient(
-		option.WithAPIKey(config.AnthropicAPIKey),
-	)
+	store, err := NewStore(config.Store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store: %v", err)
+	}
+	history, err := newHistoryStore(config.History, config.Store, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create history: %v", err)
+	}
+
+	var resourceNamePattern *regexp.Regexp
+	if config.ResourceNamePattern != "" {
+		resourceNamePattern, err = regexp.Compile(config.ResourceNamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource_name_pattern: %v", err)
+		}
+	}
 
-	conn, err := grpc.Dial(config.GRPCServerAddr, grpc.WithInsecure())
+	quotaHints, err := compileQuotaHints(config.QuotaHints)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to gRPC server: %v", err)
+		return nil, err
+	}
+
+	errorResourcePattern, err := regexp.Compile(config.ErrorResourcePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid error_resource_pattern: %v", err)
+	}
+	if errorResourcePattern.NumSubexp() < 1 {
+		return nil, fmt.Errorf("error_resource_pattern must have a capture group for the resource address")
+	}
+
+	warningsAsErrors, err := compileWarningsAsErrors(config.WarningsAsErrors)
+	if err != nil {
+		return nil, err
+	}
+	redactPatterns, err := compileRedactPatterns(config.RedactPatterns)
+	if err != nil {
+		return nil, err
 	}
 
-	executorClient := pb.NewExecutorClient(conn)
+	costEstimator, err := newCostEstimator(config.CostEstimation)
+	if err != nil {
+		return nil, err
+	}
+
+	var limiter *rateLimiter
+	if config.RateLimitPerMinute > 0 {
+		limiter = newRateLimiter(config.RateLimitPerMinute, config.RateLimitBurst)
+	}
 
+	m := newMetrics()
 	return &Service{
-		anthropicClient: anthropicClient,
-		executorClient:  executorClient,
-		config:          config,
+		generator:           generator,
+		executorClient:      executorClient,
+		executors:           executors,
+		currentConfig:       &config,
+		store:               store,
+		history:             history,
+		resourceNamePattern: resourceNamePattern,
+		llmLimiter:          newLLMLimiter(config.MaxConcurrentLLMCalls, m),
+		workspaceCache:      newWorkspaceCache(time.Duration(config.WorkspaceCacheTTLSeconds) * time.Second),
+		metrics:             m,
+		workspaceLocks:      newWorkspaceLocks(time.Duration(config.LockTimeoutSeconds) * time.Second),
+
+		errorResourcePattern: errorResourcePattern,
+		quotaHints:           quotaHints,
+		warningsAsErrors:     warningsAsErrors,
+		redactPatterns:       redactPatterns,
+		costEstimator:        costEstimator,
+		rateLimiter:          limiter,
+		jobs:                 newJobQueue(config.Jobs.Workers, config.Jobs.QueueSize),
+		callbackClient:       newCallbackClient(config.CallbackAllowedHosts),
 	}, nil
 }
 
@@ -189,137 +642,563 @@ func (s *Service) ensureContextAndWorkspace(ctx context.Context, contextName, wo
 	return nil
 }
 
-func (s *Service) generateTerraformCode(ctx context.Context, description string, previousError *TerraformError, existingCode string) (string, error) {
+func (s *Service) generateTerraformCode(ctx context.Context, model, provider string, description string, previousError *TerraformError, existingCode string) (*generation, error) {
 	var prompt string
 	if previousError != nil {
-		prompt = generateErrorPrompt(description, existingCode, previousError)
+		prompt = generateErrorPrompt(description, existingCode, previousError, provider)
 	} else if existingCode != "" {
-		prompt = generateModificationPrompt(description, existingCode)
+		prompt = generateModificationPrompt(description, existingCode, provider)
 	} else {
-		prompt = generateInitialInfrastructurePrompt(description)
+		prompt = generateInitialInfrastructurePrompt(description, provider)
 	}
 
-	log.Printf("\n=== LLM Request ===\nDescription: %s\nPrompt:\n%s\n", description, prompt)
+	s.runLogger(ctx).Debug("LLM request", "description", description, "prompt", prompt)
 
-	message, err := s.anthropicClient.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_5SonnetLatest),
-		MaxTokens: anthropic.F(int64(2048)),
-		Messages: anthropic.F([]anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
-		}),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to generate code: %v", err)
+	ctx, span := tracer.Start(ctx, "llm.generate", trace.WithAttributes(attribute.String("model", model)))
+	defer span.End()
+
+	// Error fixes aren't cached: a fix that didn't work would be replayed on
+	// every later attempt at the same error
+	cacheable := previousError == nil
+	cacheKey := generationCacheKey(model, prompt)
+	if cacheable {
+		if gen := s.cachedGeneration(ctx, cacheKey); gen != nil {
+			recordCacheHit(ctx, CacheGeneration)
+			s.emitGenerationEvent(ctx, prompt, gen)
+			return gen, nil
+		}
+	}
+
+	var discardedInput, discardedOutput int64
+	var gen *generation
+	for attempt := 0; ; attempt++ {
+		attemptPrompt := prompt
+		if attempt > 0 {
+			attemptPrompt = generateStricterPrompt(prompt, attempt)
+		}
+		var err error
+		gen, err = s.complete(ctx, model, attemptPrompt, 2048)
+		if err != nil {
+			setSpanStatus(span, nil, err)
+			return nil, fmt.Errorf("failed to generate code: %v", err)
+		}
+
+		if gen.StopReason != string(anthropic.MessageStopReasonEndTurn) {
+			s.runLogger(ctx).Warn("generation stopped early, code may be incomplete", "stop_reason", gen.StopReason)
+		}
+
+		gen.Code = extractCode(gen.Code)
+
+		if usableCode(gen.Code) || attempt >= s.config().EmptyGenerationRetries {
+			break
+		}
+		s.runLogger(ctx).Warn("generation returned no usable code, retrying with a stricter prompt", "retry", attempt+1, "max_retries", s.config().EmptyGenerationRetries)
+		discardedInput += gen.InputTokens
+		discardedOutput += gen.OutputTokens
 	}
+	// Discarded attempts are billed too
+	gen.InputTokens += discardedInput
+	gen.OutputTokens += discardedOutput
 
-	var code string
-	for _, content := range message.Content {
-		code += content.Text
+	if cacheable && usableCode(gen.Code) {
+		s.cacheGeneration(ctx, cacheKey, gen)
 	}
+	s.emitGenerationEvent(ctx, prompt, gen)
 
-	code = strings.TrimPrefix(code, "```hcl")
-	code = strings.TrimPrefix(code, "```terraform")
-	code = strings.TrimSuffix(code, "```")
-	code = strings.TrimSpace(code)
+	return gen, nil
+}
 
-	return code, nil
+// usableCode reports whether generated code is non-empty HCL with at least
+// one block.
+func usableCode(code string) bool {
+	if code == "" {
+		return false
+	}
+	body, err := parseHCL(code)
+	return err == nil && len(body.Blocks) > 0
 }
 
-func (s *Service) executeTerraformAction(ctx context.Context, action, description, code, contextName, workspace string) (*TerraformResponse, error) {
-	logger := log.New(os.Stdout, "", log.LstdFlags)
-	logSection := func(title string) {
-		logger.Printf("\n%s %s %s\n", strings.Repeat("=", 10), title, strings.Repeat("=", 10))
+// complete sends a single-message prompt to the model and returns the reply
+// text with its token usage.
+func (s *Service) complete(ctx context.Context, model, prompt string, maxTokens int64) (*generation, error) {
+	if err := s.llmLimiter.acquire(ctx); err != nil {
+		return nil, err
 	}
+	defer s.llmLimiter.release()
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout(ctx, time.Duration(s.config().TimeoutSeconds)*time.Second))
+	defer cancel()
+	start := time.Now()
+	gen, err := s.generator.Complete(ctx, model, prompt, maxTokens)
+	s.metrics.observeLLMCall(start, err)
+	return gen, err
+}
 
-	retryConfig := RetryConfig{
-		MaxAttempts: 5,
-		Delay:       time.Second * 3,
+// auxiliaryModel returns the model for a helper call such as a critique or
+// translation: preferred with the Anthropic provider, the default model with
+// other providers, whose model names differ.
+func (s *Service) auxiliaryModel(preferred anthropic.Model) string {
+	if s.config().LLMProvider == ProviderAnthropic {
+		return string(preferred)
 	}
+	return s.config().DefaultModel
+}
 
-	logSection("Initial Configuration")
-	logger.Printf("Action: %s\nContext: %s\nWorkspace: %s", action, contextName, workspace)
-	logger.Printf("Initial Code:\n%s", code)
+func (s *Service) executeTerraformAction(ctx context.Context, req TerraformRequest, code string, usage *llmUsage, timings *Timings) (*TerraformResponse, error) {
+	action, description, contextName, workspace := req.Action, req.Description, req.Context, req.Workspace
+	runLogger := s.runLogger(ctx).With("action", string(action), "context", contextName, "workspace", workspace)
+	retryConfig := s.retryConfig(req)
+	runLogger.Info("run started", "max_attempts", retryConfig.MaxAttempts)
+	runLogger.Debug("initial code", "code", code)
 
 	var lastError error
 	lastCode := code
 	var response *TerraformResponse
+	var lintFindings []LintFinding // For lastCode
 
 	for attempt := 0; attempt < retryConfig.MaxAttempts; attempt++ {
-		logSection(fmt.Sprintf("Attempt %d/%d", attempt+1, retryConfig.MaxAttempts))
-
-		logSection("Workspace Preparation")
-		if err := s.prepareWorkspace(ctx, contextName, workspace, lastCode); err != nil {
-			logger.Printf("❌ Workspace preparation failed: %v", err)
-			return nil, err
+		logger := runLogger.With("attempt", attempt+1)
+		logger.Info("attempt started")
+		if attempt > 0 {
+			s.metrics.observeRetry(action)
+		}
+		at := timings.newAttempt(attempt + 1)
+		attemptStart := time.Now()
+
+		if budget := s.costBudget(req); attempt > 0 && response != nil && budget > 0 && usage.CostUSD+usage.LastCostUSD > budget {
+			logger.Warn("stopping: next generation would exceed the LLM cost budget", "budget_usd", budget, "spent_usd", usage.CostUSD)
+			at.end()
+			response.CostBudgetExceeded = true
+			response.Error = fmt.Sprintf("LLM cost budget of $%.4f would be exceeded by another attempt, spent $%.4f; last error: %s", budget, usage.CostUSD, response.Error)
+			return response, nil
 		}
 
 		if attempt > 0 && response != nil {
-			logSection("Previous Attempt Analysis")
-			logger.Printf("Output:\n%s", response.Output)
-			logger.Printf("Error:\n%s", response.Error)
-
 			tfError := s.parseTerraformError(response)
-			logger.Printf("Parsed Error:\nResource: %s", tfError.Resource)
+			logger.Debug("previous attempt", "output", response.Output, "error", response.Error, "parsed_errors", formatErrors(tfError.Errors))
 
-			newCode, err := s.generateTerraformCode(ctx, description, tfError, lastCode)
+			generationStart := time.Now()
+			gen, err := s.generateTerraformCode(ctx, req.Model, req.Provider, description, tfError, lastCode)
+			at.GenerationMS = msSince(generationStart)
 			if err != nil {
-				logger.Printf("❌ Code generation failed: %v", err)
+				logger.Error("code generation failed", "error", err)
 				lastError = err
-				s.logRetryDelay(logger, retryConfig.Delay)
-				time.Sleep(retryConfig.Delay)
+				at.end()
+				delay := retryConfig.delay(attempt)
+				if !s.waitRetry(ctx, logger, attempt, delay) {
+					break
+				}
 				continue
 			}
+			usage.record(gen, s.config().ModelPricing)
+			newCode := gen.Code
 
-			logSection("Code Changes")
 			if newCode != lastCode {
-				logger.Printf("Changes detected:\nOld:\n%s\n\nNew:\n%s", lastCode, newCode)
+				logger.Debug("code regenerated", "old_code", lastCode, "new_code", newCode)
 			} else {
-				logger.Printf("⚠️ Generated code is identical")
+				logger.Warn("regenerated code is identical")
 			}
 			lastCode = newCode
 		}
 
-		logSection(fmt.Sprintf("Executing %s", action))
-		var err error
-		response, err = s.executeAction(ctx, action, contextName, workspace)
+		var invalid *TerraformResponse
+		if lastCode, invalid = s.validateGeneratedCode(ctx, lastCode, req.features.PolicyChecks, attempt > 0 || !req.reusedCode); invalid != nil {
+			logger.Error("generated code failed validation", "error", invalid.Error)
+			at.end()
+			response = invalid
+			if attempt == retryConfig.MaxAttempts-1 {
+				logger.Warn("all retry attempts exhausted")
+				return response, nil
+			}
+			continue
+		}
+
+		if missing, err := s.missingVariables(ctx, contextName, workspace, lastCode, req.Variables); err != nil {
+			logger.Warn("skipping variables check", "error", err)
+		} else if len(missing) > 0 {
+			logger.Error("code references undeclared variables", "variables", missing)
+			at.end()
+			response = &TerraformResponse{
+				Success:          false,
+				Code:             lastCode,
+				Error:            fmt.Sprintf("code references variables not declared in the workspace: %s; use literal values instead, or supply these variables", strings.Join(missing, ", ")),
+				MissingVariables: missing,
+			}
+			if attempt == retryConfig.MaxAttempts-1 {
+				logger.Warn("all retry attempts exhausted")
+				return response, nil
+			}
+			continue
+		}
+
+		if req.previousCode != "" && s.config().RejectUnintendedChanges {
+			if unintended := unintendedChanges(req.Description, req.previousCode, lastCode); len(unintended) > 0 {
+				logger.Error("code changes resources the request doesn't mention", "resources", unintended)
+				at.end()
+				response = &TerraformResponse{
+					Success:           false,
+					Code:              lastCode,
+					Error:             fmt.Sprintf("code changes or removes resources the request does not mention: %s; keep them exactly as they were", strings.Join(unintended, ", ")),
+					UnintendedChanges: unintended,
+				}
+				if attempt == retryConfig.MaxAttempts-1 {
+					logger.Warn("all retry attempts exhausted")
+					return response, nil
+				}
+				continue
+			}
+		}
+
+		if action == ActionImport {
+			if err := checkImportAddress(lastCode, req.Address); err != nil {
+				logger.Error("import address is not in the code", "address", req.Address, "error", err)
+				at.end()
+				response = &TerraformResponse{
+					Success: false,
+					Code:    lastCode,
+					Error:   err.Error(),
+				}
+				if attempt == retryConfig.MaxAttempts-1 {
+					logger.Warn("all retry attempts exhausted")
+					return response, nil
+				}
+				continue
+			}
+		}
+
+		lintFindings = nil
+		if s.config().Lint.enabled() && (action == ActionPlan || action == ActionApply) {
+			findings, err := s.lintCode(ctx, lastCode)
+			if err != nil {
+				logger.Warn("lint failed", "error", err)
+			}
+			lintFindings = findings
+			if blocking := s.blockingFindings(findings); action == ActionApply && len(blocking) > 0 {
+				var issues []string
+				for _, finding := range blocking {
+					issues = append(issues, finding.String())
+				}
+				logger.Error("lint findings block the apply", "findings", issues)
+				at.end()
+				response = &TerraformResponse{
+					Success:      false,
+					Code:         lastCode,
+					Error:        fmt.Sprintf("static analysis found issues that must be fixed:\n%s", strings.Join(issues, "\n")),
+					LintFindings: findings,
+				}
+				if attempt == retryConfig.MaxAttempts-1 {
+					logger.Warn("all retry attempts exhausted")
+					return response, nil
+				}
+				continue
+			}
+		}
+
+		preparationStart := time.Now()
+		err := s.prepareWorkspace(ctx, contextName, workspace, lastCode, req.Variables)
+		at.PreparationMS = msSince(preparationStart)
 		if err != nil {
-			logger.Printf("❌ Execution failed: %v", err)
+			logger.Error("workspace preparation failed", "error", err)
+			at.end()
+			if !isTimeout(err) && errorClass(err) != errorClassTransient {
+				return nil, err
+			}
+			// Retry the same code: the executor failed, not the code
 			lastError = err
-			s.logRetryDelay(logger, retryConfig.Delay)
-			time.Sleep(retryConfig.Delay)
+			response = nil
+			delay := retryConfig.delay(attempt)
+			if !s.waitRetry(ctx, logger, attempt, delay) {
+				break
+			}
 			continue
 		}
+		if s.config().FormatGeneratedCode && action != ActionFmt {
+			if formatted, err := s.formatWorkspace(ctx, contextName, workspace); err != nil {
+				logger.Warn("skipping formatting", "error", err)
+			} else {
+				lastCode = formatted
+			}
+		}
 
-		if response.Success && response.Error == "" {
-			logger.Printf("✅ Action successful!")
+		executionStart := time.Now()
+		var prePlan *TerraformResponse
+		checkPlan := action == ActionApply && s.checkPlanBeforeApply(req)
+		applyCtx := ctx
+		if action == ActionApply {
+			// An apply with nothing to change succeeds without applying, so
+			// clients can re-issue apply to reconcile
+			planCtx := ctx
+			if checkPlan {
+				planCtx = withSavePlan(ctx)
+			}
+			plan, err := s.executeAction(planCtx, ActionPlan, contextName, workspace)
+			if err != nil {
+				logger.Warn("pre-apply plan failed", "error", err)
+			} else if plan.NoChanges {
+				logger.Info("plan has no changes, skipping apply", "duration", time.Since(attemptStart))
+				at.ExecutionMS = msSince(executionStart)
+				at.end()
+				plan.Code = lastCode
+				plan.PlanOutput = plan.Output
+				plan.LintFindings = lintFindings
+				return plan, nil
+			} else {
+				prePlan = plan
+			}
+		}
+		if checkPlan {
+			var blocked []string
+			var decision *WebhookDecision
+			plan, err := s.savedPlan(ctx, contextName, workspace, prePlan)
+			if err == nil {
+				blocked, err = s.checkProtectedReplacements(req, plan)
+			}
+			if err == nil && len(blocked) == 0 {
+				decision, err = s.checkValidationWebhook(ctx, req, workspace, lastCode, plan)
+			}
+			if err != nil {
+				logger.Error("pre-apply plan check failed", "error", err)
+				lastError = err
+				response = nil
+				at.end()
+				delay := retryConfig.delay(attempt)
+				if !s.waitRetry(ctx, logger, attempt, delay) {
+					break
+				}
+				continue
+			}
+			if len(blocked) > 0 {
+				logger.Error("apply blocked, plan replaces protected resources", "resources", blocked)
+				at.end()
+				return &TerraformResponse{
+					Success:          false,
+					Code:             lastCode,
+					Error:            fmt.Sprintf("apply blocked: plan replaces protected resources: %s", strings.Join(blocked, ", ")),
+					BlockedResources: blocked,
+				}, nil
+			}
+			if decision != nil && !decision.Allow {
+				logger.Error("apply denied by validation webhook", "reasons", decision.Reasons)
+				at.end()
+				return &TerraformResponse{
+					Success:           false,
+					Code:              lastCode,
+					Error:             webhookDeniedError(decision),
+					ValidationWebhook: decision,
+				}, nil
+			}
+			if plan.planFile != "" {
+				applyCtx = withPlanFile(ctx, plan.planFile)
+			}
+		}
+
+		logger.Info("executing")
+		response, err = s.executeAction(applyCtx, action, contextName, workspace)
+		at.ExecutionMS = msSince(executionStart)
+		if err != nil {
+			logger.Error("execution failed", "error", err, "duration", time.Since(attemptStart), "class", errorClass(err))
+			at.end()
+			if errorClass(err) != errorClassTransient {
+				return nil, err
+			}
+			// response is nil, so the next attempt retries the same code
+			// rather than regenerating it
+			lastError = err
+			delay := retryConfig.delay(attempt)
+			if !s.waitRetry(ctx, logger, attempt, delay) {
+				break
+			}
+			continue
+		}
+
+		at.end()
+		response.Diagnostics = parseValidateDiagnostics(response.Output)
+		response.Warnings = lockFileWarnings(response.Output, response.Error, response.InitOutput, response.InitError)
+		for _, warning := range response.Warnings {
+			logger.Warn("lock file", "warning", warning)
+		}
+
+		if mismatch := detectStateVersionMismatch(response.Error, response.Output, response.InitError); mismatch != nil {
+			logger.Error("state was written by a newer Terraform, not regenerating", "state_version", mismatch.StateVersion, "terraform_version", mismatch.TerraformVersion)
+			response = s.resolveStateVersionMismatch(ctx, action, contextName, workspace, mismatch, response)
+			response.Code = lastCode
+			return response, nil
+		}
+
+		if response.TimedOut {
+			// Slow providers and hung executors aren't fixed by new code:
+			// retry the same code
+			logger.Error("execution timed out", "error", response.Error, "duration", time.Since(attemptStart))
+			response.Code = lastCode
+			if attempt == retryConfig.MaxAttempts-1 {
+				logger.Warn("all retry attempts exhausted")
+				return response, nil
+			}
+			lastError = errors.New(response.Error)
+			response = nil
+			delay := retryConfig.delay(attempt)
+			if !s.waitRetry(ctx, logger, attempt, delay) {
+				break
+			}
+			continue
+		}
+
+		if response.InitError != "" {
+			// Provider downloads and version conflicts aren't fixed by new code
+			logger.Error("terraform init failed, not regenerating", "error", response.InitError)
+			response.Success = false
+			if response.Error == "" {
+				response.Error = fmt.Sprintf("terraform init failed: %s", response.InitError)
+			}
 			response.Code = lastCode
 			return response, nil
 		}
 
-		logger.Printf("❌ Attempt failed (Success=%v, Error=%s)", response.Success, response.Error)
+		if response.Success && response.Error == "" && (action == ActionPlan || action == ActionApply || action == ActionValidate) {
+			if promoted := s.promotedWarnings(response.Output, response.PlanOutput); len(promoted) > 0 {
+				logger.Error("warnings treated as errors", "warnings", promoted)
+				response.Success = false
+				response.Error = fmt.Sprintf("warnings treated as errors:\n%s", strings.Join(promoted, "\n\n"))
+			}
+		}
+
+		if response.Success && response.Error == "" {
+			logger.Info("attempt finished", "success", true, "duration", time.Since(attemptStart))
+			if response.Code == "" { // fmt returns the formatted code
+				response.Code = lastCode
+			}
+			response.LintFindings = lintFindings
+			return response, nil
+		}
+
+		logger.Error("attempt finished", "success", false, "error", response.Error, "duration", time.Since(attemptStart))
 
 		if attempt == retryConfig.MaxAttempts-1 {
-			logger.Printf("⚠️ All retry attempts exhausted")
+			logger.Warn("all retry attempts exhausted")
+			response.LintFindings = lintFindings
 			return response, nil
 		}
 
-		s.logRetryDelay(logger, retryConfig.Delay)
-		time.Sleep(retryConfig.Delay)
+		delay := retryConfig.delay(attempt)
+		if !s.waitRetry(ctx, logger, attempt, delay) {
+			break
+		}
 	}
 
 	return response, lastError
 }
 
-func (s *Service) prepareWorkspace(ctx context.Context, contextName, workspace, code string) error {
+// validateGeneratedCode runs static checks on code before it is sent to the
+// executor. Duplicate resource blocks that can be merged are merged, and in
+// LLM output (generated) blocks the prompts forbid are stripped, so the
+// returned code may differ from the input. The user's own code keeps its
+// variable, locals and terraform blocks. It also returns a failed response
+// describing any remaining problems, which the retry loop feeds back into
+// regeneration, or nil when the code passes. Name checks only run with policy
+// checks on.
+func (s *Service) validateGeneratedCode(ctx context.Context, code string, policyChecks, generated bool) (string, *TerraformResponse) {
+	if code == "" {
+		return code, nil
+	}
+	if len(code) > s.config().MaxCodeBytes {
+		return code, &TerraformResponse{
+			Success: false,
+			Error:   fmt.Sprintf("generated code is %d bytes, over the max_code_bytes limit of %d; generate only what the task needs", len(code), s.config().MaxCodeBytes),
+		}
+	}
+
+	if generated {
+		sanitized, removed := sanitizeGeneratedCode(code)
+		var providers []string
+		for _, section := range removed {
+			if strings.HasPrefix(section, "provider ") {
+				providers = append(providers, section)
+			}
+		}
+		if len(providers) > 0 {
+			return code, &TerraformResponse{
+				Success: false,
+				Code:    code,
+				Error:   fmt.Sprintf("generated code configures providers, which the workspace provides: %s; generate only resource and output blocks", strings.Join(providers, ", ")),
+			}
+		}
+		if len(removed) > 0 {
+			s.runLogger(ctx).Warn("stripped blocks from generated code", "blocks", removed)
+			code = sanitized
+		}
+	}
+
+	code, merged, err := mergeDuplicateResources(code)
+	if err != nil {
+		return code, &TerraformResponse{
+			Success: false,
+			Code:    code,
+			Error:   fmt.Sprintf("generated code repeats resource addresses: %v", err),
+		}
+	}
+	if len(merged) > 0 {
+		s.runLogger(ctx).Warn("merged duplicate resource blocks", "resources", merged)
+	}
+
+	checkNames := s.resourceNamePattern != nil && policyChecks
+	if !checkNames && len(s.config().AllowedResourceTypes) == 0 {
+		return code, nil
+	}
+
+	body, err := parseHCL(code)
+	if err != nil {
+		return code, &TerraformResponse{
+			Success: false,
+			Code:    code,
+			Error:   fmt.Sprintf("generated code is not valid HCL: %v", err),
+		}
+	}
+
+	if len(s.config().AllowedResourceTypes) > 0 {
+		if disallowed := disallowedResourceTypes(body, s.config().AllowedResourceTypes); len(disallowed) > 0 {
+			return code, &TerraformResponse{
+				Success: false,
+				Code:    code,
+				Error:   fmt.Sprintf("resource types not in allowed_resource_types: %s; use only %s", strings.Join(disallowed, ", "), strings.Join(s.config().AllowedResourceTypes, ", ")),
+			}
+		}
+	}
+	if !checkNames {
+		return code, nil
+	}
+
+	if violations := resourceNameViolations(body, s.resourceNamePattern); len(violations) > 0 {
+		return code, &TerraformResponse{
+			Success:        false,
+			Code:           code,
+			Error:          fmt.Sprintf("resource names must match %s, offending resources: %s", s.resourceNamePattern, strings.Join(violations, ", ")),
+			NameViolations: violations,
+		}
+	}
+
+	return code, nil
+}
+
+func (s *Service) prepareWorkspace(ctx context.Context, contextName, workspace, code string, variables map[string]string) (err error) {
+	ctx, span := tracer.Start(ctx, "workspace.prepare", trace.WithAttributes(
+		attribute.String("context", contextName),
+		attribute.String("workspace", workspace),
+	))
+	defer func() {
+		setSpanStatus(span, nil, err)
+		span.End()
+	}()
+	defer s.workspaceCache.invalidate(contextName, workspace, CacheEventCodeChanged)
+
 	if _, err := s.executorClient.ClearCode(ctx, &pb.ClearCodeRequest{
 		Context:   contextName,
 		Workspace: workspace,
 	}); err != nil {
-		return fmt.Errorf("clear code failed: %v", err)
+		return fmt.Errorf("clear code failed: %w", err)
 	}
 
 	if err := s.ensureContextAndWorkspace(ctx, contextName, workspace); err != nil {
-		return fmt.Errorf("workspace initialization failed: %v", err)
+		return fmt.Errorf("workspace initialization failed: %w", err)
 	}
 
 	if _, err := s.executorClient.AppendCode(ctx, &pb.AppendCodeRequest{
@@ -327,75 +1206,414 @@ func (s *Service) prepareWorkspace(ctx context.Context, contextName, workspace,
 		Workspace: workspace,
 		Code:      code,
 	}); err != nil {
-		return fmt.Errorf("append code failed: %v", err)
+		return fmt.Errorf("append code failed: %w", err)
+	}
+
+	if len(variables) > 0 {
+		if err := s.setVariables(ctx, contextName, workspace, variables); err != nil {
+			return fmt.Errorf("set variables failed: %w", err)
+		}
 	}
 
 	return nil
 }
 
-func (s *Service) parseTerraformError(response *TerraformResponse) *TerraformError {
-	tfError := &TerraformError{
-		Message:         response.Error,
-		TerraformOutput: response.Output,
-	}
+// formatWorkspace runs `terraform fmt` on the workspace and returns the
+// formatted code.
+func (s *Service) formatWorkspace(ctx context.Context, contextName, workspace string) (string, error) {
+	defer s.workspaceCache.invalidate(contextName, workspace, CacheEventCodeChanged)
 
-	if strings.Contains(response.Error, "with") {
-		lines := strings.Split(response.Error, "\n")
-		for i, line := range lines {
-			if strings.Contains(line, "with") && i+2 < len(lines) {
-				tfError.Resource = strings.TrimSpace(lines[i+2])
-				break
-			}
-		}
+	resp, err := s.executorClient.Fmt(ctx, &pb.FmtRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		return "", err
 	}
-	return tfError
+	if !resp.Success {
+		return "", fmt.Errorf("terraform fmt failed: %s", resp.Error)
+	}
+	return resp.Content, nil
 }
 
-func (s *Service) logRetryDelay(logger *log.Logger, delay time.Duration) {
-	logger.Printf("⏳ Waiting %v before next attempt...", delay)
+// checkProtectedResources reports whether an apply must check the protected
+// resource types. Only force skips the check; feature flags don't.
+func (s *Service) checkProtectedResources(req TerraformRequest) bool {
+	return len(s.config().ProtectedResourceTypes) > 0 && !req.Force
 }
 
-func (s *Service) executeAction(ctx context.Context, action, contextName, workspace string) (response *TerraformResponse, err error) {
-	switch action {
-	case "plan":
+// checkPlanBeforeApply reports whether an apply of req must first pass
+// checks on its plan: protected resources or the validation webhook.
+func (s *Service) checkPlanBeforeApply(req TerraformRequest) bool {
+	return s.checkProtectedResources(req) || s.validationWebhookEnabled(req)
+}
+
+// savedPlan returns the plan the pre-apply checks inspect: plan, which must
+// have been run withSavePlan, or with a nil plan a new saved plan of the
+// workspace. The apply must use its file, with withPlanFile, so that it
+// applies the plan that was checked. A failed plan is returned as is, for
+// the apply itself to surface the error.
+func (s *Service) savedPlan(ctx context.Context, contextName, workspace string, plan *TerraformResponse) (*TerraformResponse, error) {
+	if plan == nil {
 		resp, err := s.executorClient.Plan(ctx, &pb.PlanRequest{
 			Context:   contextName,
 			Workspace: workspace,
+			Save:      true,
 		})
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("plan failed: %v", err)
 		}
-		return &TerraformResponse{
-			Success: resp.Success,
-			Output:  resp.PlanOutput,
-			Error:   resp.Error,
-		}, nil
-	case "apply":
-		resp, err := s.executorClient.Apply(ctx, &pb.ApplyRequest{
-			Context:   contextName,
-			Workspace: workspace,
-		})
+		plan = &TerraformResponse{Success: resp.Success, Error: resp.Error, planJSON: resp.PlanJson, planFile: resp.PlanFile}
+	}
+	if !plan.Success || plan.Error != "" {
+		return plan, nil
+	}
+	if plan.planJSON == "" {
+		return nil, fmt.Errorf("executor did not return plan JSON, cannot check the plan")
+	}
+	if plan.planFile == "" {
+		return nil, fmt.Errorf("executor did not save the plan, cannot apply exactly the checked plan")
+	}
+	return plan, nil
+}
+
+// checkProtectedReplacements returns the addresses of protected resources
+// that plan, from savedPlan, would replace. It returns none when req doesn't
+// check protected resources or the plan failed.
+func (s *Service) checkProtectedReplacements(req TerraformRequest, plan *TerraformResponse) ([]string, error) {
+	if !s.checkProtectedResources(req) || !plan.Success || plan.Error != "" {
+		return nil, nil
+	}
+	return protectedReplacements(plan.planJSON, s.config().ProtectedResourceTypes)
+}
+
+// planHasNoChanges reports whether terraform plan output says there is
+// nothing to change.
+func planHasNoChanges(output string) bool {
+	return strings.Contains(output, "No changes.")
+}
+
+type planJSON struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Type    string `json:"type"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// protectedReplacements returns the addresses of resources whose type matches
+// one of the protected patterns and whose planned actions include both delete
+// and create.
+func protectedReplacements(planOutput string, protected []string) ([]string, error) {
+	var plan planJSON
+	if err := json.Unmarshal([]byte(planOutput), &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %v", err)
+	}
+
+	var blocked []string
+	for _, rc := range plan.ResourceChanges {
+		var deletes, creates bool
+		for _, a := range rc.Change.Actions {
+			deletes = deletes || a == "delete"
+			creates = creates || a == "create"
+		}
+		if !deletes || !creates {
+			continue
+		}
+		for _, pattern := range protected {
+			if ok, _ := path.Match(pattern, rc.Type); ok {
+				blocked = append(blocked, rc.Address)
+				break
+			}
+		}
+	}
+	return blocked, nil
+}
+
+// PlannedChange is a resource change from the plan that preceded an apply.
+type PlannedChange struct {
+	Address string   `json:"address"`
+	Type    string   `json:"type"`
+	Actions []string `json:"actions"` // Terraform plan actions, e.g. ["create"] or ["delete", "create"]
+}
+
+// plannedChanges returns the resource changes of a plan, skipping no-ops.
+func plannedChanges(planOutput string) ([]PlannedChange, error) {
+	var plan planJSON
+	if err := json.Unmarshal([]byte(planOutput), &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %v", err)
+	}
+
+	changes := []PlannedChange{}
+	for _, rc := range plan.ResourceChanges {
+		if len(rc.Change.Actions) == 1 && rc.Change.Actions[0] == "no-op" {
+			continue
+		}
+		changes = append(changes, PlannedChange{Address: rc.Address, Type: rc.Type, Actions: rc.Change.Actions})
+	}
+	return changes, nil
+}
+
+// setPlannedChanges fills response.PlannedChanges for an include_plan apply.
+func setPlannedChanges(response *TerraformResponse) {
+	if response.planJSON == "" {
+		response.Warnings = append(response.Warnings, "include_plan: executor did not return plan JSON for the apply")
+		return
+	}
+	changes, err := plannedChanges(response.planJSON)
+	if err != nil {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("include_plan: %v", err))
+		return
+	}
+	response.PlannedChanges = changes
+}
+
+// defaultErrorResourcePattern matches the "with <address>," line terraform
+// prints under an error, e.g.
+//
+//	Error: Unsupported argument
+//
+//	  with digitalocean_droplet.web,
+//	  on main.tf line 5, in resource "digitalocean_droplet" "web":
+const defaultErrorResourcePattern = `(?m)^[ \t│]*with ([A-Za-z0-9_.\-\[\]"]+),\s*$`
+
+// parseTerraformError collects every error of a failed response, so that
+// regeneration can fix them all at once.
+func (s *Service) parseTerraformError(response *TerraformResponse) *TerraformError {
+	tfError := &TerraformError{
+		Message:         response.Error,
+		TerraformOutput: response.Output,
+		Diagnostics:     response.Diagnostics,
+		Errors:          s.failureCauses(response),
+	}
+
+	for _, e := range tfError.Errors {
+		if e.Resource != "" {
+			tfError.Resource = e.Resource
+			break
+		}
+	}
+	return tfError
+}
+
+// parseValidateDiagnostics parses `terraform validate -json` output. It returns
+// nil when the output is not in that format.
+func parseValidateDiagnostics(output string) []Diagnostic {
+	var result struct {
+		FormatVersion string       `json:"format_version"`
+		Diagnostics   []Diagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &result); err != nil || result.FormatVersion == "" {
+		return nil
+	}
+	return result.Diagnostics
+}
+
+// lockFileWarnings extracts dependency lock file mismatches from terraform output.
+func lockFileWarnings(outputs ...string) []string {
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, output := range outputs {
+		for _, line := range strings.Split(output, "\n") {
+			line = strings.TrimSpace(strings.TrimLeft(line, "│╷╵ "))
+			lower := strings.ToLower(line)
+			if !strings.Contains(lower, "dependency lock file") && !strings.Contains(lower, "incomplete lock file information") {
+				continue
+			}
+			if !seen[line] {
+				seen[line] = true
+				warnings = append(warnings, line)
+			}
+		}
+	}
+	return warnings
+}
+
+// waitRetry waits delay before the next attempt. It reports false, and the
+// retry loop stops with the last outcome, when ctx is done first, such as
+// when the request is cancelled or the service shuts down.
+func (s *Service) waitRetry(ctx context.Context, logger *slog.Logger, attempt int, delay time.Duration) bool {
+	logger.Info("waiting before next attempt", "delay", delay.Round(time.Millisecond), "next_attempt", attempt+2)
+	if !sleepContext(ctx, delay) {
+		logger.Warn("stopping retries", "error", ctx.Err())
+		return false
+	}
+	return true
+}
+
+// sleepContext waits for delay, or until ctx is done. It reports whether
+// the full delay passed.
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Service) executeAction(ctx context.Context, action Action, contextName, workspace string) (response *TerraformResponse, err error) {
+	ctx, span := tracer.Start(ctx, "executor."+string(action), trace.WithAttributes(
+		attribute.String("action", string(action)),
+		attribute.String("context", contextName),
+		attribute.String("workspace", workspace),
+	))
+	parent := ctx
+	timeout := callTimeout(ctx, time.Duration(s.config().ActionTimeoutSeconds[action])*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		if status.Code(err) == codes.DeadlineExceeded && parent.Err() == nil {
+			// Our own timeout, not the caller's: report it as a failure
+			response, err = &TerraformResponse{
+				Success:  false,
+				Error:    fmt.Sprintf("terraform %s timed out after %v; the executor or provider may be slow or unresponsive", action, timeout),
+				TimedOut: true,
+			}, nil
+		}
+		if response != nil {
+			s.maskResponse(parent, response)
+		}
+		s.emitActionEvent(parent, string(action), contextName, workspace, response, err)
+		s.metrics.observeExecutorCall(action, start, response, err)
+		setSpanStatus(span, response, err)
+		span.End()
+	}()
+
+	switch action {
+	case "plan":
+		resp, err := s.executorClient.Plan(ctx, &pb.PlanRequest{
+			Context:   contextName,
+			Workspace: workspace,
+			Save:      savePlanRequested(ctx),
+		})
 		if err != nil {
 			return nil, err
 		}
 		return &TerraformResponse{
-			Success: resp.Success,
-			Output:  resp.ApplyOutput,
-			Error:   resp.Error,
+			Success:    resp.Success,
+			Output:     resp.PlanOutput,
+			Error:      resp.Error,
+			InitOutput: resp.InitOutput,
+			InitError:  resp.InitError,
+			NoChanges:  resp.Success && resp.Error == "" && planHasNoChanges(resp.PlanOutput),
+			planJSON:   resp.PlanJson,
+			planFile:   resp.PlanFile,
+		}, nil
+	case "apply":
+		var resp *pb.ApplyResponse
+		if eventStreamFrom(ctx) != nil {
+			resp, err = s.streamApply(ctx, contextName, workspace)
+		} else {
+			resp, err = s.executorClient.Apply(ctx, &pb.ApplyRequest{
+				Context:   contextName,
+				Workspace: workspace,
+				PlanFile:  planFileFrom(ctx),
+			})
+		}
+		s.workspaceCache.invalidate(contextName, workspace, CacheEventApplied)
+		if err != nil {
+			return nil, err
+		}
+		return &TerraformResponse{
+			Success:     resp.Success,
+			Output:      resp.ApplyOutput,
+			PlanOutput:  resp.PlanOutput,
+			ApplyOutput: resp.ApplyOutput,
+			Error:       resp.Error,
+			InitOutput:  resp.InitOutput,
+			InitError:   resp.InitError,
+			planJSON:    resp.PlanJson,
 		}, nil
 	case "destroy":
 		resp, err := s.executorClient.Destroy(ctx, &pb.DestroyRequest{
 			Context:   contextName,
 			Workspace: workspace,
 		})
+		s.workspaceCache.invalidate(contextName, workspace, CacheEventDestroyed)
+		if err != nil {
+			return nil, err
+		}
+		return &TerraformResponse{
+			Success:    resp.Success,
+			Output:     resp.DestroyOutput,
+			Error:      resp.Error,
+			InitOutput: resp.InitOutput,
+			InitError:  resp.InitError,
+		}, nil
+	case "graph":
+		resp, err := s.executorClient.Graph(ctx, &pb.GraphRequest{
+			Context:   contextName,
+			Workspace: workspace,
+		})
+		if err != nil {
+			return nil, err
+		}
+		response := &TerraformResponse{
+			Success:    resp.Success,
+			Output:     resp.Dot,
+			Error:      resp.Error,
+			InitOutput: resp.InitOutput,
+			InitError:  resp.InitError,
+		}
+		if resp.Success {
+			response.Graph = parseGraph(resp.Dot, s.config().MaxGraphNodes)
+		}
+		return response, nil
+	case "fmt":
+		resp, err := s.executorClient.Fmt(ctx, &pb.FmtRequest{
+			Context:   contextName,
+			Workspace: workspace,
+		})
+		s.workspaceCache.invalidate(contextName, workspace, CacheEventCodeChanged)
 		if err != nil {
 			return nil, err
 		}
 		return &TerraformResponse{
 			Success: resp.Success,
-			Output:  resp.DestroyOutput,
+			Code:    resp.Content,
+			Output:  resp.Content,
 			Error:   resp.Error,
 		}, nil
+	case "import":
+		return s.importResource(ctx, contextName, workspace)
+	case "refresh":
+		resp, err := s.executorClient.Refresh(ctx, &pb.RefreshRequest{
+			Context:   contextName,
+			Workspace: workspace,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &TerraformResponse{
+			Success:    resp.Success,
+			Output:     resp.RefreshOutput,
+			Error:      resp.Error,
+			InitOutput: resp.InitOutput,
+			InitError:  resp.InitError,
+			NoChanges:  resp.Success && resp.Error == "" && planHasNoChanges(resp.RefreshOutput),
+			planJSON:   resp.PlanJson,
+		}, nil
+	case "validate":
+		resp, err := s.executorClient.Validate(ctx, &pb.ValidateRequest{
+			Context:   contextName,
+			Workspace: workspace,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &TerraformResponse{
+			Success:    resp.Success,
+			Output:     resp.Output,
+			Error:      resp.Error,
+			InitOutput: resp.InitOutput,
+			InitError:  resp.InitError,
+		}, nil
 
 	default:
 		return nil, fmt.Errorf("unknown action: %s", action)
@@ -404,58 +1622,647 @@ func (s *Service) executeAction(ctx context.Context, action, contextName, worksp
 
 func (s *Service) handleTerraformRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
 		return
 	}
 
 	var req TerraformRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, APIErrorInvalidBody, "Invalid request body", err.Error())
 		return
 	}
 
 	if req.Context == "" {
 		req.Context = "default"
 	}
-	if req.Action == "" {
-		req.Action = "plan"
+	action, err := parseAction(string(req.Action))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, APIErrorUnknownAction, err.Error(), "")
+		return
+	}
+	req.Action = action
+	if req.Force && !s.isAdmin(r) {
+		writeError(w, http.StatusForbidden, APIErrorForbidden, "force requires a valid X-Admin-Token", "")
+		return
+	}
+	if limit := s.config().MaxDescriptionLength; limit > 0 && utf8.RuneCountInString(req.Description) > limit {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, fmt.Sprintf("description is longer than %d characters", limit), "")
+		return
+	}
+	if req.MaxAttempts < 0 {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "max_attempts must be at least 1 (1 disables retries)", "")
+		return
+	}
+	if req.RetryDelaySeconds != nil && *req.RetryDelaySeconds < 0 {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "retry_delay_seconds cannot be negative", "")
+		return
+	}
+	if req.TimeoutSeconds < 0 {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "timeout_seconds cannot be negative", "")
+		return
+	}
+	if req.Model == "" {
+		req.Model = s.config().DefaultModel
+	} else if _, ok := s.config().ModelPricing[req.Model]; !ok {
+		writeError(w, http.StatusBadRequest, APIErrorUnknownModel, fmt.Sprintf("unknown model %q, valid models are: %s", req.Model, strings.Join(s.knownModels(), ", ")), "")
+		return
+	}
+	if err := validateCloudProvider(req.Provider); err != nil {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, err.Error(), "")
+		return
+	}
+	req.features = s.resolveFeatures(r.Context(), req.Context)
+	if req.CodeID != "" && (req.Description != "" || req.ReuseExistingCode || len(req.Regions) > 0 || len(req.Workspaces) > 0) {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "code_id cannot be combined with a description, reuse_existing_code, regions or workspaces", "")
+		return
+	}
+	if req.PlanID != "" && (req.Action != ActionApply || req.Description != "" || req.CodeID != "" || req.ReuseExistingCode || req.DryRun || len(req.Variables) > 0 || len(req.Regions) > 0 || len(req.Workspaces) > 0) {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "plan_id requires action apply and cannot be combined with a description, code_id, reuse_existing_code, dry_run, variables, regions or workspaces", "")
+		return
+	}
+	if req.Action == "apply" && req.Description == "" && req.CodeID == "" && req.PlanID == "" && !req.ReuseExistingCode && !s.config().ImplicitCodeReuse {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "apply without a description requires reuse_existing_code", "")
+		return
+	}
+	if req.AutoApply && req.Action != "plan" {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "auto_apply requires action plan", "")
+		return
+	}
+	if req.Action == ActionImport && (req.Address == "" || req.ID == "") || req.Action != ActionImport && (req.Address != "" || req.ID != "") {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "action import requires address and id, which only apply to import", "")
+		return
+	}
+	if req.Action == ActionImport && (req.DryRun || len(req.Regions) > 0 || len(req.Workspaces) > 0) {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "import cannot be combined with dry_run, regions or workspaces", "")
+		return
+	}
+	if (req.Action == ActionGraph || req.Action == ActionValidate || req.Action == ActionFmt || req.Action == ActionImport || req.Action == ActionRefresh) && req.Description == "" && req.CodeID == "" {
+		// The current code unless asked about a change
+		req.ReuseExistingCode = true
+	}
+	if req.Action == "destroy" && req.features.DestroyConfirmation && !req.Confirm {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, fmt.Sprintf("destroy in context %s requires confirm", req.Context), "")
+		return
+	}
+
+	if req.Async && (wantsEventStream(r) || req.PreviewChanges) {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "async cannot be combined with an event stream or preview_changes", "")
+		return
+	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL, req.Async, s.config().CallbackAllowedHosts); err != nil {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, err.Error(), "")
+			return
+		}
+	}
+	if len(req.Regions) > 0 && len(req.Workspaces) > 0 {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "regions and workspaces cannot be combined", "")
+		return
+	}
+	if len(req.Regions) > 0 {
+		if err := validateRegions(req.Regions); err != nil {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, err.Error(), "")
+			return
+		}
+	}
+	if err := validateVariables(req.Variables); err != nil {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, err.Error(), "")
+		return
+	}
+	if req.DryRun && (req.Action == ActionDestroy || len(req.Workspaces) > 0) {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "dry_run cannot be combined with action destroy or workspaces", "")
+		return
+	}
+	if req.SessionID != "" && (len(req.Regions) > 0 || len(req.Workspaces) > 0) {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "session_id cannot be combined with regions or workspaces", "")
+		return
+	}
+	if len(req.Workspaces) > 0 {
+		if req.Action != "apply" || req.Description == "" {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "workspaces requires action apply and a description", "")
+			return
+		}
+		if err := validateNames("workspace", req.Workspaces); err != nil {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, err.Error(), "")
+			return
+		}
+	}
+
+	if len(req.Regions) == 0 && len(req.Workspaces) == 0 {
+		sess, err := s.loadSession(r.Context(), req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, err.Error(), "")
+			return
+		}
+		req.session = sess
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "terraform.request", trace.WithAttributes(
+		attribute.String("action", string(req.Action)),
+		attribute.String("context", req.Context),
+		attribute.String("workspace", req.Workspace),
+		attribute.String("model", req.Model),
+	))
+	defer span.End()
+	ctx, cache := withCacheStatus(ctx, req.NoCache)
+	if req.Action == ActionApply && req.Description == "" && req.CodeID == "" && req.PlanID == "" && len(req.Regions) == 0 {
+		// Reusing the workspace's code, which may not exist yet
+		code, err := s.workspaceCode(ctx, req.Context, req.Workspace)
+		if status.Code(err) == codes.NotFound || err == nil && strings.TrimSpace(code) == "" {
+			writeError(w, http.StatusNotFound, APIErrorNothingToApply, "nothing to apply: workspace is empty and no description provided", "")
+			return
+		}
+	}
+
+	wait, release, err := s.reserveDestructiveOp(ctx, req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to check the destructive operation cooldown", err.Error())
+		return
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeError(w, http.StatusTooManyRequests, APIErrorCooldown, fmt.Sprintf("destructive operations in context %s are limited by a cooldown, retry in %ds", req.Context, seconds), "")
+		return
+	}
+
+	languageWarning, translation := s.checkDescriptionLanguage(ctx, &req)
+
+	if req.TimeoutSeconds > 0 {
+		ctx = withRequestTimeout(ctx, time.Duration(req.TimeoutSeconds)*time.Second)
+	}
+	process := func(ctx context.Context) (*TerraformResponse, error) {
+		response, err := s.runTerraformRequest(ctx, req)
+		release(ctx, response, err)
+		if err == nil {
+			if languageWarning != "" {
+				response.Warnings = append(response.Warnings, languageWarning)
+			}
+			if translation != nil {
+				response.LLMCostUSD += s.config().ModelPricing[translation.Model].cost(translation.InputTokens, translation.OutputTokens)
+			}
+			response.CacheHits = cache.hitCaches()
+			response.FromCache = len(response.CacheHits) > 0
+			response.ChatSummary = chatSummary(req, response)
+		}
+		return response, err
+	}
+	if req.Async {
+		if !s.startJob(ctx, w, req.CallbackURL, process) {
+			release(ctx, nil, nil)
+		}
+		return
+	}
+
+	var stream *eventStream
+	if wantsEventStream(r) {
+		w.Header().Set("Cache-Status", cache.header())
+		ctx, stream, err = startEventStream(ctx, w)
+		if err != nil {
+			release(ctx, nil, err)
+			writeError(w, http.StatusNotAcceptable, APIErrorInvalidRequest, err.Error(), "")
+			return
+		}
+	}
+	response, err := process(ctx)
+	setSpanStatus(span, response, err)
+	if err != nil {
+		if stream != nil {
+			// Headers are sent; the status only reaches the client in the event
+			_, body := processingError(err)
+			stream.sendJSON(EventError, body)
+			return
+		}
+		writeProcessingError(w, err)
+		return
 	}
 
-	var code string
+	if stream != nil {
+		stream.sendJSON(EventResult, response)
+		return
+	}
+	w.Header().Set("Cache-Status", cache.header())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// runTerraformRequest runs a validated /terraform request, across its
+// regions or workspaces if it has them.
+func (s *Service) runTerraformRequest(ctx context.Context, req TerraformRequest) (response *TerraformResponse, err error) {
+	switch {
+	case len(req.Regions) > 0:
+		response = s.processMultiRegionRequest(ctx, req)
+	case len(req.Workspaces) > 0:
+		response, err = s.processFanOutApply(ctx, req)
+	default:
+		response, err = s.processTerraformRequest(ctx, req)
+	}
+	s.metrics.observeRequest(req.Action, metricStatus(response, err))
+	return response, err
+}
+
+func (s *Service) isAdmin(r *http.Request) bool {
+	token := r.Header.Get("X-Admin-Token")
+	return s.config().AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.config().AdminToken)) == 1
+}
+
+func (s *Service) processTerraformRequest(ctx context.Context, req TerraformRequest) (*TerraformResponse, error) {
+	var code, priorCode string
 	var err error
+	reused := false
+	usage := &llmUsage{}
+	start := time.Now()
+	timings := &Timings{}
+	ctx = s.withInjectedSecrets(ctx, req.Context, req.Workspace)
+	// Hold the workspace from reading its code until the run is done, so
+	// concurrent requests don't build on the same old code
+	unlock, err := s.workspaceLocks.lock(ctx, req.Context, req.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	unlock = sync.OnceFunc(unlock)
+	defer unlock()
+	s.touchWorkspace(ctx, req.Context, req.Workspace)
+	description := describeVariables(req.session.describe(req.Description), req.Variables)
+	s.emitEvent(ctx, otellog.SeverityInfo, "request", map[string]any{
+		"context":     req.Context,
+		"workspace":   req.Workspace,
+		"action":      string(req.Action),
+		"description": req.Description,
+	})
 
 	if req.Action != "destroy" {
-		existingCode, err := s.executorClient.GetMainTf(r.Context(), &pb.GetMainTfRequest{
-			Context:   req.Context,
-			Workspace: req.Workspace,
-		})
+		existingCode, err := s.workspaceCode(ctx, req.Context, req.Workspace)
 
 		codeContent := ""
 		if err == nil { // Если код существует
-			codeContent = existingCode.Content
+			codeContent = existingCode
+		}
+		priorCode = codeContent
+		if len(codeContent) > s.config().MaxCodeBytes {
+			return &TerraformResponse{
+				Success: false,
+				Error:   fmt.Sprintf("existing code in %s/%s is %d bytes, over the max_code_bytes limit of %d", req.Context, req.Workspace, len(codeContent), s.config().MaxCodeBytes),
+			}, nil
 		}
-		if !(req.Action == "apply" && req.Description == "") {
-			code, err = s.generateTerraformCode(r.Context(), req.Description, nil, codeContent)
+		if req.PreviewChanges && req.Description != "" {
+			gen, err := s.previewChanges(ctx, req.Model, req.Provider, description, codeContent)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to generate code: %v", err), http.StatusInternalServerError)
-				return
+				return nil, err
+			}
+			usage.record(gen, s.config().ModelPricing)
+			response := &TerraformResponse{
+				Success:       true,
+				Code:          codeContent,
+				ChangePreview: gen.Code,
+				LLMCostUSD:    usage.CostUSD,
+			}
+			response.FollowUps = followUps(req, response)
+			if req.Debug {
+				response.Debug = &DebugInfo{Generations: usage.Generations, Features: &req.features}
+			}
+			return response, nil
+		}
+		if req.PlanID != "" {
+			plan, err := s.loadPlan(ctx, req.PlanID, req.Context, req.Workspace)
+			if errors.Is(err, ErrNotFound) {
+				return &TerraformResponse{
+					Success: false,
+					Error:   fmt.Sprintf("no plan with ID %s; it may have expired or already been applied", req.PlanID),
+				}, nil
+			}
+			if err != nil {
+				return &TerraformResponse{Success: false, Error: err.Error()}, nil
+			}
+			code = plan.Code
+			req.Variables = plan.Variables
+			reused = true
+			req.MaxAttempts = 1 // Apply exactly the approved code, never a regenerated one
+		} else if req.CodeID != "" {
+			stored, err := s.loadCode(ctx, req.CodeID)
+			if errors.Is(err, ErrNotFound) {
+				return &TerraformResponse{
+					Success: false,
+					Error:   fmt.Sprintf("no code with ID %s", req.CodeID),
+				}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			code = stored
+			reused = true
+			req.MaxAttempts = 1 // Run exactly this code, never a regenerated one
+		} else if req.ReuseExistingCode || (req.Action == "apply" && req.Description == "" && s.config().ImplicitCodeReuse) {
+			if codeContent == "" {
+				return &TerraformResponse{
+					Success: false,
+					Error:   fmt.Sprintf("no existing code to reuse in %s/%s", req.Context, req.Workspace),
+				}, nil
 			}
-		} else {
-			req.Description = "Please check that code is correct"
 			code = codeContent
+			reused = true
+		} else {
+			generationStart := time.Now()
+			gen, err := s.generateTerraformCode(ctx, req.Model, req.Provider, description, nil, codeContent)
+			timings.initialGenerationMS = msSince(generationStart)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errCodeGeneration, err)
+			}
+			usage.record(gen, s.config().ModelPricing)
+			if strings.TrimSpace(gen.Code) == "" {
+				// Also with existing code: running empty code would remove it all
+				return nil, errNotInfrastructure
+			}
+			code = gen.Code
+			req.previousCode = codeContent
 		}
 
+		if req.DryRun {
+			response := &TerraformResponse{
+				Success:    true,
+				Code:       code,
+				LLMCostUSD: usage.CostUSD,
+			}
+			if id, err := s.storeCode(ctx, code); err != nil {
+				s.runLogger(ctx).Warn("failed to store code", "error", err)
+			} else {
+				response.CodeID = id
+			}
+			if req.previousCode != "" {
+				response.UnintendedChanges = unintendedChanges(description, req.previousCode, code)
+			}
+			response.Diff = codeDiff(priorCode, code)
+			return response, nil
+		}
 	}
 
-	response, err := s.executeTerraformAction(r.Context(), req.Action, req.Description, code, req.Context, req.Workspace)
+	execReq := req
+	execReq.Description = description
+	execReq.reusedCode = reused
+	if reused && execReq.Description == "" {
+		// Reused code has no description; give retries something to fix against
+		execReq.Description = "Please check that code is correct"
+	}
+	if req.Action == ActionImport {
+		ctx = withImportTarget(ctx, req.Address, req.ID)
+	}
+	response, err := s.executeTerraformAction(ctx, execReq, code, usage, timings)
+	unlock() // autoApply takes the lock again for its apply
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to execute terraform action: %v", err), http.StatusInternalServerError)
-		return
+		s.emitEvent(ctx, otellog.SeverityError, "error", map[string]any{
+			"context":   req.Context,
+			"workspace": req.Workspace,
+			"error":     err.Error(),
+		})
+		return nil, fmt.Errorf("failed to execute terraform action: %w", err)
 	}
 
-	if code != "" {
+	if response.Code == "" {
 		response.Code = code
 	}
+	if response.Code != "" {
+		if id, err := s.storeCode(ctx, response.Code); err != nil {
+			s.runLogger(ctx).Warn("failed to store code", "error", err)
+		} else {
+			response.CodeID = id
+		}
+	}
+	response.OutputNames = outputNames(response.Code)
+	response.Diff = codeDiff(priorCode, response.Code)
+	if req.previousCode != "" && response.UnintendedChanges == nil {
+		response.UnintendedChanges = unintendedChanges(description, req.previousCode, response.Code)
+	}
+	if req.AutoApply && response.Success && response.Error == "" {
+		s.autoApply(ctx, req, response, usage)
+	}
+	applied := req.Action == ActionApply || (response.AutoApply != nil && response.AutoApply.Applied)
+	if applied || req.Action == ActionDestroy {
+		response.ResourceResults = s.resourceResults(response)
+	}
+	if applied && response.Success {
+		s.setOutputs(ctx, req.Context, req.Workspace, response)
+	}
+	if req.IncludePlan && response.ApplyOutput != "" {
+		setPlannedChanges(response)
+	}
+	if req.Action == ActionRefresh && response.Success && response.Error == "" {
+		setDrift(response)
+	}
+	setPlacements(response)
+	if req.Action == ActionPlan {
+		s.setCostEstimate(ctx, req, response)
+	}
+	if req.Action == ActionPlan && response.Success && response.Error == "" && response.Code != "" {
+		if id, err := s.storePlan(ctx, req, response.Code); err != nil {
+			s.runLogger(ctx).Warn("failed to store plan", "error", err)
+		} else {
+			response.PlanID = id
+		}
+	}
+	if req.PlanID != "" && response.Success && response.Error == "" {
+		s.consumePlan(ctx, req.PlanID)
+	}
+	if req.CanonicalCode {
+		setCanonicalCode(response)
+	}
+	if req.ExplainError && (!response.Success || response.Error != "") {
+		s.explainError(ctx, req.Description, response, usage)
+	}
+	response.CacheSavings = usage.cacheSavings()
+	response.LLMCostUSD = usage.CostUSD
+	response.FollowUps = followUps(req, response)
+	timings.finish(start)
+	response.Timings = timings
+	addSuggestions(response, req.Provider)
+	s.addQuotaHint(response)
+	if !response.Success || response.Error != "" {
+		response.FailureAnalysis = s.analyzeFailure(req.Description, response.Code, response)
+	}
+	if req.Debug {
+		response.Debug = &DebugInfo{Generations: usage.Generations, Features: &req.features}
+		if s.config().Executors.StickyRouting {
+			response.Debug.Executor = s.executors.executorFor(req.Context, req.Workspace)
+		}
+	}
+	s.recordRun(ctx, req, response, usage.Generations)
+	s.recordSessionTurn(ctx, req, response)
+	s.emitResponseEvent(ctx, req, response)
+	s.truncateResponseOutputs(ctx, response)
+
+	return response, nil
+}
+
+// processMultiRegionRequest runs the request once per region, each in its own
+// workspace named after the region, and aggregates the results.
+func (s *Service) processMultiRegionRequest(ctx context.Context, req TerraformRequest) *TerraformResponse {
+	results := make(map[string]*TerraformResponse, len(req.Regions))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.config().MaxParallelRegions)
+
+	for _, region := range req.Regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			regionReq := req
+			regionReq.Regions = nil
+			regionReq.Workspace = regionalWorkspace(req.Workspace, region)
+			if req.Description != "" {
+				regionReq.Description = fmt.Sprintf("%s\n\nDeploy all resources in region: %s", req.Description, region)
+			}
+
+			resp, err := s.processTerraformRequest(ctx, regionReq)
+			if err != nil {
+				resp = &TerraformResponse{Error: err.Error()}
+			}
+
+			mu.Lock()
+			results[region] = resp
+			mu.Unlock()
+		}(region)
+	}
+	wg.Wait()
+
+	return aggregateRegions(req, results)
+}
+
+// aggregateRegions combines per-region results. A region fails by the same
+// rule as a single-workspace request, and any failed region fails the whole.
+func aggregateRegions(req TerraformRequest, results map[string]*TerraformResponse) *TerraformResponse {
+	response := &TerraformResponse{Success: true, Regions: results}
+	var summary []string
+	for _, region := range req.Regions {
+		status := "succeeded"
+		if responseFailed(results[region]) {
+			status = "failed"
+			response.Success = false
+		}
+		summary = append(summary, fmt.Sprintf("%s (%s): %s", region, regionalWorkspace(req.Workspace, region), status))
+	}
+	response.Output = strings.Join(summary, "\n")
+
+	return response
+}
+
+func regionalWorkspace(workspace, region string) string {
+	if workspace == "" {
+		return region
+	}
+	return workspace + "-" + region
+}
+
+// regionPattern is what a region may look like, since regions become part of
+// workspace names.
+var regionPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// validateRegions checks the regions of a multi-region request.
+func validateRegions(regions []string) error {
+	if err := validateNames("region", regions); err != nil {
+		return err
+	}
+	for _, region := range regions {
+		if !regionPattern.MatchString(region) {
+			return fmt.Errorf("invalid region %q: regions may only contain lowercase letters, digits and hyphens", region)
+		}
+	}
+	return nil
+}
+
+// validateNames checks a list of regions or workspaces for empty and
+// duplicate values.
+func validateNames(kind string, names []string) error {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%ss must not contain empty values", kind)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate %s: %s", kind, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func (s *Service) handleLockFile(w http.ResponseWriter, r *http.Request) {
+	var response *LockFileResponse
+
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Has("regenerate") {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidRequest, "regenerate changes the lock file; use POST /lockfile", "")
+			return
+		}
+		contextName := r.URL.Query().Get("context")
+		if contextName == "" {
+			contextName = "default"
+		}
+		resp, err := s.executorClient.GetLockFile(r.Context(), &pb.GetLockFileRequest{
+			Context:   contextName,
+			Workspace: r.URL.Query().Get("workspace"),
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to get lock file", err.Error())
+			return
+		}
+		response = &LockFileResponse{
+			Success: resp.Success,
+			Content: resp.Content,
+			Error:   resp.Error,
+		}
+	case http.MethodPost, http.MethodPut:
+		// Both replace the pinned provider checksums: POST regenerates them,
+		// PUT uploads them
+		if !s.isAdmin(r) {
+			writeError(w, http.StatusForbidden, APIErrorForbidden, "changing the lock file requires a valid X-Admin-Token", "")
+			return
+		}
+		var req LockFileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, APIErrorInvalidBody, "Invalid request body", err.Error())
+			return
+		}
+		if req.Context == "" {
+			req.Context = "default"
+		}
+		if r.Method == http.MethodPost {
+			resp, err := s.executorClient.GetLockFile(r.Context(), &pb.GetLockFileRequest{
+				Context:    req.Context,
+				Workspace:  req.Workspace,
+				Regenerate: true,
+			})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to regenerate lock file", err.Error())
+				return
+			}
+			response = &LockFileResponse{
+				Success: resp.Success,
+				Content: resp.Content,
+				Error:   resp.Error,
+			}
+			break
+		}
+		resp, err := s.executorClient.SetLockFile(r.Context(), &pb.SetLockFileRequest{
+			Context:   req.Context,
+			Workspace: req.Workspace,
+			Content:   req.Content,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to update lock file", err.Error())
+			return
+		}
+		response = &LockFileResponse{
+			Success: resp.Success,
+			Error:   resp.Error,
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -464,54 +2271,252 @@ func (s *Service) handleTerraformRequest(w http.ResponseWriter, r *http.Request)
 func LoadConfig(filename string) (*Config, error) {
 	config := &Config{}
 
-	buf, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %v", err)
+	if err := readConfigFile(filename, config); err != nil {
+		return nil, err
 	}
-
-	err = yaml.Unmarshal(buf, config)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing config file: %v", err)
+	if err := applyEnvOverrides(config); err != nil {
+		return nil, err
 	}
 
-	if env := os.Getenv("ANTHROPIC_API_KEY"); env != "" {
-		config.AnthropicAPIKey = env
+	if config.LLMProvider == "" {
+		config.LLMProvider = ProviderAnthropic
 	}
-	if env := os.Getenv("GRPC_SERVER_ADDR"); env != "" {
-		config.GRPCServerAddr = env
+	if config.LogLevel == "" {
+		config.LogLevel = "info"
 	}
-
-	if config.AnthropicAPIKey == "" {
+	if config.LogFormat == "" {
+		config.LogFormat = LogFormatText
+	}
+	if err := validateLogging(config); err != nil {
+		return nil, err
+	}
+	if config.LLMProvider == ProviderAnthropic && config.AnthropicAPIKey == "" {
 		return nil, fmt.Errorf("anthropic_api_key is required")
 	}
+	if config.LLMProvider == ProviderOpenAI && config.OpenAI.BaseURL == "" {
+		return nil, fmt.Errorf("openai.base_url is required with llm_provider openai")
+	}
 	if config.GRPCServerAddr == "" {
 		config.GRPCServerAddr = "localhost:50051"
 	}
 	if config.Server.Port == 0 {
 		config.Server.Port = 8080
 	}
+	if config.Server.ShutdownTimeoutSeconds <= 0 {
+		config.Server.ShutdownTimeoutSeconds = 5 * 60
+	}
+	if config.Jobs.Workers <= 0 {
+		config.Jobs.Workers = 4
+	}
+	if config.Jobs.QueueSize <= 0 {
+		config.Jobs.QueueSize = 100
+	}
+	if config.Jobs.TTLSeconds <= 0 {
+		config.Jobs.TTLSeconds = 24 * 60 * 60
+	}
+	if config.PlanTTLSeconds <= 0 {
+		config.PlanTTLSeconds = 24 * 60 * 60
+	}
+	if config.Executors.ConnectTimeoutSeconds <= 0 {
+		config.Executors.ConnectTimeoutSeconds = 10
+	}
+	if config.MaxParallelRegions <= 0 {
+		config.MaxParallelRegions = 4
+	}
+	if config.Retry.MaxAttempts == nil {
+		maxAttempts := 5
+		config.Retry.MaxAttempts = &maxAttempts
+	} else if *config.Retry.MaxAttempts < 1 {
+		return nil, fmt.Errorf("retry.max_attempts must be at least 1 (1 disables retries), got %d", *config.Retry.MaxAttempts)
+	}
+	if config.Retry.DelaySeconds == nil {
+		delaySeconds := 3
+		config.Retry.DelaySeconds = &delaySeconds
+	} else if *config.Retry.DelaySeconds < 0 {
+		return nil, fmt.Errorf("retry.delay_seconds cannot be negative, got %d", *config.Retry.DelaySeconds)
+	}
+	switch config.Retry.Backoff {
+	case "":
+		config.Retry.Backoff = BackoffConstant
+	case BackoffConstant, BackoffExponential:
+	default:
+		return nil, fmt.Errorf("retry.backoff must be %q or %q, got %q", BackoffConstant, BackoffExponential, config.Retry.Backoff)
+	}
+	if config.Retry.MaxDelaySeconds <= 0 {
+		config.Retry.MaxDelaySeconds = 60
+	}
+	if config.Telemetry.ServiceName == "" {
+		config.Telemetry.ServiceName = "request-processor"
+	}
+	if config.OTELEndpoint != "" && !config.Telemetry.Traces.Enabled {
+		config.Telemetry.Traces.Enabled = true
+		config.Telemetry.Traces.Endpoint = config.OTELEndpoint
+	}
+	if config.ValidationWebhook.TimeoutSeconds <= 0 {
+		config.ValidationWebhook.TimeoutSeconds = 10
+	}
+	if config.Eviction.IntervalMinutes <= 0 {
+		config.Eviction.IntervalMinutes = 60
+	}
+	if config.AutoApply.ConfidenceThreshold <= 0 {
+		config.AutoApply.ConfidenceThreshold = 0.9
+	}
+	if config.ErrorResourcePattern == "" {
+		config.ErrorResourcePattern = defaultErrorResourcePattern
+	}
+	if config.MaxCodeBytes <= 0 {
+		config.MaxCodeBytes = 1 << 20
+	}
+	if config.MaxConcurrentLLMCalls <= 0 {
+		config.MaxConcurrentLLMCalls = 4
+	}
+	if config.OutputTruncation.MaxLines > 0 {
+		if config.OutputTruncation.HeadLines <= 0 && config.OutputTruncation.TailLines <= 0 {
+			config.OutputTruncation.HeadLines = config.OutputTruncation.MaxLines / 2
+			config.OutputTruncation.TailLines = config.OutputTruncation.MaxLines / 2
+		}
+		if config.OutputTruncation.HeadLines+config.OutputTruncation.TailLines > config.OutputTruncation.MaxLines {
+			return nil, fmt.Errorf("output_truncation head_lines + tail_lines must not exceed max_lines")
+		}
+	}
+	if config.ArtifactTTLSeconds <= 0 {
+		config.ArtifactTTLSeconds = 3600
+	}
+	if config.Store.MaxEntries <= 0 {
+		config.Store.MaxEntries = 10000
+	}
+	if config.Sessions.TTLSeconds <= 0 {
+		config.Sessions.TTLSeconds = 24 * 3600
+	}
+	if config.Sessions.MaxTurns <= 0 {
+		config.Sessions.MaxTurns = 10
+	}
+	if config.ErrorExplanationTTLSeconds <= 0 {
+		config.ErrorExplanationTTLSeconds = 7 * 24 * 3600
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = 120
+	}
+	if config.Lint.TimeoutSeconds <= 0 {
+		config.Lint.TimeoutSeconds = 60
+	}
+	if config.LockTimeoutSeconds <= 0 {
+		config.LockTimeoutSeconds = 30
+	}
+	if config.CostEstimation.TimeoutSeconds <= 0 {
+		config.CostEstimation.TimeoutSeconds = 60
+	}
+	if _, ok := severityRank[config.Lint.BlockSeverity]; config.Lint.BlockSeverity != "" && !ok {
+		return nil, fmt.Errorf("lint.block_severity must be one of low, medium, high or critical, got %q", config.Lint.BlockSeverity)
+	}
+	if config.MaxGraphNodes <= 0 {
+		config.MaxGraphNodes = 500
+	}
+	if config.ModelPricing == nil {
+		config.ModelPricing = make(map[string]ModelPricing)
+	}
+	for action, seconds := range config.ActionTimeoutSeconds {
+		if _, err := parseAction(string(action)); err != nil || action == "" {
+			return nil, fmt.Errorf("action_timeout_seconds: unknown action %q", action)
+		}
+		if seconds <= 0 {
+			return nil, fmt.Errorf("action_timeout_seconds.%s must be positive, got %d", action, seconds)
+		}
+	}
+	if config.ActionTimeoutSeconds == nil {
+		config.ActionTimeoutSeconds = make(map[Action]int)
+	}
+	for action, seconds := range defaultActionTimeouts {
+		if _, ok := config.ActionTimeoutSeconds[action]; !ok {
+			config.ActionTimeoutSeconds[action] = seconds
+		}
+	}
+	for model, pricing := range providerModelPricing[config.LLMProvider] {
+		if _, ok := config.ModelPricing[model]; !ok {
+			config.ModelPricing[model] = pricing
+		}
+	}
+	if config.DefaultModel == "" {
+		if config.LLMProvider != ProviderAnthropic {
+			return nil, fmt.Errorf("default_model is required with llm_provider %s", config.LLMProvider)
+		}
+		config.DefaultModel = string(anthropic.ModelClaude3_5SonnetLatest)
+	}
+	if _, ok := config.ModelPricing[config.DefaultModel]; !ok {
+		return nil, fmt.Errorf("default_model %q is not a known model, add its pricing to model_pricing", config.DefaultModel)
+	}
 
 	return config, nil
 }
 
 func main() {
-	configPath := flag.String("config", "config.yaml", "path to config file")
+	configPath := flag.String("config", defaultConfigPath, "path to config file")
 	flag.Parse()
 
 	config, err := LoadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		slog.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+	setupLogging(config, os.Stderr)
+
+	if flag.Arg(0) == "generate" {
+		if err := runGenerate(config, flag.Args()[1:]); err != nil {
+			slog.Error("generation failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	shutdownTelemetry, err := setupTelemetry(context.Background(), config.Telemetry)
+	if err != nil {
+		slog.Error("failed to set up telemetry", "error", err)
+		os.Exit(1)
 	}
+	defer shutdownTelemetry(context.Background())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	service, err := NewService(*config)
 	if err != nil {
-		log.Fatalf("Failed to create service: %v", err)
+		slog.Error("failed to create service", "error", err)
+		os.Exit(1)
+	}
+	service.configPath = *configPath
+	go service.reloadOnSIGHUP(ctx)
+
+	http.HandleFunc("/terraform", service.rateLimited(service.handleTerraformRequest))
+	http.HandleFunc("/lockfile", service.handleLockFile)
+	http.HandleFunc("/artifacts", service.handleArtifact)
+	http.HandleFunc("/code", service.handleCode)
+	http.HandleFunc("/history", service.handleHistory)
+	http.HandleFunc("/context/{name}/destroy", service.rateLimited(service.handleContextDestroy))
+	http.HandleFunc("/history/compare", service.handleHistoryCompare)
+	http.HandleFunc("/jobs/{id}", service.handleJob)
+	http.HandleFunc("/readyz", service.handleReadyz)
+	http.HandleFunc("/healthz", service.handleHealthz)
+	http.Handle("/metrics", service.handleMetrics())
+	http.HandleFunc("/admin/executors", service.handleExecutors)
+	http.HandleFunc("/admin/reload", service.handleReload)
+	http.HandleFunc("/contexts/features", service.handleContextFeatures)
+	http.HandleFunc("/contexts", service.handleContexts)
+	http.HandleFunc("/contexts/{name}/workspaces", service.handleWorkspaces)
+	http.HandleFunc("/contexts/{name}/workspaces/{workspace}", service.handleWorkspaceDelete)
+	http.HandleFunc("/workspaces/eviction-candidates", service.handleEvictionCandidates)
+	http.HandleFunc("/workspaces/protection", service.handleWorkspaceProtection)
+	http.HandleFunc("/debug/workspace-cache", service.handleWorkspaceCache)
+
+	if config.Eviction.Enabled {
+		go service.runEvictionLoop(ctx)
 	}
 
-	http.HandleFunc("/terraform", service.handleTerraformRequest)
 	serverAddr := fmt.Sprintf(":%d", config.Server.Port)
-	log.Printf("Server starting on %s", serverAddr)
-	if err := http.ListenAndServe(serverAddr, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	inFlight := &inFlightHandler{next: http.DefaultServeMux}
+	server := &http.Server{Addr: serverAddr, Handler: inFlight}
+	slog.Info("server starting", "addr", serverAddr)
+	if err := serve(ctx, server, inFlight, time.Duration(config.Server.ShutdownTimeoutSeconds)*time.Second, service.Close); err != nil {
+		slog.Error("failed to start server", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validateJSON is `terraform validate -json` output for code with an
+// unsupported argument and a deprecated attribute.
+const validateJSON = `{
+  "format_version": "1.0",
+  "valid": false,
+  "error_count": 1,
+  "warning_count": 1,
+  "diagnostics": [
+    {
+      "severity": "error",
+      "summary": "Unsupported argument",
+      "detail": "An argument named \"sizes\" is not expected here. Did you mean \"size\"?",
+      "range": {
+        "filename": "main.tf",
+        "start": {"line": 4, "column": 3, "byte": 71},
+        "end": {"line": 4, "column": 8, "byte": 76}
+      },
+      "snippet": {
+        "context": "resource \"digitalocean_droplet\" \"web\"",
+        "code": "  sizes  = \"s-1vcpu-1gb\"",
+        "start_line": 4,
+        "highlight_start_offset": 2,
+        "highlight_end_offset": 7,
+        "values": []
+      }
+    },
+    {
+      "severity": "warning",
+      "summary": "Deprecated attribute",
+      "detail": "The attribute \"private_networking\" is deprecated.",
+      "range": {
+        "filename": "main.tf",
+        "start": {"line": 6, "column": 3, "byte": 120},
+        "end": {"line": 6, "column": 21, "byte": 138}
+      }
+    }
+  ]
+}`
+
+func TestParseValidateDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Diagnostic
+	}{
+		{
+			name:   "errors and warnings",
+			output: validateJSON,
+			want: []Diagnostic{
+				{
+					Severity: "error",
+					Summary:  "Unsupported argument",
+					Detail:   `An argument named "sizes" is not expected here. Did you mean "size"?`,
+					Range: &DiagnosticRange{
+						Filename: "main.tf",
+						Start:    DiagnosticPos{Line: 4, Column: 3, Byte: 71},
+						End:      DiagnosticPos{Line: 4, Column: 8, Byte: 76},
+					},
+				},
+				{
+					Severity: "warning",
+					Summary:  "Deprecated attribute",
+					Detail:   `The attribute "private_networking" is deprecated.`,
+					Range: &DiagnosticRange{
+						Filename: "main.tf",
+						Start:    DiagnosticPos{Line: 6, Column: 3, Byte: 120},
+						End:      DiagnosticPos{Line: 6, Column: 21, Byte: 138},
+					},
+				},
+			},
+		},
+		{
+			name:   "valid configuration",
+			output: `{"format_version":"1.0","valid":true,"error_count":0,"warning_count":0,"diagnostics":[]}`,
+			want:   []Diagnostic{},
+		},
+		{
+			name:   "surrounding whitespace",
+			output: "\n" + `{"format_version":"1.0","valid":true,"diagnostics":[]}` + "\n",
+			want:   []Diagnostic{},
+		},
+		{
+			name:   "plain text output",
+			output: "Success! The configuration is valid.",
+		},
+		{
+			name:   "JSON without format_version",
+			output: `{"diagnostics":[{"severity":"error","summary":"x"}]}`,
+		},
+		{
+			name: "empty output",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseValidateDiagnostics(tt.output)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseValidateDiagnostics() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		causes []failureCause
+		want   string
+	}{
+		{"none", nil, ""},
+		{
+			name: "resource and line",
+			causes: []failureCause{
+				{Summary: "Unsupported argument", Resource: "digitalocean_droplet.web", Line: 4},
+				{Summary: "Invalid reference", File: "outputs.tf", Line: 2},
+				{Summary: "quota exceeded"},
+			},
+			want: "\n\tErrors to fix:\n" +
+				"\t1. Unsupported argument (resource digitalocean_droplet.web, main.tf line 4)\n" +
+				"\t2. Invalid reference (outputs.tf line 2)\n" +
+				"\t3. quota exceeded\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatErrors(tt.causes); got != tt.want {
+				t.Errorf("formatErrors() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDiagnostics(t *testing.T) {
+	tests := []struct {
+		name        string
+		diagnostics []Diagnostic
+		want        []string
+	}{
+		{
+			name:        "from validate",
+			diagnostics: parseValidateDiagnostics(validateJSON),
+			want: []string{
+				`- error: Unsupported argument (main.tf:4:3): An argument named "sizes" is not expected here. Did you mean "size"?`,
+				`- warning: Deprecated attribute (main.tf:6:3)`,
+			},
+		},
+		{
+			name:        "without range or detail",
+			diagnostics: []Diagnostic{{Severity: "error", Summary: "Invalid reference"}},
+			want:        []string{"- error: Invalid reference\n"},
+		},
+		{
+			name: "none",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatDiagnostics(tt.diagnostics)
+			if tt.want == nil && got != "" {
+				t.Errorf("formatDiagnostics() = %q, want empty", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("formatDiagnostics() = %q, missing %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorPromptIncludesDiagnostics(t *testing.T) {
+	tfError := &TerraformError{
+		Message:     "validation failed",
+		Diagnostics: parseValidateDiagnostics(validateJSON),
+	}
+	prompt := generateErrorPrompt("a droplet", `resource "digitalocean_droplet" "web" {}`, tfError, "")
+	for _, want := range []string{"Unsupported argument (main.tf:4:3)", "Deprecated attribute (main.tf:6:3)"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("error prompt is missing diagnostic %q", want)
+		}
+	}
+}
+
+func TestValidateRegions(t *testing.T) {
+	tests := []struct {
+		name    string
+		regions []string
+		wantErr bool
+	}{
+		{name: "valid", regions: []string{"nyc1", "ams3", "us-east-1"}},
+		{name: "empty", regions: []string{"nyc1", ""}, wantErr: true},
+		{name: "duplicate", regions: []string{"nyc1", "nyc1"}, wantErr: true},
+		{name: "uppercase", regions: []string{"NYC1"}, wantErr: true},
+		{name: "path separator", regions: []string{"../prod"}, wantErr: true},
+		{name: "whitespace", regions: []string{"nyc 1"}, wantErr: true},
+		{name: "underscore", regions: []string{"us_east"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRegions(tt.regions)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRegions(%q) error = %v, wantErr %v", tt.regions, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegionalWorkspace(t *testing.T) {
+	tests := []struct {
+		workspace, region, want string
+	}{
+		{"", "nyc1", "nyc1"},
+		{"web", "nyc1", "web-nyc1"},
+	}
+	for _, tt := range tests {
+		if got := regionalWorkspace(tt.workspace, tt.region); got != tt.want {
+			t.Errorf("regionalWorkspace(%q, %q) = %q, want %q", tt.workspace, tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestAggregateRegions(t *testing.T) {
+	ok := &TerraformResponse{Success: true}
+	tests := []struct {
+		name        string
+		results     map[string]*TerraformResponse
+		wantSuccess bool
+		wantOutput  string
+	}{
+		{
+			name:        "all succeeded",
+			results:     map[string]*TerraformResponse{"nyc1": ok, "ams3": ok},
+			wantSuccess: true,
+			wantOutput:  "nyc1 (web-nyc1): succeeded\nams3 (web-ams3): succeeded",
+		},
+		{
+			name:       "not successful",
+			results:    map[string]*TerraformResponse{"nyc1": ok, "ams3": {Success: false}},
+			wantOutput: "nyc1 (web-nyc1): succeeded\nams3 (web-ams3): failed",
+		},
+		{
+			name:       "successful with an error",
+			results:    map[string]*TerraformResponse{"nyc1": {Success: true, Error: "apply failed"}, "ams3": ok},
+			wantOutput: "nyc1 (web-nyc1): failed\nams3 (web-ams3): succeeded",
+		},
+		{
+			name:       "successful with an init error",
+			results:    map[string]*TerraformResponse{"nyc1": ok, "ams3": {Success: true, InitError: "provider not found"}},
+			wantOutput: "nyc1 (web-nyc1): succeeded\nams3 (web-ams3): failed",
+		},
+		{
+			name:       "missing result",
+			results:    map[string]*TerraformResponse{"nyc1": ok},
+			wantOutput: "nyc1 (web-nyc1): succeeded\nams3 (web-ams3): failed",
+		},
+	}
+	req := TerraformRequest{Workspace: "web", Regions: []string{"nyc1", "ams3"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregateRegions(req, tt.results)
+			if got.Success != tt.wantSuccess {
+				t.Errorf("Success = %v, want %v", got.Success, tt.wantSuccess)
+			}
+			if got.Output != tt.wantOutput {
+				t.Errorf("Output = %q, want %q", got.Output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestParseTerraformErrorResource(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string // defaultErrorResourcePattern when empty
+		response TerraformResponse
+		want     string
+	}{
+		{
+			name: "error block",
+			response: TerraformResponse{Error: `
+│ Error: Unsupported argument
+│
+│   with digitalocean_droplet.web,
+│   on main.tf line 5, in resource "digitalocean_droplet" "web":
+│    5:   sizes = "s-1vcpu-1gb"
+`},
+			want: "digitalocean_droplet.web",
+		},
+		{
+			name: "indexed resource without box drawing",
+			response: TerraformResponse{Error: `Error: creating droplet
+
+  with digitalocean_droplet.web[1],
+  on main.tf line 1, in resource "digitalocean_droplet" "web":`},
+			want: "digitalocean_droplet.web[1]",
+		},
+		{
+			name:     "with inside a sentence",
+			response: TerraformResponse{Error: "Error: failed interacting with the API.\n\nPlease try again with different settings,\nthen retry."},
+		},
+		{
+			name:     "with at the start of a sentence",
+			response: TerraformResponse{Error: "Error: request failed\n\nwith status 500, retry later"},
+		},
+		{
+			name:     "with and no error block",
+			response: TerraformResponse{Error: "  with digitalocean_droplet.web,"},
+		},
+		{
+			name:     "position without with line",
+			response: TerraformResponse{Error: "Error: Missing required argument\n\n  on main.tf line 2, in resource \"aws_instance\" \"web\":"},
+			want:     "aws_instance.web",
+		},
+		{
+			name:     "from output when the error has none",
+			response: TerraformResponse{Error: "exit status 1", Output: "Error: Invalid reference\n\n  with aws_s3_bucket.logs,\n  on main.tf line 9:"},
+			want:     "aws_s3_bucket.logs",
+		},
+		{
+			name:    "custom pattern",
+			pattern: `(?m)^\s*mit ([A-Za-z0-9_.]+),$`,
+			response: TerraformResponse{Error: `Error: Ungültiges Argument
+
+  mit digitalocean_droplet.web,`},
+			want: "digitalocean_droplet.web",
+		},
+		{
+			name:     "empty",
+			response: TerraformResponse{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := tt.pattern
+			if pattern == "" {
+				pattern = defaultErrorResourcePattern
+			}
+			s := &Service{errorResourcePattern: regexp.MustCompile(pattern)}
+			tfError := s.parseTerraformError(&tt.response)
+			if tfError.Resource != tt.want {
+				t.Errorf("Resource = %q, want %q", tfError.Resource, tt.want)
+			}
+			if tfError.Message != tt.response.Error {
+				t.Errorf("Message = %q, want the response error", tfError.Message)
+			}
+		})
+	}
+}
+
+func TestCheckProtectedResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		protected []string
+		req       TerraformRequest
+		want      bool
+	}{
+		{name: "protected types", protected: []string{"aws_db_instance"}, want: true},
+		{name: "policy checks off", protected: []string{"aws_db_instance"}, req: TerraformRequest{features: FeatureFlags{PolicyChecks: false}}, want: true},
+		{name: "forced", protected: []string{"aws_db_instance"}, req: TerraformRequest{Force: true}},
+		{name: "nothing protected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{currentConfig: &Config{ProtectedResourceTypes: tt.protected}}
+			if got := s.checkProtectedResources(tt.req); got != tt.want {
+				t.Errorf("checkProtectedResources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtectedReplacements(t *testing.T) {
+	const plan = `{"resource_changes":[
+		{"address":"aws_db_instance.main","type":"aws_db_instance","change":{"actions":["delete","create"]}},
+		{"address":"aws_db_instance.replica","type":"aws_db_instance","change":{"actions":["update"]}},
+		{"address":"aws_instance.web","type":"aws_instance","change":{"actions":["create","delete"]}},
+		{"address":"aws_s3_bucket.logs","type":"aws_s3_bucket","change":{"actions":["delete"]}}
+	]}`
+	tests := []struct {
+		name      string
+		protected []string
+		want      []string
+	}{
+		{name: "exact type", protected: []string{"aws_db_instance"}, want: []string{"aws_db_instance.main"}},
+		{name: "glob", protected: []string{"aws_*"}, want: []string{"aws_db_instance.main", "aws_instance.web"}},
+		{name: "delete only is not a replacement", protected: []string{"aws_s3_bucket"}},
+		{name: "nothing protected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := protectedReplacements(plan, tt.protected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("protectedReplacements() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := protectedReplacements("not json", []string{"aws_*"}); err == nil {
+		t.Error("protectedReplacements() of invalid JSON succeeded")
+	}
+}
+
+func TestRequireCodeReuse(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		implicit bool
+		want     int
+	}{
+		{"apply without description", `{"action":"apply","workspace":"ws"}`, false, http.StatusBadRequest},
+		{"implicit reuse, empty workspace", `{"action":"apply","workspace":"ws"}`, true, http.StatusNotFound},
+		{"reuse, empty workspace", `{"action":"apply","workspace":"ws","reuse_existing_code":true}`, false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&Config{ImplicitCodeReuse: tt.implicit})
+			s.executorClient = newFakeExecutor()
+			w := httptest.NewRecorder()
+			s.handleTerraformRequest(w, httptest.NewRequest(http.MethodPost, "/terraform", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestReuseExistingCode(t *testing.T) {
+	const existing = `resource "digitalocean_droplet" "web" {}`
+	tests := []struct {
+		name      string
+		req       TerraformRequest
+		implicit  bool
+		seeded    bool
+		wantCode  string
+		wantErr   string
+		wantCalls int // Generator calls
+	}{
+		{
+			name:     "reuse",
+			req:      TerraformRequest{Action: ActionApply, ReuseExistingCode: true},
+			seeded:   true,
+			wantCode: existing,
+		},
+		{
+			name:     "implicit reuse",
+			req:      TerraformRequest{Action: ActionApply},
+			implicit: true,
+			seeded:   true,
+			wantCode: existing,
+		},
+		{
+			name:    "nothing to reuse",
+			req:     TerraformRequest{Action: ActionApply, ReuseExistingCode: true},
+			wantErr: "no existing code to reuse in ctx/ws",
+		},
+		{
+			name:      "description generates",
+			req:       TerraformRequest{Action: ActionApply, Description: "a droplet"},
+			seeded:    true,
+			wantCode:  `resource "digitalocean_droplet" "db" {}`,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newFakeExecutor()
+			if tt.seeded {
+				executor.seed("ctx", "ws", existing, nil)
+			}
+			generator := &fakeGenerator{replies: []string{"```hcl\n" + `resource "digitalocean_droplet" "db" {}` + "\n```"}}
+			s := newTestService(&Config{ImplicitCodeReuse: tt.implicit})
+			s.executorClient, s.generator = executor, generator
+
+			req := tt.req
+			req.Context, req.Workspace, req.DryRun = "ctx", "ws", true
+			response, err := s.processTerraformRequest(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Error != tt.wantErr {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantErr)
+			}
+			if strings.TrimSpace(response.Code) != tt.wantCode {
+				t.Errorf("code = %q, want %q", response.Code, tt.wantCode)
+			}
+			if got := generator.calls(); got != tt.wantCalls {
+				t.Errorf("generator calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFollowUpApplyReusesCode(t *testing.T) {
+	req := TerraformRequest{Context: "ctx", Workspace: "ws", Action: ActionImport}
+	followUps := followUps(req, &TerraformResponse{Success: true})
+	if len(followUps) != 1 {
+		t.Fatalf("follow-ups = %+v, want one apply", followUps)
+	}
+	if apply := followUps[0].Request; apply.Action != ActionApply || !apply.ReuseExistingCode || apply.Description != "" {
+		t.Errorf("follow-up = %+v, want an apply reusing the code", apply)
+	}
+}
+
+func TestInitFailureSkipsRegeneration(t *testing.T) {
+	executor := newFakeExecutor()
+	executor.initErrs["ws"] = "Error: Failed to query available provider packages"
+	code := "```hcl\n" + `resource "digitalocean_droplet" "web" {}` + "\n```"
+	generator := &fakeGenerator{replies: []string{code, code}}
+	s := newTestService(nil)
+	s.executorClient, s.generator = executor, generator
+
+	response, err := s.processTerraformRequest(context.Background(), TerraformRequest{
+		Context:     "ctx",
+		Workspace:   "ws",
+		Action:      ActionPlan,
+		Description: "a droplet",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := generator.calls(); got != 1 {
+		t.Errorf("generator calls = %d, want 1: init failures aren't regenerated", got)
+	}
+	if got := executor.called("Plan"); len(got) != 1 {
+		t.Errorf("plans = %v, want one", got)
+	}
+	if response.Success || response.Error != "terraform init failed: Error: Failed to query available provider packages" {
+		t.Errorf("success = %v, error = %q, want the init failure", response.Success, response.Error)
+	}
+	if response.InitOutput != "Initializing provider plugins..." || response.InitError == "" {
+		t.Errorf("init output = %q, init error = %q, want both reported", response.InitOutput, response.InitError)
+	}
+	if response.ErrorCode != ErrorCodeInit {
+		t.Errorf("error code = %q, want %q", response.ErrorCode, ErrorCodeInit)
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	executor := newFakeExecutor()
+	executor.errs["Plan ws"] = status.Error(codes.Unavailable, "executor restarting")
+	code := "```hcl\n" + `resource "digitalocean_droplet" "web" {}` + "\n```"
+	s := newTestService(nil)
+	s.executorClient, s.generator = executor, &fakeGenerator{replies: []string{code}}
+	delay := 60
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := s.processTerraformRequest(ctx, TerraformRequest{
+		Context:           "ctx",
+		Workspace:         "ws",
+		Action:            ActionPlan,
+		Description:       "a droplet",
+		RetryDelaySeconds: &delay,
+	})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("request took %v, want the retry delay cut short by the context", elapsed)
+	}
+	if err == nil {
+		t.Error("error = nil, want the last attempt's error")
+	}
+	if got := executor.called("Plan"); len(got) != 1 {
+		t.Errorf("plans = %v, want one: no attempt after the context is done", got)
+	}
+}
+
+func TestLockFileWarnings(t *testing.T) {
+	const mismatch = "Error: the cached package for digitalocean/digitalocean 2.34.1 does not match any of the checksums recorded in the dependency lock file"
+	tests := []struct {
+		name    string
+		outputs []string
+		want    []string
+	}{
+		{"none", []string{"Plan: 1 to add, 0 to change, 0 to destroy."}, nil},
+		{"from init output", []string{"", "╷\n│ " + mismatch + "\n╵"}, []string{mismatch}},
+		{"deduplicated", []string{mismatch, mismatch}, []string{mismatch}},
+		{"incomplete", []string{"Warning: Incomplete lock file information for providers"}, []string{"Warning: Incomplete lock file information for providers"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockFileWarnings(tt.outputs...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lockFileWarnings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateGeneratedCodeStripsOnlyLLMOutput(t *testing.T) {
+	const (
+		resource = `resource "digitalocean_droplet" "web" {}`
+		withVar  = "variable \"size\" {}\n\n" + resource
+		withProv = "provider \"digitalocean\" {}\n\n" + resource
+	)
+	tests := []struct {
+		name      string
+		code      string
+		generated bool
+		wantCode  string
+		wantErr   string // Prefix
+	}{
+		{"generated variable stripped", withVar, true, resource, ""},
+		{"generated provider rejected", withProv, true, withProv, "generated code configures providers"},
+		{"user variable kept", withVar, false, withVar, ""},
+		{"user provider kept", withProv, false, withProv, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(nil)
+			code, invalid := s.validateGeneratedCode(context.Background(), tt.code, true, tt.generated)
+			if code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			if tt.wantErr == "" && invalid != nil || tt.wantErr != "" && (invalid == nil || !strings.HasPrefix(invalid.Error, tt.wantErr)) {
+				t.Errorf("invalid = %+v, want error %q", invalid, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReusedCodeIsNotSanitized(t *testing.T) {
+	const existing = "variable \"size\" {}\n\nresource \"digitalocean_droplet\" \"web\" {\n  size = var.size\n}\n"
+	executor := newFakeExecutor()
+	executor.seed("ctx", "ws", existing, map[string]string{"size": "s-1vcpu-1gb"})
+	s := newTestService(nil)
+	s.executorClient = executor
+
+	response, err := s.processTerraformRequest(context.Background(), TerraformRequest{
+		Context:           "ctx",
+		Workspace:         "ws",
+		Action:            ActionPlan,
+		ReuseExistingCode: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Success || response.Error != "" {
+		t.Fatalf("plan failed: %s", response.Error)
+	}
+	if got := executor.workspace("ctx", "ws").code; got != existing {
+		t.Errorf("workspace code = %q, want it unchanged", got)
+	}
+}
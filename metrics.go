@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Values of the status label.
+const (
+	MetricSuccess = "success"
+	MetricFailure = "failure" // Processed, but terraform or generation failed
+	MetricError   = "error"   // The request could not be processed
+)
+
+// metrics are the Prometheus collectors of a Service. Labels are limited to
+// bounded values; descriptions, contexts and workspaces are never labels.
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	retries         *prometheus.CounterVec
+	llmLatency      *prometheus.HistogramVec
+	executorLatency *prometheus.HistogramVec
+	llmQueueDepth   prometheus.Gauge
+	llmInFlight     prometheus.Gauge
+
+	generationCacheLookups     *prometheus.CounterVec
+	generationCacheSavedTokens *prometheus.CounterVec
+	generationCacheSavedCost   prometheus.Counter
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aiops_requests_total",
+			Help: "Terraform requests by action and status.",
+		}, []string{"action", "status"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aiops_retry_attempts_total",
+			Help: "Attempts after the first in the retry loop, by action.",
+		}, []string{"action"}),
+		llmLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "aiops_llm_call_duration_seconds",
+			Help:    "Duration of LLM calls by status.",
+			Buckets: []float64{0.5, 1, 2.5, 5, 10, 20, 40, 80, 160},
+		}, []string{"status"}),
+		executorLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "aiops_executor_call_duration_seconds",
+			Help:    "Duration of executor actions by action and status.",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800},
+		}, []string{"action", "status"}),
+		llmQueueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aiops_llm_queue_depth",
+			Help: "LLM calls waiting for a slot under max_concurrent_llm_calls.",
+		}),
+		llmInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "aiops_llm_calls_in_flight",
+			Help: "LLM calls holding a slot.",
+		}),
+		generationCacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aiops_generation_cache_lookups_total",
+			Help: "Generation cache lookups by result, hit or miss.",
+		}, []string{"result"}),
+		generationCacheSavedTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aiops_generation_cache_saved_tokens_total",
+			Help: "LLM tokens saved by generation cache hits, by type, input or output.",
+		}, []string{"type"}),
+		generationCacheSavedCost: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "aiops_generation_cache_saved_cost_usd_total",
+			Help: "Estimated LLM cost in USD saved by generation cache hits.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.retries,
+		m.llmLatency,
+		m.executorLatency,
+		m.llmQueueDepth,
+		m.llmInFlight,
+		m.generationCacheLookups,
+		m.generationCacheSavedTokens,
+		m.generationCacheSavedCost,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// responseFailed reports whether a processed request or call failed: it
+// wasn't successful, or reported an error or a failed init anyway.
+func responseFailed(response *TerraformResponse) bool {
+	return response == nil || !response.Success || response.Error != "" || response.InitError != ""
+}
+
+// metricStatus returns the status label of a processed request or call.
+func metricStatus(response *TerraformResponse, err error) string {
+	switch {
+	case err != nil:
+		return MetricError
+	case responseFailed(response):
+		return MetricFailure
+	default:
+		return MetricSuccess
+	}
+}
+
+// The observe methods do nothing on a nil *metrics, as in the generate
+// subcommand.
+
+func (m *metrics) observeRequest(action Action, status string) {
+	if m != nil {
+		m.requests.WithLabelValues(string(action), status).Inc()
+	}
+}
+
+func (m *metrics) observeRetry(action Action) {
+	if m != nil {
+		m.retries.WithLabelValues(string(action)).Inc()
+	}
+}
+
+func (m *metrics) observeLLMCall(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	status := MetricSuccess
+	if err != nil {
+		status = MetricError
+	}
+	m.llmLatency.WithLabelValues(status).Observe(time.Since(start).Seconds())
+}
+
+func (m *metrics) observeExecutorCall(action Action, start time.Time, response *TerraformResponse, err error) {
+	if m != nil {
+		m.executorLatency.WithLabelValues(string(action), metricStatus(response, err)).Observe(time.Since(start).Seconds())
+	}
+}
+
+// addLLMWaiting adds delta to the number of LLM calls waiting for a slot.
+func (m *metrics) addLLMWaiting(delta float64) {
+	if m != nil {
+		m.llmQueueDepth.Add(delta)
+	}
+}
+
+// addLLMInFlight adds delta to the number of LLM calls holding a slot.
+func (m *metrics) addLLMInFlight(delta float64) {
+	if m != nil {
+		m.llmInFlight.Add(delta)
+	}
+}
+
+func (m *metrics) observeGenerationCacheMiss() {
+	if m != nil {
+		m.generationCacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// observeGenerationCacheHit counts a cache hit and the tokens and cost of
+// the generation it saved.
+func (m *metrics) observeGenerationCacheHit(inputTokens, outputTokens int64, cost float64) {
+	if m == nil {
+		return
+	}
+	m.generationCacheLookups.WithLabelValues("hit").Inc()
+	m.generationCacheSavedTokens.WithLabelValues("input").Add(float64(inputTokens))
+	m.generationCacheSavedTokens.WithLabelValues("output").Add(float64(outputTokens))
+	m.generationCacheSavedCost.Add(cost)
+}
+
+func (s *Service) handleMetrics() http.Handler {
+	return promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGenerationCacheMetrics(t *testing.T) {
+	s := newTestService(&Config{
+		GenerationCacheTTLSeconds: 60,
+		ModelPricing:              map[string]ModelPricing{"test-model": {InputPerMTok: 1, OutputPerMTok: 1}},
+	})
+	s.metrics = newMetrics()
+	s.generator = &fakeGenerator{replies: []string{testCode}}
+
+	for range 3 {
+		if _, err := s.generateTerraformCode(context.Background(), "test-model", "digitalocean", "a droplet", nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"misses", testutil.ToFloat64(s.metrics.generationCacheLookups.WithLabelValues("miss")), 1},
+		{"hits", testutil.ToFloat64(s.metrics.generationCacheLookups.WithLabelValues("hit")), 2},
+		{"saved input tokens", testutil.ToFloat64(s.metrics.generationCacheSavedTokens.WithLabelValues("input")), 200},
+		{"saved output tokens", testutil.ToFloat64(s.metrics.generationCacheSavedTokens.WithLabelValues("output")), 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+	if cost := testutil.ToFloat64(s.metrics.generationCacheSavedCost); cost <= 0 {
+		t.Errorf("saved cost = %v, want > 0", cost)
+	}
+}
+
+func TestLLMLimiterMetrics(t *testing.T) {
+	m := newMetrics()
+	l := newLLMLimiter(1, m)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	go func() { acquired <- l.acquire(context.Background()) }()
+	for testutil.ToFloat64(m.llmQueueDepth) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(m.llmInFlight); got != 1 {
+		t.Errorf("in flight with a caller waiting = %v, want 1", got)
+	}
+
+	l.release()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(m.llmQueueDepth); got != 0 {
+		t.Errorf("queue depth after the wait = %v, want 0", got)
+	}
+	l.release()
+	if got := testutil.ToFloat64(m.llmInFlight); got != 0 {
+		t.Errorf("in flight after release = %v, want 0", got)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	pb "request-processor/api/proto"
+)
+
+// sensitiveOutput replaces sensitive output values, as terraform prints them.
+const sensitiveOutput = "<sensitive>"
+
+// workspaceOutputs reads the outputs in a workspace's state. String values
+// are returned as is and other values as JSON.
+func (s *Service) workspaceOutputs(ctx context.Context, contextName, workspace string) (map[string]string, error) {
+	resp, err := s.executorClient.Output(ctx, &pb.OutputRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	var raw map[string]struct {
+		Sensitive bool            `json:"sensitive"`
+		Value     json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(resp.OutputJson), &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode outputs: %v", err)
+	}
+	outputs := make(map[string]string, len(raw))
+	for name, output := range raw {
+		var value string
+		switch {
+		case output.Sensitive:
+			value = sensitiveOutput
+		case json.Unmarshal(output.Value, &value) == nil:
+		default:
+			value = string(output.Value)
+		}
+		outputs[name] = s.redact(ctx, value)
+	}
+	return outputs, nil
+}
+
+// setOutputs sets response.Outputs after a successful apply. When the outputs
+// can't be read, the failure is logged and response.Outputs is left nil.
+func (s *Service) setOutputs(ctx context.Context, contextName, workspace string, response *TerraformResponse) {
+	outputs, err := s.workspaceOutputs(ctx, contextName, workspace)
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to read outputs", "context", contextName, "workspace", workspace, "error", err)
+		return
+	}
+	response.Outputs = outputs
+}
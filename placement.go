@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Where ResourcePlacement.Region was found.
+const (
+	RegionFromResource = "resource" // The resource's own region or location attribute
+	RegionFromProvider = "provider" // The region set on the provider configuration
+	RegionUnknown      = "unknown"  // Not set in the code; the provider's default or environment applies
+)
+
+// ResourcePlacement is the provider and region a resource actually uses,
+// which may differ from what the description implied because of defaults.
+type ResourcePlacement struct {
+	Provider      string `json:"provider"`                 // e.g. registry.terraform.io/digitalocean/digitalocean
+	ProviderAlias string `json:"provider_alias,omitempty"` // Provider configuration, e.g. "aws.west"; empty for the default one
+	Region        string `json:"region,omitempty"`
+	RegionSource  string `json:"region_source"`
+}
+
+// regionAttributes are the resource attributes providers use for placement,
+// in order of preference.
+var regionAttributes = []string{"region", "location", "zone"}
+
+type placementPlan struct {
+	ResourceChanges []struct {
+		Address      string `json:"address"`
+		ProviderName string `json:"provider_name"`
+		Change       struct {
+			After map[string]any `json:"after"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+	Configuration struct {
+		ProviderConfig map[string]struct {
+			Alias       string                    `json:"alias"`
+			Expressions map[string]planExpression `json:"expressions"`
+		} `json:"provider_config"`
+		RootModule struct {
+			Resources []struct {
+				Address           string                    `json:"address"`
+				ProviderConfigKey string                    `json:"provider_config_key"`
+				Expressions       map[string]planExpression `json:"expressions"`
+			} `json:"resources"`
+		} `json:"root_module"`
+	} `json:"configuration"`
+}
+
+type planExpression struct {
+	ConstantValue any `json:"constant_value"`
+}
+
+// resourcePlacements reads the provider and region of every resource in a
+// plan (`terraform show -json`). Regions come from the planned values when
+// known, then from the configuration, then from the provider configuration.
+func resourcePlacements(planOutput string) (map[string]ResourcePlacement, error) {
+	var plan placementPlan
+	if err := json.Unmarshal([]byte(planOutput), &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %v", err)
+	}
+
+	providerKeys := make(map[string]string)
+	configured := make(map[string]map[string]planExpression)
+	for _, resource := range plan.Configuration.RootModule.Resources {
+		providerKeys[resource.Address] = resource.ProviderConfigKey
+		configured[resource.Address] = resource.Expressions
+	}
+
+	placements := make(map[string]ResourcePlacement, len(plan.ResourceChanges))
+	for _, rc := range plan.ResourceChanges {
+		placement := ResourcePlacement{Provider: rc.ProviderName, RegionSource: RegionUnknown}
+		configAddress := resourceIndex.ReplaceAllString(rc.Address, "")
+		key := providerKeys[configAddress]
+		provider := plan.Configuration.ProviderConfig[key]
+		if provider.Alias != "" {
+			placement.ProviderAlias = key
+		}
+
+		for _, attribute := range regionAttributes {
+			if region, ok := rc.Change.After[attribute].(string); ok && region != "" {
+				placement.Region, placement.RegionSource = region, RegionFromResource
+				break
+			}
+			if region, ok := configured[configAddress][attribute].ConstantValue.(string); ok && region != "" {
+				placement.Region, placement.RegionSource = region, RegionFromResource
+				break
+			}
+		}
+		if placement.RegionSource == RegionUnknown {
+			if region, ok := provider.Expressions["region"].ConstantValue.(string); ok && region != "" {
+				placement.Region, placement.RegionSource = region, RegionFromProvider
+			}
+		}
+		placements[rc.Address] = placement
+	}
+	return placements, nil
+}
+
+// setPlacements fills response.Placements from the plan of a plan or apply.
+func setPlacements(response *TerraformResponse) {
+	if response.planJSON == "" {
+		return
+	}
+	placements, err := resourcePlacements(response.planJSON)
+	if err != nil {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("placements: %v", err))
+		return
+	}
+	if len(placements) > 0 {
+		response.Placements = placements
+	}
+}
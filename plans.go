@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const planNamespace = "plans"
+
+// storedPlan is the code and variables of a successful plan, kept so the
+// plan can be approved and then applied by ID without regenerating code.
+//
+// Applying a plan runs its code again: if the infrastructure drifted since
+// the plan, the apply acts on the drift too.
+type storedPlan struct {
+	Context   string            `json:"context"`
+	Workspace string            `json:"workspace"`
+	Code      string            `json:"code"`
+	Variables map[string]string `json:"variables,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// storePlan saves the code of a successful plan and returns its plan ID.
+func (s *Service) storePlan(ctx context.Context, req TerraformRequest, code string) (string, error) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	value, err := json.Marshal(storedPlan{
+		Context:   req.Context,
+		Workspace: req.Workspace,
+		Code:      code,
+		Variables: req.Variables,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	ttl := time.Duration(s.config().PlanTTLSeconds) * time.Second
+	if err := s.store.Put(ctx, planNamespace, id, value, ttl); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// loadPlan returns the plan stored under id. Plans are bound to the
+// workspace they were made in.
+func (s *Service) loadPlan(ctx context.Context, id, contextName, workspace string) (*storedPlan, error) {
+	value, err := s.store.Get(ctx, planNamespace, id)
+	if err != nil {
+		return nil, err
+	}
+	var plan storedPlan
+	if err := json.Unmarshal(value, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %v", err)
+	}
+	if plan.Context != contextName || plan.Workspace != workspace {
+		return nil, fmt.Errorf("plan %s was made for %s/%s", id, plan.Context, plan.Workspace)
+	}
+	return &plan, nil
+}
+
+// consumePlan deletes a plan once it has been applied, so an approval is
+// used only once.
+func (s *Service) consumePlan(ctx context.Context, id string) {
+	if err := s.store.Delete(ctx, planNamespace, id); err != nil && !errors.Is(err, ErrNotFound) {
+		s.runLogger(ctx).Warn("failed to delete applied plan", "plan_id", id, "error", err)
+	}
+}
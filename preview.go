@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func generateChangePreviewPrompt(description string, existingCode string, provider string) string {
+	if existingCode == "" {
+		existingCode = "(none)"
+	}
+	return fmt.Sprintf(`You are a DevOps engineer. A user asked for changes to their infrastructure. Before any code is written, explain what you will do so they can confirm.
+
+	Current Infrastructure:
+	%s
+
+	Requested Changes:
+	%s
+
+	Requirements:
+	1. Describe the changes in plain language, one change per line, starting with "I will"
+	2. Mention every resource that will be added, changed, replaced or removed
+	3. Call out changes that may cause downtime or data loss
+	4. DO NOT include any Terraform code%s`,
+		existingCode,
+		description,
+		providerGuidance(provider),
+	)
+}
+
+// previewChanges asks the model for a natural-language plan of changes for a
+// request, without generating or executing any code.
+func (s *Service) previewChanges(ctx context.Context, model, provider, description, existingCode string) (*generation, error) {
+	prompt := generateChangePreviewPrompt(description, existingCode, provider)
+	s.runLogger(ctx).Debug("LLM request", "description", description, "prompt", prompt)
+
+	gen, err := s.complete(ctx, model, prompt, 1024)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate change preview: %v", err)
+	}
+	gen.Code = strings.TrimSpace(gen.Code)
+	return gen, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPreviewChanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     string
+		existingCode string
+		wantPrompt   []string
+		notInPrompt  []string
+	}{
+		{
+			name:        "generic",
+			wantPrompt:  []string{"Current Infrastructure:\n\t(none)", "Requested Changes:\n\ta droplet"},
+			notInPrompt: []string{"Provider conventions"},
+		},
+		{
+			name:         "with provider",
+			provider:     "aws",
+			existingCode: `resource "aws_instance" "web" {}`,
+			wantPrompt:   []string{`resource "aws_instance" "web" {}`, "Provider conventions (aws)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := &fakeGenerator{replies: []string{"  I will add a droplet.\n"}}
+			s := newTestService(nil)
+			s.generator = generator
+
+			gen, err := s.previewChanges(context.Background(), "test-model", tt.provider, "a droplet", tt.existingCode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gen.Code != "I will add a droplet." {
+				t.Errorf("preview = %q, want it trimmed", gen.Code)
+			}
+			if gen.InputTokens == 0 || gen.Model != "test-model" {
+				t.Errorf("preview generation = %+v, want the model's usage", gen)
+			}
+			prompt := generator.prompts[0]
+			for _, want := range tt.wantPrompt {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("prompt is missing %q:\n%s", want, prompt)
+				}
+			}
+			for _, unwanted := range tt.notInPrompt {
+				if strings.Contains(prompt, unwanted) {
+					t.Errorf("prompt contains %q:\n%s", unwanted, prompt)
+				}
+			}
+		})
+	}
+}
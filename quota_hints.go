@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// QuotaHintRule maps a provider error to the limit it hit. Resource may
+// reference capture groups of Pattern, e.g. "$1".
+type QuotaHintRule struct {
+	Provider     string `yaml:"provider"`
+	Pattern      string `yaml:"pattern"`
+	Resource     string `yaml:"resource"`
+	Instructions string `yaml:"instructions"`
+	URL          string `yaml:"url"`
+}
+
+// QuotaHint is returned with failures caused by a provider quota or limit.
+type QuotaHint struct {
+	Provider     string `json:"provider"`
+	Resource     string `json:"resource"`
+	Instructions string `json:"instructions"`
+	URL          string `json:"url,omitempty"`
+}
+
+var defaultQuotaHintRules = []QuotaHintRule{
+	{
+		Provider:     "digitalocean",
+		Pattern:      `(?i)exceed your (droplet|volume|floating ip|reserved ip|load balancer|kubernetes node|database|snapshot) limit`,
+		Resource:     "$1",
+		Instructions: "Ask DigitalOcean support for a higher limit from the control panel, or delete unused resources.",
+		URL:          "https://docs.digitalocean.com/products/platform/resource-limits/",
+	},
+	{
+		Provider:     "digitalocean",
+		Pattern:      `(?i)reached the maximum number of (\w[\w ]*?)s? (allowed|for your account)`,
+		Resource:     "$1",
+		Instructions: "Ask DigitalOcean support for a higher limit, or delete unused resources.",
+		URL:          "https://docs.digitalocean.com/products/platform/resource-limits/",
+	},
+	{
+		Provider:     "aws",
+		Pattern:      `(VcpuLimitExceeded|AddressLimitExceeded|VpcLimitExceeded|InstanceLimitExceeded|\w+LimitExceeded)`,
+		Resource:     "$1",
+		Instructions: "Request an increase in the AWS Service Quotas console for the affected service and region.",
+		URL:          "https://console.aws.amazon.com/servicequotas/home",
+	},
+	{
+		Provider:     "google",
+		Pattern:      `Quota '(\w+)' exceeded`,
+		Resource:     "$1",
+		Instructions: "Request a quota increase on the IAM & Admin > Quotas page of the project.",
+		URL:          "https://console.cloud.google.com/iam-admin/quotas",
+	},
+}
+
+type quotaHintMatcher struct {
+	rule    QuotaHintRule
+	pattern *regexp.Regexp
+}
+
+// compileQuotaHints compiles the configured rules followed by the defaults,
+// so configured rules take precedence.
+func compileQuotaHints(rules []QuotaHintRule) ([]quotaHintMatcher, error) {
+	var matchers []quotaHintMatcher
+	for _, rule := range append(append([]QuotaHintRule(nil), rules...), defaultQuotaHintRules...) {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota hint pattern for %s: %v", rule.Provider, err)
+		}
+		matchers = append(matchers, quotaHintMatcher{rule: rule, pattern: pattern})
+	}
+	return matchers, nil
+}
+
+// addQuotaHint attaches a quota hint to a failed response whose error matches
+// a rule, and classifies it as a quota error.
+func (s *Service) addQuotaHint(response *TerraformResponse) {
+	if response.Success && response.Error == "" {
+		return
+	}
+
+	text := response.Error + "\n" + response.Output
+	for _, m := range s.quotaHints {
+		match := m.pattern.FindStringSubmatchIndex(text)
+		if match == nil {
+			continue
+		}
+		response.QuotaHint = &QuotaHint{
+			Provider:     m.rule.Provider,
+			Resource:     string(m.pattern.ExpandString(nil, m.rule.Resource, text, match)),
+			Instructions: m.rule.Instructions,
+			URL:          m.rule.URL,
+		}
+		response.ErrorCode = ErrorCodeQuota
+		response.Suggestions = errorSuggestions[ErrorCodeQuota]
+		return
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRateLimitClients bounds the clients tracked by the rate limiter, so
+// requests from many distinct addresses cannot exhaust memory.
+const maxRateLimitClients = 10000
+
+// rateLimiter is a token bucket per client: each client may make burst
+// requests at once, refilled at perMinute requests per minute.
+type rateLimiter struct {
+	rate  float64 // Tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it
+// returns false and how long until a token is available.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitClients {
+			l.evict(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// evict drops the buckets that have refilled, which is the same as not
+// tracking them. If none have, the least recently used bucket is dropped.
+func (l *rateLimiter) evict(now time.Time) {
+	var oldest string
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+			continue
+		}
+		if oldest == "" || bucket.last.Before(l.buckets[oldest].last) {
+			oldest = client
+		}
+	}
+	if len(l.buckets) >= maxRateLimitClients {
+		delete(l.buckets, oldest)
+	}
+}
+
+// clientIdentity identifies the caller of r: its bearer token, hashed so
+// tokens are not kept in memory, or else its remote IP.
+func clientIdentity(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:8])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimited wraps next with the per-client rate limit. Requests over the
+// limit get 429 with Retry-After. It returns next as is when rate limiting is
+// off.
+func (s *Service) rateLimited(next http.HandlerFunc) http.HandlerFunc {
+	if s.rateLimiter == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := s.rateLimiter.allow(clientIdentity(r), time.Now())
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, http.StatusTooManyRequests, APIErrorRateLimited, fmt.Sprintf("rate limit of %d requests per minute exceeded, retry in %ds", s.config().RateLimitPerMinute, seconds), "")
+			return
+		}
+		next(w, r)
+	}
+}
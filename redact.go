@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// secretPatterns match credentials that may show up in prompts, code or
+// terraform output.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`dop_v1_[0-9a-f]{64}`),               // DigitalOcean personal access tokens
+	regexp.MustCompile(`sk-ant-[A-Za-z0-9_\-]{20,}`),        // Anthropic API keys
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._\-]{16,}`), // Authorization headers
+	regexp.MustCompile(`AKIA[0-9A-Z]{16}`),                  // AWS access key IDs
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`(?i)((?:password|secret|token|api_key|access_key)\s*[=:]\s*)"[^"]*"`), // HCL and YAML assignments
+}
+
+const redacted = "[REDACTED]"
+
+// redact masks known secrets in text before it leaves the service, including
+// the service's own API key and admin token and any secrets injected into the
+// workspace ctx was prepared for.
+func (s *Service) redact(ctx context.Context, text string) string {
+	if hashes, ok := ctx.Value(injectedSecretsKey{}).(map[string]bool); ok {
+		text = maskHashedSecrets(text, hashes)
+	}
+	for _, secret := range []string{s.config().AnthropicAPIKey, s.config().AdminToken, s.config().WebhookSecret} {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	return redactSecrets(text, s.redactPatterns)
+}
+
+// redactSecrets masks the matches of secretPatterns and of extra, the
+// configured redact_patterns. For patterns with a group, the group is kept
+// and the quoted value after it masked.
+func redactSecrets(text string, extra []*regexp.Regexp) string {
+	for _, patterns := range [][]*regexp.Regexp{secretPatterns, extra} {
+		for _, pattern := range patterns {
+			if pattern.NumSubexp() > 0 {
+				text = pattern.ReplaceAllString(text, `${1}"`+redacted+`"`)
+				continue
+			}
+			text = pattern.ReplaceAllString(text, redacted)
+		}
+	}
+	return text
+}
+
+func compileRedactPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact_patterns pattern %q: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+)
+
+// startupSettings are the config settings, by yaml key, used only to build
+// the service: connections, stores, compiled patterns, limiters and the
+// like. A reload keeps their startup values; changing them needs a restart.
+// Everything else, such as models, retries and timeouts of actions, takes
+// effect for new requests.
+var startupSettings = map[string]bool{
+	"llm_provider":                true,
+	"openai":                      true,
+	"anthropic_api_key":           true,
+	"grpc_server_addr":            true,
+	"grpc_tls_ca":                 true,
+	"grpc_tls_cert":               true,
+	"grpc_tls_key":                true,
+	"grpc_insecure":               true,
+	"executors":                   true,
+	"max_concurrent_llm_calls":    true,
+	"rate_limit_per_minute":       true,
+	"rate_limit_burst":            true,
+	"log_level":                   true,
+	"log_format":                  true,
+	"store":                       true,
+	"history":                     true,
+	"workspace_cache_ttl_seconds": true,
+	"lock_timeout_seconds":        true,
+	"resource_name_pattern":       true,
+	"error_resource_pattern":      true,
+	"timeout_seconds":             true,
+	"warnings_as_errors":          true,
+	"redact_patterns":             true,
+	"quota_hints":                 true,
+	"telemetry":                   true,
+	"otel_endpoint":               true,
+	"eviction":                    true,
+	"cost_estimation":             true,
+	"server":                      true,
+	"jobs":                        true,
+	"callback_allowed_hosts":      true,
+}
+
+// keepStartupSettings copies the startup settings of current into config and
+// returns the keys of those that config changed.
+func keepStartupSettings(config, current *Config) []string {
+	var changed []string
+	next, prev := reflect.ValueOf(config).Elem(), reflect.ValueOf(current).Elem()
+	for i := 0; i < next.NumField(); i++ {
+		key, _, _ := strings.Cut(next.Type().Field(i).Tag.Get("yaml"), ",")
+		if !startupSettings[key] {
+			continue
+		}
+		if !reflect.DeepEqual(next.Field(i).Interface(), prev.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+		next.Field(i).Set(prev.Field(i))
+	}
+	return changed
+}
+
+// reloadConfig re-reads the config file and swaps it in for new requests.
+// It returns the changed settings that were ignored because they only take
+// effect on restart.
+func (s *Service) reloadConfig() ([]string, error) {
+	if s.configPath == "" {
+		return nil, fmt.Errorf("config reloading is not enabled")
+	}
+	config, err := LoadConfig(s.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	ignored := keepStartupSettings(config, s.currentConfig)
+	s.currentConfig = config
+	for _, key := range ignored {
+		slog.Warn("config setting changed, restart to apply it", "setting", key)
+	}
+	slog.Info("config reloaded", "path", s.configPath)
+	return ignored, nil
+}
+
+// reloadOnSIGHUP reloads the config on every SIGHUP until ctx is done.
+func (s *Service) reloadOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if _, err := s.reloadConfig(); err != nil {
+				slog.Error("config reload failed, keeping the current config", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Service) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if !s.isAdmin(r) {
+		writeError(w, http.StatusForbidden, APIErrorForbidden, "This endpoint requires a valid X-Admin-Token", "")
+		return
+	}
+
+	ignored, err := s.reloadConfig()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, APIErrorInvalidConfig, "Failed to reload config", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"reloaded":         true,
+		"restart_required": ignored, // Changed settings that were ignored
+	})
+}
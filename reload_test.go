@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeepStartupSettings(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(*Config)
+		wantChanged []string
+	}{
+		{"nothing changed", func(*Config) {}, nil},
+		{"reloadable setting", func(c *Config) { c.DefaultModel = "claude-3-5-haiku-latest" }, nil},
+		{"startup setting", func(c *Config) { c.GRPCServerAddr = "executor-2:50051" }, []string{"grpc_server_addr"}},
+		{"nested startup setting", func(c *Config) { c.Server.Port = 9090 }, []string{"server"}},
+		{
+			name: "both",
+			change: func(c *Config) {
+				c.DefaultModel = "claude-3-5-haiku-latest"
+				c.RateLimitPerMinute = 10
+				c.Server.Port = 9090
+			},
+			wantChanged: []string{"rate_limit_per_minute", "server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &Config{GRPCServerAddr: "executor:50051", DefaultModel: "claude-3-5-sonnet-latest"}
+			current.Server.Port = 8080
+			next := *current
+			tt.change(&next)
+
+			changed := keepStartupSettings(&next, current)
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if next.GRPCServerAddr != current.GRPCServerAddr || next.Server != current.Server || next.RateLimitPerMinute != current.RateLimitPerMinute {
+				t.Errorf("startup settings were not kept: %+v", next)
+			}
+			want := *current
+			tt.change(&want)
+			if next.DefaultModel != want.DefaultModel {
+				t.Errorf("default model = %q, want the reloaded %q", next.DefaultModel, want.DefaultModel)
+			}
+		})
+	}
+}
+
+func TestStartupSettingsAreConfigKeys(t *testing.T) {
+	keys := make(map[string]bool)
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		key, _, _ := strings.Cut(fields.Field(i).Tag.Get("yaml"), ",")
+		keys[key] = true
+	}
+	for key := range startupSettings {
+		if !keys[key] {
+			t.Errorf("startup setting %q is not a config key", key)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(config string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("anthropic_api_key: key\ngrpc_server_addr: executor:50051\nretry:\n  max_attempts: 2\n")
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(config)
+	s.configPath = path
+
+	write("anthropic_api_key: key\ngrpc_server_addr: executor-2:50051\nretry:\n  max_attempts: 4\n")
+	ignored, err := s.reloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"grpc_server_addr"}; !reflect.DeepEqual(ignored, want) {
+		t.Errorf("ignored = %v, want %v", ignored, want)
+	}
+	if got := s.config().GRPCServerAddr; got != "executor:50051" {
+		t.Errorf("grpc_server_addr = %q, want the startup value", got)
+	}
+	if got := *s.config().Retry.MaxAttempts; got != 4 {
+		t.Errorf("retry max_attempts = %d, want the reloaded 4", got)
+	}
+
+	write("retry: [")
+	if _, err := s.reloadConfig(); err == nil {
+		t.Error("reloading an invalid config succeeded")
+	}
+	if got := *s.config().Retry.MaxAttempts; got != 4 {
+		t.Errorf("retry max_attempts after a failed reload = %d, want 4 kept", got)
+	}
+}
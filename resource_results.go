@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Outcomes of a resource in ResourceResult.
+const (
+	ResourceCreated    = "created"
+	ResourceUpdated    = "updated"
+	ResourceReplaced   = "replaced"
+	ResourceDestroyed  = "destroyed"
+	ResourceUnchanged  = "unchanged"
+	ResourceFailed     = "failed"
+	ResourceIncomplete = "incomplete" // Started, but the apply stopped before it finished
+)
+
+// ResourceResult is the outcome of one resource in an apply or destroy.
+type ResourceResult struct {
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason,omitempty"` // Terraform error summary, for failed resources
+}
+
+var resourceProgressLine = regexp.MustCompile(`^(\S+): (Refreshing state|Creating|Modifying|Destroying|Creation complete|Modifications complete|Destruction complete)\b`)
+
+// resourceResults derives per-resource outcomes from the plan and apply
+// output of response. Resources only refreshed during the plan are
+// unchanged, so a no-change apply reports every known resource as unchanged.
+func (s *Service) resourceResults(response *TerraformResponse) map[string]ResourceResult {
+	results := make(map[string]ResourceResult)
+	started := make(map[string]bool)
+	destroyed := make(map[string]bool)
+
+	for _, output := range []string{response.PlanOutput, response.Output} {
+		for _, line := range strings.Split(output, "\n") {
+			line = strings.TrimSpace(strings.TrimLeft(line, "│╷╵ "))
+			m := resourceProgressLine.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			address := m[1]
+			switch m[2] {
+			case "Refreshing state":
+				if _, ok := results[address]; !ok {
+					results[address] = ResourceResult{Outcome: ResourceUnchanged}
+				}
+			case "Creating", "Modifying", "Destroying":
+				started[address] = true
+			case "Creation complete":
+				outcome := ResourceCreated
+				if destroyed[address] {
+					outcome = ResourceReplaced
+				}
+				results[address] = ResourceResult{Outcome: outcome}
+				started[address] = false
+			case "Modifications complete":
+				results[address] = ResourceResult{Outcome: ResourceUpdated}
+				started[address] = false
+			case "Destruction complete":
+				destroyed[address] = true
+				results[address] = ResourceResult{Outcome: ResourceDestroyed}
+				started[address] = false
+			}
+		}
+	}
+
+	for address, pending := range started {
+		if pending {
+			results[address] = ResourceResult{Outcome: ResourceIncomplete}
+		}
+	}
+	for _, cause := range s.failureCauses(response) {
+		if cause.Resource != "" {
+			results[cause.Resource] = ResourceResult{Outcome: ResourceFailed, Reason: cause.Summary}
+		}
+	}
+	return results
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		response TerraformResponse
+		want     map[string]ResourceResult
+	}{
+		{
+			name: "created and updated",
+			response: TerraformResponse{
+				PlanOutput: "digitalocean_droplet.web: Refreshing state... [id=1]\ndigitalocean_firewall.web: Refreshing state... [id=2]\n",
+				Output: `digitalocean_droplet.web: Modifying... [id=1]
+digitalocean_droplet.web: Modifications complete after 3s [id=1]
+digitalocean_volume.data: Creating...
+digitalocean_volume.data: Creation complete after 5s [id=3]
+`,
+			},
+			want: map[string]ResourceResult{
+				"digitalocean_droplet.web":  {Outcome: ResourceUpdated},
+				"digitalocean_firewall.web": {Outcome: ResourceUnchanged},
+				"digitalocean_volume.data":  {Outcome: ResourceCreated},
+			},
+		},
+		{
+			name: "replaced",
+			response: TerraformResponse{Output: `digitalocean_droplet.web: Destroying... [id=1]
+digitalocean_droplet.web: Destruction complete after 2s
+digitalocean_droplet.web: Creating...
+digitalocean_droplet.web: Creation complete after 30s [id=4]
+`},
+			want: map[string]ResourceResult{"digitalocean_droplet.web": {Outcome: ResourceReplaced}},
+		},
+		{
+			name: "destroyed",
+			response: TerraformResponse{Output: `digitalocean_droplet.web[0]: Destroying... [id=1]
+digitalocean_droplet.web[0]: Destruction complete after 2s
+`},
+			want: map[string]ResourceResult{"digitalocean_droplet.web[0]": {Outcome: ResourceDestroyed}},
+		},
+		{
+			name: "failed and incomplete",
+			response: TerraformResponse{
+				Output: `digitalocean_droplet.web: Creating...
+digitalocean_droplet.db: Creating...
+`,
+				Error: `
+│ Error: Error creating droplet: POST https://api.digitalocean.com/v2/droplets: 422 size is not available
+│
+│   with digitalocean_droplet.web,
+│   on main.tf line 1, in resource "digitalocean_droplet" "web":
+`,
+			},
+			want: map[string]ResourceResult{
+				"digitalocean_droplet.web": {Outcome: ResourceFailed, Reason: "Error creating droplet: POST https://api.digitalocean.com/v2/droplets: 422 size is not available"},
+				"digitalocean_droplet.db":  {Outcome: ResourceIncomplete},
+			},
+		},
+		{
+			name:     "no output",
+			response: TerraformResponse{},
+			want:     map[string]ResourceResult{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(nil)
+			if got := s.resourceResults(&tt.response); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resourceResults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
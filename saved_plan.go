@@ -0,0 +1,30 @@
+package main
+
+import "context"
+
+type savePlanKey struct{}
+
+type planFileKey struct{}
+
+// withSavePlan makes the plans executeAction runs in ctx save their plan
+// file, reported in TerraformResponse.planFile.
+func withSavePlan(ctx context.Context) context.Context {
+	return context.WithValue(ctx, savePlanKey{}, true)
+}
+
+func savePlanRequested(ctx context.Context) bool {
+	save, _ := ctx.Value(savePlanKey{}).(bool)
+	return save
+}
+
+// withPlanFile makes the applies executeAction runs in ctx apply the saved
+// plan at path instead of planning afresh, so what was checked is exactly
+// what gets applied. The executor fails the apply if the plan is stale.
+func withPlanFile(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, planFileKey{}, path)
+}
+
+func planFileFrom(ctx context.Context) string {
+	path, _ := ctx.Value(planFileKey{}).(string)
+	return path
+}
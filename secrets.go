@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+
+	pb "request-processor/api/proto"
+)
+
+type injectedSecretsKey struct{}
+
+// withInjectedSecrets returns a context carrying the hashes of the secret
+// values the executor injects into a workspace. Anything redacted with that
+// context masks those exact values, even when no generic pattern matches
+// them. If the executor cannot provide the hashes, ctx is returned as is.
+func (s *Service) withInjectedSecrets(ctx context.Context, contextName, workspace string) context.Context {
+	resp, err := s.executorClient.GetSecretHashes(ctx, &pb.GetSecretHashesRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to get secret hashes", "context", contextName, "workspace", workspace, "error", err)
+		return ctx
+	}
+	if !resp.Success {
+		s.runLogger(ctx).Warn("failed to get secret hashes", "context", contextName, "workspace", workspace, "error", resp.Error)
+		return ctx
+	}
+	if len(resp.Sha256Hashes) == 0 {
+		return ctx
+	}
+
+	hashes := make(map[string]bool, len(resp.Sha256Hashes))
+	for _, hash := range resp.Sha256Hashes {
+		hashes[hash] = true
+	}
+	return context.WithValue(ctx, injectedSecretsKey{}, hashes)
+}
+
+// secretCandidate matches the runs of text a secret value could occupy.
+var secretCandidate = regexp.MustCompile("[^\\s\"'`,;()\\[\\]{}<>]+")
+
+// maskHashedSecrets replaces every run of text whose SHA-256 is in hashes.
+// A run such as TOKEN=value is also checked after each '=' or ':'.
+func maskHashedSecrets(text string, hashes map[string]bool) string {
+	matches := func(candidate string) bool {
+		sum := sha256.Sum256([]byte(candidate))
+		return hashes[hex.EncodeToString(sum[:])]
+	}
+	return secretCandidate.ReplaceAllStringFunc(text, func(run string) string {
+		if matches(run) {
+			return redacted
+		}
+		for i, c := range run {
+			if (c == '=' || c == ':') && matches(run[i+1:]) {
+				return run[:i+1] + redacted
+			}
+		}
+		return run
+	})
+}
+
+// maskResponse redacts the outputs of an executor response in place.
+func (s *Service) maskResponse(ctx context.Context, response *TerraformResponse) {
+	response.Output = s.redact(ctx, response.Output)
+	response.PlanOutput = s.redact(ctx, response.PlanOutput)
+	response.ApplyOutput = s.redact(ctx, response.ApplyOutput)
+	response.Error = s.redact(ctx, response.Error)
+	response.InitOutput = s.redact(ctx, response.InitOutput)
+	response.InitError = s.redact(ctx, response.InitError)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func hashes(secrets ...string) map[string]bool {
+	h := make(map[string]bool, len(secrets))
+	for _, secret := range secrets {
+		sum := sha256.Sum256([]byte(secret))
+		h[hex.EncodeToString(sum[:])] = true
+	}
+	return h
+}
+
+func TestMaskHashedSecrets(t *testing.T) {
+	const secret = "s3cr3t-Value"
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "bare", text: "token is " + secret + " here", want: "token is [REDACTED] here"},
+		{name: "quoted", text: `password = "` + secret + `"`, want: `password = "[REDACTED]"`},
+		{name: "env assignment", text: "DB_PASSWORD=" + secret, want: "DB_PASSWORD=[REDACTED]"},
+		{name: "colon", text: "password:" + secret, want: "password:[REDACTED]"},
+		{name: "in brackets", text: "[" + secret + "]", want: "[[REDACTED]]"},
+		{name: "part of a longer word", text: secret + "suffix", want: secret + "suffix"},
+		{name: "other values", text: "nothing to hide", want: "nothing to hide"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maskHashedSecrets(tt.text, hashes(secret)); got != tt.want {
+				t.Errorf("maskHashedSecrets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectedSecretsAreRedacted(t *testing.T) {
+	const secret = "hunter2-injected"
+	tests := []struct {
+		name      string
+		secrets   []string
+		hashesErr error
+		wantMask  bool
+	}{
+		{name: "injected secret", secrets: []string{secret}, wantMask: true},
+		{name: "other workspace's secret", secrets: []string{"something-else"}},
+		{name: "hashes unavailable", secrets: []string{secret}, hashesErr: status.Error(codes.Unimplemented, "unknown method")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newFakeExecutor()
+			executor.seed("ctx", "ws", "", nil)
+			executor.secrets["ws"] = tt.secrets
+			executor.output["ws"] = "module.db: password=" + secret + "\nApply complete!"
+			if tt.hashesErr != nil {
+				executor.errs["GetSecretHashes ws"] = tt.hashesErr
+			}
+			s := newTestService(nil)
+			s.executorClient = executor
+
+			ctx := s.withInjectedSecrets(context.Background(), "ctx", "ws")
+			response, err := s.executeAction(ctx, ActionApply, "ctx", "ws")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, output := range map[string]string{"output": response.Output, "apply_output": response.ApplyOutput} {
+				if masked := !strings.Contains(output, secret); masked != tt.wantMask {
+					t.Errorf("%s = %q, want masked %v", name, output, tt.wantMask)
+				}
+			}
+			if logged := s.redact(ctx, "prompt with "+secret); strings.Contains(logged, secret) == tt.wantMask {
+				t.Errorf("redact() = %q, want masked %v", logged, tt.wantMask)
+			}
+		})
+	}
+}
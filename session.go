@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const sessionNamespace = "sessions"
+
+// session is the conversation of a client refining one workspace across
+// several requests.
+type session struct {
+	ID        string        `json:"id"`
+	Context   string        `json:"context"`
+	Workspace string        `json:"workspace"`
+	Turns     []sessionTurn `json:"turns"`
+}
+
+type sessionTurn struct {
+	Description string `json:"description"`
+	Action      Action `json:"action"`
+	Success     bool   `json:"success"`
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// loadSession returns the session for req.SessionID, or a new session if the
+// request has none. Sessions are bound to the workspace they started in.
+func (s *Service) loadSession(ctx context.Context, req TerraformRequest) (*session, error) {
+	if req.SessionID == "" {
+		return &session{ID: newSessionID(), Context: req.Context, Workspace: req.Workspace}, nil
+	}
+
+	value, err := s.store.Get(ctx, sessionNamespace, req.SessionID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("session %s does not exist or has expired", req.SessionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %v", err)
+	}
+
+	var sess session
+	if err := json.Unmarshal(value, &sess); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %v", err)
+	}
+	if sess.Context != req.Context || sess.Workspace != req.Workspace {
+		return nil, fmt.Errorf("session %s belongs to %s/%s", sess.ID, sess.Context, sess.Workspace)
+	}
+	return &sess, nil
+}
+
+// describe renders the session's earlier requests ahead of description, so
+// follow-ups like "make it bigger" can be resolved by the model. The current
+// code is already part of the generation prompt.
+func (sess *session) describe(description string) string {
+	if sess == nil || len(sess.Turns) == 0 || description == "" {
+		return description
+	}
+
+	var b strings.Builder
+	b.WriteString("Earlier requests in this conversation, oldest first:\n")
+	for _, turn := range sess.Turns {
+		outcome := "succeeded"
+		if !turn.Success {
+			outcome = "failed"
+		}
+		fmt.Fprintf(&b, "- %s (%s %s)\n", turn.Description, turn.Action, outcome)
+	}
+	fmt.Fprintf(&b, "\nCurrent request:\n%s", description)
+	return b.String()
+}
+
+// recordSessionTurn appends the request to its session, keeping at most
+// sessions.max_turns turns, and returns the session ID in the response.
+func (s *Service) recordSessionTurn(ctx context.Context, req TerraformRequest, response *TerraformResponse) {
+	sess := req.session
+	if sess == nil {
+		return
+	}
+	if req.Description != "" {
+		sess.Turns = append(sess.Turns, sessionTurn{
+			Description: req.Description,
+			Action:      req.Action,
+			Success:     response.Success && response.Error == "",
+		})
+		if limit := s.config().Sessions.MaxTurns; len(sess.Turns) > limit {
+			sess.Turns = sess.Turns[len(sess.Turns)-limit:]
+		}
+	}
+
+	value, err := json.Marshal(sess)
+	if err != nil {
+		s.runLogger(ctx).Warn("failed to encode session", "error", err)
+		return
+	}
+	ttl := time.Duration(s.config().Sessions.TTLSeconds) * time.Second
+	if err := s.store.Put(ctx, sessionNamespace, sess.ID, value, ttl); err != nil {
+		s.runLogger(ctx).Warn("failed to save session", "session_id", sess.ID, "error", err)
+		return
+	}
+	response.SessionID = sess.ID
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// inFlightHandler counts the requests being served, so shutdown can report
+// how many it is draining.
+type inFlightHandler struct {
+	next  http.Handler
+	count atomic.Int64
+}
+
+func (h *inFlightHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.count.Add(1)
+	defer h.count.Add(-1)
+	h.next.ServeHTTP(w, r)
+}
+
+// serve runs server until ctx is done, then stops accepting connections and
+// waits up to timeout for in-flight requests to finish and for closeService
+// to release the service. It returns an error only if the server fails to
+// start or stops on its own.
+func serve(ctx context.Context, server *http.Server, inFlight *inFlightHandler, timeout time.Duration, closeService func(context.Context) error) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining in-flight requests", "in_flight", inFlight.count.Load(), "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("shutdown timed out with requests still in flight", "in_flight", inFlight.count.Load(), "error", err)
+	} else {
+		slog.Info("all requests drained")
+	}
+	if err := closeService(shutdownCtx); err != nil {
+		slog.Warn("service did not close cleanly", "error", err)
+	}
+	return nil
+}
+
+// Close waits until ctx is done for running async jobs, cancelling those
+// still running then, and releases the executor connections and the store.
+func (s *Service) Close(ctx context.Context) error {
+	return errors.Join(s.jobs.close(ctx), s.executors.Close(), s.store.Close())
+}
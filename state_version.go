@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	pb "request-processor/api/proto"
+)
+
+// stateVersionPattern matches terraform's error for state written by a newer
+// version, e.g. "state snapshot was created by Terraform v1.9.0, which is
+// newer than current v1.5.7".
+var stateVersionPattern = regexp.MustCompile(`(?i)state snapshot was created by Terraform v([0-9][^\s,;]*),\s*which is newer than current v([0-9][^\s,;]*)`)
+
+// StateVersionMismatch reports that the workspace state was written by a
+// newer Terraform than the executor runs. Regenerating code can't fix this.
+type StateVersionMismatch struct {
+	StateVersion     string `json:"state_version"`     // Terraform version that wrote the state
+	TerraformVersion string `json:"terraform_version"` // Terraform version the executor ran
+	Upgraded         bool   `json:"upgraded"`          // The executor's Terraform was upgraded and the action re-run
+}
+
+func detectStateVersionMismatch(texts ...string) *StateVersionMismatch {
+	for _, text := range texts {
+		if m := stateVersionPattern.FindStringSubmatch(text); m != nil {
+			return &StateVersionMismatch{
+				StateVersion:     strings.TrimRight(m[1], "."),
+				TerraformVersion: strings.TrimRight(m[2], "."),
+			}
+		}
+	}
+	return nil
+}
+
+// resolveStateVersionMismatch handles a response that failed because of a
+// state version mismatch. With terraform_upgrade enabled the executor is asked
+// to upgrade Terraform and the action is re-run once; otherwise, or if that
+// fails, the response is returned with an actionable error.
+func (s *Service) resolveStateVersionMismatch(ctx context.Context, action Action, contextName, workspace string, mismatch *StateVersionMismatch, response *TerraformResponse) *TerraformResponse {
+	response.Success = false
+	response.StateVersionMismatch = mismatch
+	actionable := fmt.Sprintf("workspace state was written by Terraform %s but the executor runs %s; upgrade Terraform on the executor to %s or newer",
+		mismatch.StateVersion, mismatch.TerraformVersion, mismatch.StateVersion)
+
+	if !s.config().TerraformUpgrade.Enabled {
+		response.Error = actionable
+		return response
+	}
+
+	s.runLogger(ctx).Info("upgrading terraform", "context", contextName, "workspace", workspace, "min_version", mismatch.StateVersion)
+	upgrade, err := s.executorClient.UpgradeTerraform(ctx, &pb.UpgradeTerraformRequest{
+		Context:    contextName,
+		Workspace:  workspace,
+		MinVersion: mismatch.StateVersion,
+	})
+	if err == nil && !upgrade.Success {
+		err = fmt.Errorf("%s", upgrade.Error)
+	}
+	if err != nil {
+		response.Error = fmt.Sprintf("%s (automatic upgrade failed: %v)", actionable, err)
+		return response
+	}
+
+	retried, err := s.executeAction(ctx, action, contextName, workspace)
+	if err != nil {
+		response.Error = fmt.Sprintf("Terraform was upgraded to %s but re-running %s failed: %v", upgrade.Version, action, err)
+		return response
+	}
+	mismatch.TerraformVersion = upgrade.Version
+	mismatch.Upgraded = true
+	retried.StateVersionMismatch = mismatch
+	if retried.Error != "" {
+		retried.Success = false
+	}
+	return retried
+}
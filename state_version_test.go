@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const stateVersionError = "Error: state snapshot was created by Terraform v1.9.0, which is newer than current v1.5.7; upgrade to Terraform v1.9.0 or greater to work with this state"
+
+func TestDetectStateVersionMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		want  *StateVersionMismatch
+	}{
+		{"none", []string{"Error: Unsupported argument", ""}, nil},
+		{"in error", []string{stateVersionError}, &StateVersionMismatch{StateVersion: "1.9.0", TerraformVersion: "1.5.7"}},
+		{"in init error", []string{"", "", "╷\n│ " + stateVersionError + "\n╵"}, &StateVersionMismatch{StateVersion: "1.9.0", TerraformVersion: "1.5.7"}},
+		{"prerelease", []string{"state snapshot was created by Terraform v1.10.0-beta1, which is newer than current v1.9.8."}, &StateVersionMismatch{StateVersion: "1.10.0-beta1", TerraformVersion: "1.9.8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectStateVersionMismatch(tt.texts...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectStateVersionMismatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveStateVersionMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		upgrade     bool
+		upgradeErr  error
+		wantSuccess bool
+		wantError   string // Prefix
+		wantUpgrade bool   // UpgradeTerraform was called
+		wantCode    string
+	}{
+		{
+			name:      "upgrade disabled",
+			wantError: "workspace state was written by Terraform 1.9.0 but the executor runs 1.5.7; upgrade Terraform on the executor to 1.9.0 or newer",
+			wantCode:  ErrorCodeStateVersion,
+		},
+		{
+			name:        "upgraded",
+			upgrade:     true,
+			wantSuccess: true,
+			wantUpgrade: true,
+		},
+		{
+			name:        "upgrade failed",
+			upgrade:     true,
+			upgradeErr:  errors.New("no such version"),
+			wantError:   "workspace state was written by Terraform 1.9.0 but the executor runs 1.5.7; upgrade Terraform on the executor to 1.9.0 or newer (automatic upgrade failed: no such version)",
+			wantUpgrade: true,
+			wantCode:    ErrorCodeStateVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newFakeExecutor()
+			executor.seed("ctx", "ws", `resource "digitalocean_droplet" "web" {}`, nil)
+			if tt.upgradeErr != nil {
+				executor.errs["UpgradeTerraform ws"] = tt.upgradeErr
+			}
+			config := &Config{}
+			config.TerraformUpgrade.Enabled = tt.upgrade
+			s := newTestService(config)
+			s.executorClient = executor
+
+			mismatch := detectStateVersionMismatch(stateVersionError)
+			response := s.resolveStateVersionMismatch(context.Background(), ActionPlan, "ctx", "ws", mismatch, &TerraformResponse{Error: stateVersionError})
+			if response.Success != tt.wantSuccess || !strings.HasPrefix(response.Error, tt.wantError) || (tt.wantError == "") != (response.Error == "") {
+				t.Errorf("success = %v, error = %q; want %v, %q", response.Success, response.Error, tt.wantSuccess, tt.wantError)
+			}
+			if got := len(executor.called("UpgradeTerraform")) > 0; got != tt.wantUpgrade {
+				t.Errorf("upgrade called = %v, want %v", got, tt.wantUpgrade)
+			}
+			if m := response.StateVersionMismatch; m == nil || m.Upgraded != (tt.wantSuccess) {
+				t.Errorf("mismatch = %+v, want upgraded %v", m, tt.wantSuccess)
+			}
+			if !response.Success {
+				if got := classifyError(response); got != tt.wantCode {
+					t.Errorf("error code = %q, want %q", got, tt.wantCode)
+				}
+			}
+		})
+	}
+}
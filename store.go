@@ -0,0 +1,306 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// ErrNotFound is returned by Store.Get when a key does not exist or has expired.
+var ErrNotFound = errors.New("not found")
+
+// Store is the persistence layer shared by every feature that keeps state
+// across requests. Each feature uses its own namespace.
+type Store interface {
+	// Put stores value under namespace/key. A zero ttl means the value never expires.
+	Put(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error
+	Get(ctx context.Context, namespace, key string) ([]byte, error)
+	Delete(ctx context.Context, namespace, key string) error
+	// List returns the unexpired items of a namespace whose key starts with prefix, ordered by key.
+	List(ctx context.Context, namespace, prefix string) ([]StoreItem, error)
+	Close() error
+}
+
+type StoreItem struct {
+	Key   string
+	Value []byte
+}
+
+type StoreConfig struct {
+	Driver     string `yaml:"driver"`      // "memory" (default), "sqlite" or "postgres"
+	DSN        string `yaml:"dsn"`         // Database file for sqlite, connection string for postgres
+	MaxEntries int    `yaml:"max_entries"` // Expiring items the memory driver keeps before evicting the least recently used
+}
+
+// sqliteDriver is the database/sql driver of the sqlite store. It's set by
+// store_sqlite.go, which is only built with -tags sqlite since the driver
+// needs cgo.
+var sqliteDriver string
+
+func NewStore(config StoreConfig) (Store, error) {
+	switch config.Driver {
+	case "", "memory":
+		return newMemoryStore(config.MaxEntries), nil
+	case "sqlite":
+		if sqliteDriver == "" {
+			return nil, fmt.Errorf("the sqlite store driver is not built in; build with -tags sqlite (requires cgo)")
+		}
+		return newSQLStore(sqliteDriver, config.DSN)
+	case "postgres":
+		return newSQLStore("postgres", config.DSN)
+	default:
+		return nil, fmt.Errorf("unknown store driver: %s", config.Driver)
+	}
+}
+
+type memoryEntry struct {
+	namespace, key string
+	value          []byte
+	expiresAt      time.Time
+	elem           *list.Element // In memoryStore.recent; nil for entries that never expire
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// memoryStore keeps items in memory. Items stored with a ttl are caches,
+// and the least recently used of them are evicted once there are maxEntries
+// of them. Items that never expire, such as history, feature overrides and
+// workspace protection, are records and are never evicted.
+type memoryStore struct {
+	mu         sync.Mutex
+	namespaces map[string]map[string]*memoryEntry
+	recent     *list.List // *memoryEntry of the expiring items, most recently used first
+	maxEntries int        // 0 means no limit
+}
+
+func newMemoryStore(maxEntries int) *memoryStore {
+	return &memoryStore{
+		namespaces: make(map[string]map[string]*memoryEntry),
+		recent:     list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// remove drops an entry. The caller must hold m.mu.
+func (m *memoryStore) remove(entry *memoryEntry) {
+	if entry.elem != nil {
+		m.recent.Remove(entry.elem)
+	}
+	delete(m.namespaces[entry.namespace], entry.key)
+}
+
+func (m *memoryStore) Put(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, ok := m.namespaces[namespace]
+	if !ok {
+		entries = make(map[string]*memoryEntry)
+		m.namespaces[namespace] = entries
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.expired(now) {
+			m.remove(entry)
+		}
+	}
+
+	if old, ok := entries[key]; ok {
+		m.remove(old)
+	}
+	entry := &memoryEntry{namespace: namespace, key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+		entry.elem = m.recent.PushFront(entry)
+	}
+	entries[key] = entry
+	for m.maxEntries > 0 && m.recent.Len() > m.maxEntries {
+		m.remove(m.recent.Back().Value.(*memoryEntry))
+	}
+	return nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.namespaces[namespace][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if entry.expired(time.Now()) {
+		m.remove(entry)
+		return nil, ErrNotFound
+	}
+	if entry.elem != nil {
+		m.recent.MoveToFront(entry.elem)
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (m *memoryStore) Delete(ctx context.Context, namespace, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.namespaces[namespace][key]; ok {
+		m.remove(entry)
+	}
+	return nil
+}
+
+func (m *memoryStore) List(ctx context.Context, namespace, prefix string) ([]StoreItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var items []StoreItem
+	for k, e := range m.namespaces[namespace] {
+		if strings.HasPrefix(k, prefix) && !e.expired(now) {
+			items = append(items, StoreItem{Key: k, Value: append([]byte(nil), e.value...)})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+// sqlStore keeps all namespaces in a single key/value table. Expiry is stored
+// as unix nanoseconds, with 0 meaning no expiry.
+type sqlStore struct {
+	db     *sql.DB
+	driver string
+}
+
+func newSQLStore(driver, dsn string) (*sqlStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("store dsn is required for driver %s", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %v", err)
+	}
+
+	valueType := "BLOB"
+	if driver == "postgres" {
+		valueType = "BYTEA"
+	}
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS kv_store (
+		namespace TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value %s NOT NULL,
+		expires_at BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (namespace, key)
+	)`, valueType))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize store schema: %v", err)
+	}
+
+	return &sqlStore{db: db, driver: driver}, nil
+}
+
+// rebind converts ? placeholders to the $N form postgres expects.
+func (s *sqlStore) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) Put(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).UnixNano()
+	}
+
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM kv_store WHERE namespace = ? AND expires_at > 0 AND expires_at < ?`), namespace, now.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to purge expired items: %v", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, s.rebind(`INSERT INTO kv_store (namespace, key, value, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (namespace, key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`),
+		namespace, key, value, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store item: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT value FROM kv_store WHERE namespace = ? AND key = ? AND (expires_at = 0 OR expires_at >= ?)`),
+		namespace, key, time.Now().UnixNano()).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load item: %v", err)
+	}
+	return value, nil
+}
+
+func (s *sqlStore) Delete(ctx context.Context, namespace, key string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM kv_store WHERE namespace = ? AND key = ?`), namespace, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete item: %v", err)
+	}
+	return nil
+}
+
+// likePrefix returns a LIKE pattern matching strings that start with prefix,
+// escaping LIKE's wildcards with backslashes.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+func (s *sqlStore) List(ctx context.Context, namespace, prefix string) ([]StoreItem, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT key, value FROM kv_store WHERE namespace = ? AND key LIKE ? ESCAPE '\' AND (expires_at = 0 OR expires_at >= ?) ORDER BY key`),
+		namespace, likePrefix(prefix), time.Now().UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list items: %v", err)
+	}
+	defer rows.Close()
+
+	var items []StoreItem
+	for rows.Next() {
+		var item StoreItem
+		if err := rows.Scan(&item.Key, &item.Value); err != nil {
+			return nil, fmt.Errorf("failed to read item: %v", err)
+		}
+		if strings.HasPrefix(item.Key, prefix) { // sqlite's LIKE ignores ASCII case
+			items = append(items, item)
+		}
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,9 @@
+//go:build sqlite
+
+package main
+
+import _ "github.com/mattn/go-sqlite3"
+
+func init() {
+	sqliteDriver = "sqlite3"
+}
@@ -0,0 +1,48 @@
+//go:build sqlite
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := NewStore(StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "store.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestSQLiteHistoryPersists(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "store.db")
+	open := func() Store {
+		s, err := NewStore(StoreConfig{Driver: "sqlite", DSN: dsn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	store := open()
+	if err := (&storeHistory{store: store}).Record(ctx, HistoryEntry{ID: "1-a", Context: "ctx", Workspace: "team/ws"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store = open()
+	defer store.Close()
+	entries, err := (&storeHistory{store: store}).List(ctx, "ctx", "team/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != "1-a" {
+		t.Errorf("entries after reopening = %+v, want run 1-a", entries)
+	}
+}
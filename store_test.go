@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStore runs the behaviour every Store driver shares against the stores
+// newStore returns, each empty.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	t.Run("put, get and delete", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.Get(ctx, "plans", "a"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get() of a missing key error = %v, want ErrNotFound", err)
+		}
+		if err := s.Put(ctx, "plans", "a", []byte("1"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, "plans", "a", []byte("2"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if value, err := s.Get(ctx, "plans", "a"); err != nil || string(value) != "2" {
+			t.Errorf("Get() = %q, %v, want the latest value", value, err)
+		}
+		if _, err := s.Get(ctx, "jobs", "a"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() from another namespace error = %v, want ErrNotFound", err)
+		}
+		if err := s.Delete(ctx, "plans", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get(ctx, "plans", "a"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Put(ctx, "plans", "short", []byte("x"), time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, "plans", "long", []byte("y"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if _, err := s.Get(ctx, "plans", "short"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() of an expired key error = %v, want ErrNotFound", err)
+		}
+		items, err := s.List(ctx, "plans", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].Key != "long" {
+			t.Errorf("List() = %v, want only the unexpired item", items)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		s := newStore(t)
+		for _, key := range []string{"ctx/b", "ctx/a", "ctx%x", "ctx_a", "CTX/c", "other/a"} {
+			if err := s.Put(ctx, "history", key, []byte(key), 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Put(ctx, "plans", "ctx/z", []byte("z"), 0); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			prefix string
+			want   []string
+		}{
+			{"ctx/", []string{"ctx/a", "ctx/b"}},
+			{"ctx%", []string{"ctx%x"}},
+			{"ctx_", []string{"ctx_a"}},
+			{"", []string{"CTX/c", "ctx%x", "ctx/a", "ctx/b", "ctx_a", "other/a"}},
+			{"missing", nil},
+		}
+		for _, tt := range tests {
+			items, err := s.List(ctx, "history", tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, item := range items {
+				keys = append(keys, item.Key)
+				if string(item.Value) != item.Key {
+					t.Errorf("List(%q) item %s = %q", tt.prefix, item.Key, item.Value)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("List(%q) = %q, want %q", tt.prefix, keys, tt.want)
+			}
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return newMemoryStore(0) })
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryStore(3)
+	s.Put(ctx, "history", "kept", []byte("x"), 0)
+	for i := range 3 {
+		s.Put(ctx, "plans", fmt.Sprint(i), []byte("x"), time.Hour)
+	}
+	s.Get(ctx, "plans", "0") // 1 is now the least recently used
+	s.Put(ctx, "artifacts", "3", []byte("x"), time.Hour)
+	s.Put(ctx, "plans", "2", []byte("y"), time.Hour) // Replacing doesn't count twice
+	s.Put(ctx, "history", "also kept", []byte("x"), 0)
+
+	tests := []struct {
+		namespace, key string
+		kept           bool
+	}{
+		{"history", "kept", true},
+		{"plans", "0", true},
+		{"plans", "1", false},
+		{"plans", "2", true},
+		{"artifacts", "3", true},
+		{"history", "also kept", true},
+	}
+	for _, tt := range tests {
+		_, err := s.Get(ctx, tt.namespace, tt.key)
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s/%s kept = %v, want %v", tt.namespace, tt.key, kept, tt.kept)
+		}
+	}
+	if n := s.recent.Len(); n != 3 {
+		t.Errorf("store holds %d expiring entries, want 3", n)
+	}
+}
+
+func TestLikePrefix(t *testing.T) {
+	tests := []struct {
+		prefix, want string
+	}{
+		{"", "%"},
+		{"ctx/ws/", "ctx/ws/%"},
+		{"50%_off", `50\%\_off%`},
+		{`a\b`, `a\\b%`},
+	}
+	for _, tt := range tests {
+		if got := likePrefix(tt.prefix); got != tt.want {
+			t.Errorf("likePrefix(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestNewStoreUnknownDriver(t *testing.T) {
+	if _, err := NewStore(StoreConfig{Driver: "redis"}); err == nil {
+		t.Error("NewStore() with an unknown driver succeeded")
+	}
+}
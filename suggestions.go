@@ -0,0 +1,147 @@
+package main
+
+import (
+	"regexp"
+)
+
+// Error codes returned in TerraformResponse.ErrorCode for failed requests.
+const (
+	ErrorCodeAuth              = "auth"
+	ErrorCodeQuota             = "quota"
+	ErrorCodeRateLimit         = "rate_limit"
+	ErrorCodeInvalidConfig     = "invalid_config"
+	ErrorCodeNotFound          = "not_found"
+	ErrorCodeConflict          = "conflict"
+	ErrorCodeTimeout           = "timeout"
+	ErrorCodeProtectedResource = "protected_resource"
+	ErrorCodeNamingViolation   = "naming_violation"
+	ErrorCodeCostBudget        = "cost_budget_exceeded"
+	ErrorCodeWebhookDenied     = "webhook_denied"
+	ErrorCodeInit              = "init_failed"
+	ErrorCodeStateVersion      = "state_version_mismatch"
+	ErrorCodeMissingVariables  = "missing_variables"
+	ErrorCodeUnknown           = "unknown"
+)
+
+// errorRules classifies terraform failures by matching the error and output
+// text. Rules are checked in order, so more specific rules come first.
+var errorRules = []struct {
+	code    string
+	pattern *regexp.Regexp
+}{
+	{ErrorCodeAuth, regexp.MustCompile(`(?i)unable to authenticate|unauthorized|invalid (api )?token|status code:? 401|\b401\b`)},
+	{ErrorCodeRateLimit, regexp.MustCompile(`(?i)too many requests|rate limit|\b429\b`)},
+	{ErrorCodeQuota, regexp.MustCompile(`(?i)quota|limit (exceeded|reached)|exceed(s|ed)? (your|the) .*limit`)},
+	{ErrorCodeTimeout, regexp.MustCompile(`(?i)timeout|timed out|deadline exceeded`)},
+	{ErrorCodeConflict, regexp.MustCompile(`(?i)already exists|already in use|\b409\b`)},
+	{ErrorCodeNotFound, regexp.MustCompile(`(?i)not found|\b404\b`)},
+	{ErrorCodeInvalidConfig, regexp.MustCompile(`(?i)unsupported (argument|block type|attribute)|missing required argument|invalid reference|reference to undeclared|not valid HCL|Error: Invalid`)},
+}
+
+var errorSuggestions = map[string][]string{
+	ErrorCodeAuth: {
+		"Check that the cloud provider credentials configured on the executor are set and valid",
+		"Make sure the credentials allow creating and changing the resources in the code",
+	},
+	ErrorCodeQuota: {
+		"Request a quota increase from the provider, or remove unused resources",
+		"Reduce the number or size of resources in the description",
+	},
+	ErrorCodeRateLimit: {
+		"Wait a few minutes and retry the request",
+		"Avoid sending many requests for the same account in parallel",
+	},
+	ErrorCodeInvalidConfig: {
+		"Simplify the description or split it into smaller requests",
+		"Name the resource types and required settings explicitly in the description",
+	},
+	ErrorCodeNotFound: {
+		"Check that referenced regions, images, sizes and existing resources exist",
+	},
+	ErrorCodeConflict: {
+		"Use a different name, or import or remove the existing resource first",
+	},
+	ErrorCodeTimeout: {
+		"Retry the request; the provider may be slow or temporarily unavailable",
+	},
+	ErrorCodeProtectedResource: {
+		"Change the description so protected resources are updated in place instead of replaced",
+		"Ask an administrator to re-run the apply with force if the replacement is intended",
+	},
+	ErrorCodeNamingViolation: {
+		"Give resources names matching the configured naming pattern in the description",
+	},
+	ErrorCodeCostBudget: {
+		"Simplify the description so fewer correction attempts are needed",
+		"Raise max_llm_cost_usd for this request if the extra spend is acceptable",
+	},
+	ErrorCodeWebhookDenied: {
+		"Change the description to address the reasons given by the validation webhook",
+	},
+	ErrorCodeInit: {
+		"Check that the executor can reach the Terraform registry and provider download hosts",
+		"Check the provider version constraints and the dependency lock file for conflicts",
+	},
+	ErrorCodeStateVersion: {
+		"Upgrade Terraform on the executor to the version that wrote the state, or newer",
+		"Enable terraform_upgrade to let the executor upgrade Terraform automatically",
+	},
+	ErrorCodeMissingVariables: {
+		"Add the variables listed in missing_variables to the workspace as secret vars",
+		"Or give the values in the description so they can be written as literals",
+	},
+	ErrorCodeUnknown: {
+		"Review the terraform output for details",
+		"Simplify the description and retry",
+	},
+}
+
+// classifyError returns the error code for a failed response.
+func classifyError(response *TerraformResponse) string {
+	if m := response.StateVersionMismatch; m != nil && !m.Upgraded {
+		return ErrorCodeStateVersion
+	}
+	if response.InitError != "" {
+		return ErrorCodeInit
+	}
+	if response.TimedOut {
+		return ErrorCodeTimeout
+	}
+	if response.CostBudgetExceeded {
+		return ErrorCodeCostBudget
+	}
+	if len(response.BlockedResources) > 0 {
+		return ErrorCodeProtectedResource
+	}
+	if response.ValidationWebhook != nil && !response.ValidationWebhook.Allow {
+		return ErrorCodeWebhookDenied
+	}
+	if len(response.MissingVariables) > 0 {
+		return ErrorCodeMissingVariables
+	}
+	if len(response.NameViolations) > 0 {
+		return ErrorCodeNamingViolation
+	}
+
+	text := response.Error + "\n" + response.Output
+	for _, rule := range errorRules {
+		if rule.pattern.MatchString(text) {
+			return rule.code
+		}
+	}
+	return ErrorCodeUnknown
+}
+
+// addSuggestions classifies a failed response and attaches next steps for
+// the user. Authentication steps name the request's cloud provider's
+// credentials when it has one.
+func addSuggestions(response *TerraformResponse, provider string) {
+	if response.Success && response.Error == "" {
+		return
+	}
+	response.ErrorCode = classifyError(response)
+	response.Suggestions = errorSuggestions[response.ErrorCode]
+	if p, ok := cloudProviders[provider]; ok && response.ErrorCode == ErrorCodeAuth {
+		response.Suggestions = p.AuthSuggestions
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuthSuggestions(t *testing.T) {
+	tests := []struct {
+		provider string
+		want     string // Expected in the first suggestion
+	}{
+		{"digitalocean", "DigitalOcean token"},
+		{"aws", "AWS credentials"},
+		{"gcp", "GCP service account"},
+		{"", "cloud provider credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			response := &TerraformResponse{Error: "Error: Unable to authenticate you"}
+			addSuggestions(response, tt.provider)
+			if response.ErrorCode != ErrorCodeAuth {
+				t.Fatalf("error code = %q, want %q", response.ErrorCode, ErrorCodeAuth)
+			}
+			if len(response.Suggestions) == 0 || !strings.Contains(response.Suggestions[0], tt.want) {
+				t.Errorf("suggestions = %q, want the first to mention %q", response.Suggestions, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestionsIgnoreProviderForOtherErrors(t *testing.T) {
+	response := &TerraformResponse{Error: "Error: droplet already exists"}
+	addSuggestions(response, "aws")
+	if response.ErrorCode != ErrorCodeConflict {
+		t.Fatalf("error code = %q, want %q", response.ErrorCode, ErrorCodeConflict)
+	}
+	if got, want := response.Suggestions, errorSuggestions[ErrorCodeConflict]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("suggestions = %q, want %q", got, want)
+	}
+}
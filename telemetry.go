@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TelemetryConfig struct {
+	ServiceName string             `yaml:"service_name"` // Defaults to "request-processor"
+	Logs        OTLPExporterConfig `yaml:"logs"`         // OTLP/HTTP export of request events as log records
+	Traces      OTLPExporterConfig `yaml:"traces"`       // OTLP/HTTP export of request, LLM and executor call spans
+}
+
+type OTLPExporterConfig struct {
+	Enabled  bool              `yaml:"enabled"`
+	Endpoint string            `yaml:"endpoint"` // host:port of the collector; defaults to the OTEL_EXPORTER_OTLP_* environment
+	Insecure bool              `yaml:"insecure"` // Use plain HTTP
+	Headers  map[string]string `yaml:"headers"`
+}
+
+const instrumentationName = "request-processor"
+
+// tracer creates spans with the global tracer provider. Until tracing is set
+// up, and when it is off, the provider is a no-op.
+var tracer = otel.Tracer(instrumentationName)
+
+// setupTelemetry installs the global OpenTelemetry providers configured in
+// config. The returned function flushes and stops them.
+func setupTelemetry(ctx context.Context, config TelemetryConfig) (func(context.Context) error, error) {
+	res := resource.NewSchemaless(attribute.String("service.name", config.ServiceName))
+	var shutdowns []func(context.Context) error
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		for _, fn := range shutdowns {
+			errs = append(errs, fn(ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	if config.Logs.Enabled {
+		var opts []otlploghttp.Option
+		if config.Logs.Endpoint != "" {
+			opts = append(opts, otlploghttp.WithEndpoint(config.Logs.Endpoint))
+		}
+		if config.Logs.Insecure {
+			opts = append(opts, otlploghttp.WithInsecure())
+		}
+		if len(config.Logs.Headers) > 0 {
+			opts = append(opts, otlploghttp.WithHeaders(config.Logs.Headers))
+		}
+		exporter, err := otlploghttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP log exporter: %v", err)
+		}
+
+		provider := sdklog.NewLoggerProvider(
+			sdklog.WithResource(res),
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		)
+		global.SetLoggerProvider(provider)
+		shutdowns = append(shutdowns, provider.Shutdown)
+	}
+
+	if config.Traces.Enabled {
+		var opts []otlptracehttp.Option
+		if config.Traces.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.Traces.Endpoint))
+		}
+		if config.Traces.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(config.Traces.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(config.Traces.Headers))
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			shutdown(ctx)
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %v", err)
+		}
+
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithBatcher(exporter),
+		)
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+		shutdowns = append(shutdowns, provider.Shutdown)
+	}
+
+	return shutdown, nil
+}
+
+// setSpanStatus records err, or the failure of response, on span. Only
+// error text is recorded, never descriptions or code.
+func setSpanStatus(span trace.Span, response *TerraformResponse, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case response != nil && !response.Success:
+		span.SetStatus(codes.Error, "terraform run failed")
+	}
+}
+
+// emitEvent exports a request event as an OpenTelemetry log record. The
+// record is correlated with the span in ctx, if any. Attribute values are
+// redacted before export. Without a configured exporter this is a no-op.
+func (s *Service) emitEvent(ctx context.Context, severity otellog.Severity, event string, attrs map[string]any) {
+	logger := global.GetLoggerProvider().Logger(instrumentationName)
+
+	var record otellog.Record
+	record.SetTimestamp(time.Now())
+	record.SetSeverity(severity)
+	record.SetSeverityText(severity.String())
+	record.SetBody(otellog.StringValue(event))
+	record.AddAttributes(otellog.String("event.name", event))
+	for key, value := range attrs {
+		switch v := value.(type) {
+		case string:
+			record.AddAttributes(otellog.String(key, s.redact(ctx, v)))
+		case bool:
+			record.AddAttributes(otellog.Bool(key, v))
+		case int:
+			record.AddAttributes(otellog.Int(key, v))
+		case int64:
+			record.AddAttributes(otellog.Int64(key, v))
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				encoded = []byte(fmt.Sprint(v))
+			}
+			record.AddAttributes(otellog.String(key, s.redact(ctx, string(encoded))))
+		}
+	}
+	logger.Emit(ctx, record)
+}
+
+func (s *Service) emitGenerationEvent(ctx context.Context, prompt string, gen *generation) {
+	s.emitEvent(ctx, otellog.SeverityInfo, "generation", map[string]any{
+		"model":         gen.Model,
+		"stop_reason":   gen.StopReason,
+		"input_tokens":  gen.InputTokens,
+		"output_tokens": gen.OutputTokens,
+		"from_cache":    gen.FromCache,
+		"prompt":        prompt,
+		"code":          gen.Code,
+	})
+}
+
+func (s *Service) emitActionEvent(ctx context.Context, action, contextName, workspace string, response *TerraformResponse, err error) {
+	attrs := map[string]any{
+		"context":   contextName,
+		"workspace": workspace,
+	}
+	severity := otellog.SeverityInfo
+	switch {
+	case err != nil:
+		severity = otellog.SeverityError
+		attrs["error"] = err.Error()
+	case response != nil:
+		if !response.Success || response.Error != "" {
+			severity = otellog.SeverityError
+		}
+		attrs["success"] = response.Success
+		attrs["output"] = response.Output
+		attrs["error"] = response.Error
+	}
+	s.emitEvent(ctx, severity, action, attrs)
+}
+
+// emitResponseEvent exports the final response, preceded by an error event
+// when the request failed.
+func (s *Service) emitResponseEvent(ctx context.Context, req TerraformRequest, response *TerraformResponse) {
+	if !response.Success || response.Error != "" {
+		s.emitEvent(ctx, otellog.SeverityError, "error", map[string]any{
+			"context":    req.Context,
+			"workspace":  req.Workspace,
+			"error":      response.Error,
+			"error_code": response.ErrorCode,
+		})
+	}
+	s.emitEvent(ctx, otellog.SeverityInfo, "response", map[string]any{
+		"context":   req.Context,
+		"workspace": req.Workspace,
+		"run_id":    response.RunID,
+		"response":  response,
+	})
+}
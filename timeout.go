@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type requestTimeoutKey struct{}
+
+// withRequestTimeout records a request's timeout_seconds in ctx. It replaces
+// the configured timeouts for every LLM and executor call of the request.
+func withRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+func requestTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// callTimeout returns the timeout for a single LLM or executor call: the
+// request's, if it set one, or fallback.
+func callTimeout(ctx context.Context, fallback time.Duration) time.Duration {
+	if timeout, ok := requestTimeout(ctx); ok {
+		return timeout
+	}
+	return fallback
+}
+
+// isTimeout reports whether err is an LLM or executor call running out of
+// time.
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded
+}
+
+// timeoutConn bounds every executor call that doesn't already have a
+// deadline, so a hung executor can't block a request forever. Actions set
+// their own, longer deadlines in executeAction.
+type timeoutConn struct {
+	grpc.ClientConnInterface
+	timeout time.Duration
+}
+
+func (c timeoutConn) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, callTimeout(ctx, c.timeout))
+		defer cancel()
+	}
+	return c.ClientConnInterface.Invoke(ctx, method, args, reply, opts...)
+}
+
+// Executor failures fall in two classes: transient ones, where the same code
+// may well succeed on a second try, and the rest, where retrying can't help.
+// Terraform errors aren't call failures at all; they come back in a
+// response and are handled by regenerating the code.
+const (
+	errorClassTransient = "transient"
+	errorClassPermanent = "permanent"
+)
+
+// errorClass classifies an executor call failure. Errors without a gRPC
+// status, such as a webhook's network errors, count as transient.
+func errorClass(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return errorClassTransient
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return errorClassTransient
+	default:
+		return errorClassPermanent
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import "time"
+
+// Timings breaks down where the time of a request went. Durations are in
+// milliseconds; attempt totals leave out the delay between retries.
+type Timings struct {
+	GenerationMS  int64            `json:"generation_ms"`
+	PreparationMS int64            `json:"preparation_ms"`
+	ExecutionMS   int64            `json:"execution_ms"`
+	TotalMS       int64            `json:"total_ms"`
+	Attempts      []*AttemptTiming `json:"attempts,omitempty"`
+
+	initialGenerationMS int64
+}
+
+type AttemptTiming struct {
+	Attempt       int   `json:"attempt"`
+	GenerationMS  int64 `json:"generation_ms"`
+	PreparationMS int64 `json:"preparation_ms"`
+	ExecutionMS   int64 `json:"execution_ms"`
+	TotalMS       int64 `json:"total_ms"`
+
+	start time.Time
+}
+
+func msSince(start time.Time) int64 {
+	return time.Since(start).Milliseconds()
+}
+
+// newAttempt starts the timing of an attempt. The first attempt is charged
+// with the generation made before the retry loop.
+func (t *Timings) newAttempt(attempt int) *AttemptTiming {
+	at := &AttemptTiming{Attempt: attempt, start: time.Now()}
+	if len(t.Attempts) == 0 {
+		at.GenerationMS = t.initialGenerationMS
+	}
+	t.Attempts = append(t.Attempts, at)
+	return at
+}
+
+// finish sums the attempts and sets the wall-clock total since start.
+func (t *Timings) finish(start time.Time) {
+	t.GenerationMS, t.PreparationMS, t.ExecutionMS = 0, 0, 0
+	if len(t.Attempts) == 0 {
+		t.GenerationMS = t.initialGenerationMS
+	}
+	for _, at := range t.Attempts {
+		t.GenerationMS += at.GenerationMS
+		t.PreparationMS += at.PreparationMS
+		t.ExecutionMS += at.ExecutionMS
+	}
+	t.TotalMS = msSince(start)
+}
+
+// end records the attempt's total. The first attempt includes the initial
+// generation.
+func (at *AttemptTiming) end() {
+	at.TotalMS = msSince(at.start)
+	if at.Attempt == 1 {
+		at.TotalMS += at.GenerationMS
+	}
+}
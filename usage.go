@@ -0,0 +1,127 @@
+package main
+
+import "sort"
+
+// ModelPricing is the price of a model in USD per million tokens.
+type ModelPricing struct {
+	InputPerMTok  float64 `yaml:"input_per_mtok"`
+	OutputPerMTok float64 `yaml:"output_per_mtok"`
+}
+
+// providerModelPricing is the built-in pricing of each LLM provider's
+// models. Models of other providers aren't known to a provider, so an
+// OpenAI-compatible endpoint only knows the models in model_pricing.
+var providerModelPricing = map[string]map[string]ModelPricing{
+	ProviderAnthropic: anthropicModelPricing,
+}
+
+var anthropicModelPricing = map[string]ModelPricing{
+	"claude-3-5-sonnet-latest":   {InputPerMTok: 3, OutputPerMTok: 15},
+	"claude-3-5-sonnet-20241022": {InputPerMTok: 3, OutputPerMTok: 15},
+	"claude-3-5-haiku-latest":    {InputPerMTok: 0.8, OutputPerMTok: 4},
+	"claude-3-5-haiku-20241022":  {InputPerMTok: 0.8, OutputPerMTok: 4},
+	"claude-3-opus-latest":       {InputPerMTok: 15, OutputPerMTok: 75},
+	"claude-3-opus-20240229":     {InputPerMTok: 15, OutputPerMTok: 75},
+}
+
+// knownModels returns the models requests may select: those with pricing,
+// built in or configured.
+func (s *Service) knownModels() []string {
+	models := make([]string, 0, len(s.config().ModelPricing))
+	for model := range s.config().ModelPricing {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func (p ModelPricing) cost(inputTokens, outputTokens int64) float64 {
+	return (float64(inputTokens)*p.InputPerMTok + float64(outputTokens)*p.OutputPerMTok) / 1e6
+}
+
+// generation is the result of a single model call. Code holds the reply
+// text, which for code generations is the Terraform code.
+type generation struct {
+	Code         string `json:"code"`
+	Model        string `json:"model"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	StopReason   string `json:"stop_reason,omitempty"`
+	StopSequence string `json:"stop_sequence,omitempty"`
+	FromCache    bool   `json:"-"`
+}
+
+// GenerationInfo describes one model call made for a request. StopReason is
+// the raw Anthropic stop reason, such as "end_turn", "max_tokens" or
+// "refusal", which tells a truncated or refused generation from a complete one.
+type GenerationInfo struct {
+	Model        string `json:"model"`
+	StopReason   string `json:"stop_reason,omitempty"`
+	StopSequence string `json:"stop_sequence,omitempty"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	FromCache    bool   `json:"from_cache,omitempty"`
+}
+
+// llmUsage accumulates the token usage of all generations made for a request.
+type llmUsage struct {
+	InputTokens       int64
+	OutputTokens      int64
+	CostUSD           float64
+	SavedInputTokens  int64
+	SavedOutputTokens int64
+	SavedCostUSD      float64
+	LastCostUSD       float64 // Cost of the latest uncached generation, the estimate for the next one
+	Generations       []GenerationInfo
+}
+
+func (u *llmUsage) record(gen *generation, pricing map[string]ModelPricing) {
+	u.Generations = append(u.Generations, GenerationInfo{
+		Model:        gen.Model,
+		StopReason:   gen.StopReason,
+		StopSequence: gen.StopSequence,
+		InputTokens:  gen.InputTokens,
+		OutputTokens: gen.OutputTokens,
+		FromCache:    gen.FromCache,
+	})
+
+	cost := pricing[gen.Model].cost(gen.InputTokens, gen.OutputTokens)
+	if gen.FromCache {
+		u.SavedInputTokens += gen.InputTokens
+		u.SavedOutputTokens += gen.OutputTokens
+		u.SavedCostUSD += cost
+		return
+	}
+	u.InputTokens += gen.InputTokens
+	u.OutputTokens += gen.OutputTokens
+	u.CostUSD += cost
+	u.LastCostUSD = cost
+}
+
+// costBudget returns the LLM spend limit for a request: the lower of the
+// configured and the requested cap, or 0 when neither is set.
+func (s *Service) costBudget(req TerraformRequest) float64 {
+	budget := s.config().MaxLLMCostUSDPerRequest
+	if req.MaxLLMCostUSD > 0 && (budget <= 0 || req.MaxLLMCostUSD < budget) {
+		budget = req.MaxLLMCostUSD
+	}
+	return budget
+}
+
+type CacheSavings struct {
+	InputTokens      int64   `json:"input_tokens"`
+	OutputTokens     int64   `json:"output_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+// cacheSavings returns what the generation cache saved, or nil if nothing was served from it.
+func (u *llmUsage) cacheSavings() *CacheSavings {
+	if u.SavedInputTokens == 0 && u.SavedOutputTokens == 0 {
+		return nil
+	}
+	return &CacheSavings{
+		InputTokens:      u.SavedInputTokens,
+		OutputTokens:     u.SavedOutputTokens,
+		EstimatedCostUSD: u.SavedCostUSD,
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	pb "request-processor/api/proto"
+)
+
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// validateVariables checks that request variable names are valid Terraform
+// identifiers.
+func validateVariables(variables map[string]string) error {
+	for name := range variables {
+		if !variableName.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// describeVariables adds the names of request variables to a description, so
+// generated code references them instead of hard-coding values. Values are
+// left out, so code generated for one set of values is reused for others.
+func describeVariables(description string, variables map[string]string) string {
+	if len(variables) == 0 {
+		return description
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%s\n\n\tThese Terraform variables are already declared and set for the workspace: %s. Reference them as var.<name> wherever the task needs their values, and do not declare them.", description, strings.Join(names, ", "))
+}
+
+// setVariables writes request variables to the workspace's terraform.tfvars.
+func (s *Service) setVariables(ctx context.Context, contextName, workspace string, variables map[string]string) error {
+	resp, err := s.executorClient.SetVariables(ctx, &pb.SetVariablesRequest{
+		Context:   contextName,
+		Workspace: workspace,
+		Variables: variables,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return fmt.Errorf("%s", resp.Error)
+	}
+	return nil
+}
+
+// getVariables returns the values in the workspace's terraform.tfvars.
+func (s *Service) getVariables(ctx context.Context, contextName, workspace string) (map[string]string, error) {
+	resp, err := s.executorClient.GetVariables(ctx, &pb.GetVariablesRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Variables, nil
+}
+
+// missingVariables returns the variables code references that are declared
+// neither in the code nor in the workspace's base configuration, nor supplied
+// with the request.
+func (s *Service) missingVariables(ctx context.Context, contextName, workspace, code string, supplied map[string]string) ([]string, error) {
+	body, err := parseHCL(code)
+	if err != nil {
+		return nil, nil // Syntax errors are reported by validation
+	}
+	referenced := variableReferences(body)
+	if len(referenced) == 0 {
+		return nil, nil
+	}
+
+	resp, err := s.executorClient.ListVariables(ctx, &pb.ListVariablesRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace variables: %v", err)
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("failed to list workspace variables: %s", resp.Error)
+	}
+
+	declared := make(map[string]bool, len(resp.Names))
+	for _, name := range resp.Names {
+		declared[name] = true
+	}
+	var missing []string
+	for _, name := range referenced {
+		if _, ok := supplied[name]; !ok && !declared[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
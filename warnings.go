@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var terraformDiagnosticLine = regexp.MustCompile(`^(Warning|Error): `)
+
+// terraformWarnings splits terraform output into its warnings, each from its
+// "Warning:" line to the end of its box, with the box drawing removed.
+func terraformWarnings(output string) []string {
+	var warnings []string
+	var current []string
+	flush := func() {
+		if current != nil {
+			warnings = append(warnings, strings.TrimSpace(strings.Join(current, "\n")))
+			current = nil
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "╵") {
+			flush()
+			continue
+		}
+		text := strings.TrimPrefix(strings.TrimPrefix(trimmed, "│"), " ")
+		if m := terraformDiagnosticLine.FindStringSubmatch(text); m != nil {
+			flush()
+			if m[1] == "Warning" {
+				current = []string{}
+			}
+		}
+		if current != nil {
+			current = append(current, text)
+		}
+	}
+	flush()
+	return warnings
+}
+
+func compileWarningsAsErrors(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid warnings_as_errors pattern %q: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// promotedWarnings returns the warnings in outputs that match a
+// warnings_as_errors pattern, rewritten as errors so they are parsed and fed
+// back to the LLM like any other terraform error.
+func (s *Service) promotedWarnings(outputs ...string) []string {
+	if len(s.warningsAsErrors) == 0 {
+		return nil
+	}
+	var promoted []string
+	seen := make(map[string]bool)
+	for _, output := range outputs {
+		for _, warning := range terraformWarnings(output) {
+			if seen[warning] {
+				continue
+			}
+			for _, pattern := range s.warningsAsErrors {
+				if pattern.MatchString(warning) {
+					seen[warning] = true
+					promoted = append(promoted, "Error: "+strings.TrimPrefix(warning, "Warning: "))
+					break
+				}
+			}
+		}
+	}
+	return promoted
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// signatureHeader carries the HMAC-SHA256 of the webhook body, as
+// "sha256=<hex>", when a secret is configured.
+const signatureHeader = "X-Signature-256"
+
+// signBody sets the signature header of a webhook request to the HMAC of
+// body. Without a secret, requests are sent unsigned.
+func signBody(req *http.Request, secret string, body []byte) {
+	if secret == "" {
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+type ValidationWebhookConfig struct {
+	URL            string `yaml:"url"`             // Called before every apply; empty disables the webhook
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // Default 10
+	Secret         string `yaml:"secret"`          // Signs request bodies with HMAC-SHA256 when set
+}
+
+type validationWebhookRequest struct {
+	Context     string          `json:"context"`
+	Workspace   string          `json:"workspace"`
+	Action      string          `json:"action"`
+	Description string          `json:"description"`
+	Code        string          `json:"code"`
+	Plan        json.RawMessage `json:"plan"`
+}
+
+// WebhookDecision is the validation webhook's verdict on an apply.
+type WebhookDecision struct {
+	Allow   bool     `json:"allow"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// validationWebhookEnabled reports whether applies of req are sent to the
+// validation webhook: one is configured and policy checks are on for the
+// context.
+func (s *Service) validationWebhookEnabled(req TerraformRequest) bool {
+	return s.config().ValidationWebhook.URL != "" && req.features.PolicyChecks
+}
+
+// checkValidationWebhook sends the code and the JSON of plan, the saved plan
+// from savedPlan that the apply uses, to the validation webhook. It returns
+// nil when the webhook isn't enabled for req or the plan failed (the apply
+// then surfaces the error). Webhook failures are returned as errors so the
+// apply is not run unchecked.
+func (s *Service) checkValidationWebhook(ctx context.Context, req TerraformRequest, workspace, code string, plan *TerraformResponse) (*WebhookDecision, error) {
+	if !s.validationWebhookEnabled(req) || !plan.Success || plan.Error != "" {
+		return nil, nil
+	}
+	config := s.config().ValidationWebhook
+
+	body, err := json.Marshal(validationWebhookRequest{
+		Context:     req.Context,
+		Workspace:   workspace,
+		Action:      string(ActionApply),
+		Description: req.Description,
+		Code:        code,
+		Plan:        json.RawMessage(plan.planJSON),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	signBody(httpReq, config.Secret, body)
+
+	client := &http.Client{Timeout: time.Duration(config.TimeoutSeconds) * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("validation webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("validation webhook returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	var decision WebhookDecision
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return nil, fmt.Errorf("failed to decode validation webhook response: %v", err)
+	}
+	return &decision, nil
+}
+
+func webhookDeniedError(decision *WebhookDecision) string {
+	if len(decision.Reasons) == 0 {
+		return "apply denied by validation webhook"
+	}
+	return fmt.Sprintf("apply denied by validation webhook: %s", strings.Join(decision.Reasons, "; "))
+}
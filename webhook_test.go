@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestValidationWebhookChecksAppliedPlan(t *testing.T) {
+	const plan = `{"resource_changes":[{"address":"digitalocean_droplet.web","type":"digitalocean_droplet","change":{"actions":["create"]}}]}`
+	tests := []struct {
+		name        string
+		allow       bool
+		wantApplied []string
+	}{
+		{"allowed", true, []string{"ctx/ws"}},
+		{"denied", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received validationWebhookRequest
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&received)
+				json.NewEncoder(w).Encode(WebhookDecision{Allow: tt.allow})
+			}))
+			defer webhook.Close()
+
+			executor := newFakeExecutor()
+			executor.planJSON["ws"] = plan
+			s := newTestService(&Config{ValidationWebhook: ValidationWebhookConfig{URL: webhook.URL, TimeoutSeconds: 5}})
+			s.executorClient, s.generator = executor, &fakeGenerator{replies: []string{testCode}}
+
+			req := TerraformRequest{Context: "ctx", Workspace: "ws", Action: ActionApply, Description: "a droplet", MaxAttempts: 1}
+			req.features.PolicyChecks = true
+			response, err := s.processTerraformRequest(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(received.Plan) != plan {
+				t.Errorf("webhook plan = %s, want the saved plan %s", received.Plan, plan)
+			}
+			if got := executor.called("Plan"); len(got) != 1 {
+				t.Errorf("plans = %v, want only the saved one", got)
+			}
+			if got := executor.called("Apply"); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Fatalf("applies = %v, want %v", got, tt.wantApplied)
+			}
+			if tt.allow {
+				if file := executor.planFiles["ws"]; file != "ctx/ws/tfplan" {
+					t.Errorf("applied plan file = %q, want the checked plan", file)
+				}
+			} else if response.ValidationWebhook == nil || response.Success {
+				t.Errorf("success = %v, webhook = %v, want the denial reported", response.Success, response.ValidationWebhook)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	pb "request-processor/api/proto"
+)
+
+// Events that invalidate a workspace's cached data.
+const (
+	CacheEventCodeChanged = "code_changed"
+	CacheEventApplied     = "applied"
+	CacheEventDestroyed   = "destroyed"
+	CacheEventDeleted     = "deleted"
+)
+
+// workspaceCache caches workspace code read from the executor. Every change
+// to a workspace goes through invalidate, which drops the cached code and
+// notifies subscribers, so caches derived from workspace data (plans, state)
+// can subscribe instead of tracking changes themselves. Subscribers are
+// notified even when caching is disabled.
+//
+// The cache is per process: with several replicas, changes made through
+// another replica are only picked up after the TTL.
+type workspaceCache struct {
+	ttl time.Duration // 0 disables caching of code
+
+	mu            sync.RWMutex
+	entries       map[string]workspaceCacheEntry
+	subscribers   []func(contextName, workspace, event string)
+	invalidations map[string]int64 // By event
+}
+
+type workspaceCacheEntry struct {
+	Code     string
+	CachedAt time.Time
+}
+
+func newWorkspaceCache(ttl time.Duration) *workspaceCache {
+	c := &workspaceCache{
+		ttl:           ttl,
+		entries:       make(map[string]workspaceCacheEntry),
+		invalidations: make(map[string]int64),
+	}
+	c.subscribe(func(_, _, event string) {
+		c.mu.Lock()
+		c.invalidations[event]++
+		c.mu.Unlock()
+	})
+	return c
+}
+
+func workspaceCacheKey(contextName, workspace string) string {
+	return contextName + "/" + workspace
+}
+
+func (c *workspaceCache) code(contextName, workspace string) (string, bool) {
+	if c.ttl <= 0 {
+		return "", false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[workspaceCacheKey(contextName, workspace)]
+	if !ok || time.Since(entry.CachedAt) > c.ttl {
+		return "", false
+	}
+	return entry.Code, true
+}
+
+func (c *workspaceCache) setCode(contextName, workspace, code string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[workspaceCacheKey(contextName, workspace)] = workspaceCacheEntry{Code: code, CachedAt: time.Now()}
+}
+
+// subscribe registers fn to be called after every invalidation.
+func (c *workspaceCache) subscribe(fn func(contextName, workspace, event string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, fn)
+}
+
+// invalidate drops everything cached for a workspace and notifies
+// subscribers of the event.
+func (c *workspaceCache) invalidate(contextName, workspace, event string) {
+	c.mu.Lock()
+	delete(c.entries, workspaceCacheKey(contextName, workspace))
+	subscribers := append([]func(contextName, workspace, event string){}, c.subscribers...)
+	c.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(contextName, workspace, event)
+	}
+}
+
+// workspaceCode returns the workspace's main.tf, from the cache unless the
+// request bypasses it.
+func (s *Service) workspaceCode(ctx context.Context, contextName, workspace string) (string, error) {
+	if code, ok := s.workspaceCache.code(contextName, workspace); ok && !cacheBypassed(ctx) {
+		recordCacheHit(ctx, CacheWorkspaceCode)
+		return code, nil
+	}
+
+	resp, err := s.executorClient.GetMainTf(ctx, &pb.GetMainTfRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		return "", err
+	}
+	s.workspaceCache.setCode(contextName, workspace, resp.Content)
+	return resp.Content, nil
+}
+
+// handleWorkspaceCache shows the cache state for debugging. Admin only.
+func (s *Service) handleWorkspaceCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if !s.isAdmin(r) {
+		writeError(w, http.StatusForbidden, APIErrorForbidden, "This endpoint requires a valid X-Admin-Token", "")
+		return
+	}
+
+	type entry struct {
+		Workspace string    `json:"workspace"`
+		CachedAt  time.Time `json:"cached_at"`
+		CodeBytes int       `json:"code_bytes"`
+		Expired   bool      `json:"expired"`
+	}
+	c := s.workspaceCache
+	c.mu.RLock()
+	entries := make([]entry, 0, len(c.entries))
+	for key, e := range c.entries {
+		entries = append(entries, entry{
+			Workspace: key,
+			CachedAt:  e.CachedAt,
+			CodeBytes: len(e.Code),
+			Expired:   time.Since(e.CachedAt) > c.ttl,
+		})
+	}
+	invalidations := make(map[string]int64, len(c.invalidations))
+	for event, count := range c.invalidations {
+		invalidations[event] = count
+	}
+	subscribers := len(c.subscribers)
+	c.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Workspace < entries[j].Workspace })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"enabled":       c.ttl > 0,
+		"ttl_seconds":   int(c.ttl.Seconds()),
+		"entries":       entries,
+		"invalidations": invalidations,
+		"subscribers":   subscribers,
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errWorkspaceBusy is returned when a workspace stays locked by another run
+// for longer than lock_timeout_seconds.
+var errWorkspaceBusy = errors.New("a run is already in progress for this workspace")
+
+// workspaceLocks serializes runs on the same workspace, so the code, plan
+// and apply of concurrent requests don't interleave. Runs on different
+// workspaces proceed in parallel. Locks are per process, so runs through
+// different replicas are not serialized.
+type workspaceLocks struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	locks map[string]chan struct{} // Holds a token while locked
+}
+
+func newWorkspaceLocks(timeout time.Duration) *workspaceLocks {
+	return &workspaceLocks{timeout: timeout, locks: make(map[string]chan struct{})}
+}
+
+func (l *workspaceLocks) channel(contextName, workspace string) chan struct{} {
+	key := workspaceCacheKey(contextName, workspace)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch, ok := l.locks[key]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		l.locks[key] = ch
+	}
+	return ch
+}
+
+// lock waits for the workspace's lock and returns the function releasing it.
+// It fails with errWorkspaceBusy after the timeout, or with ctx's error.
+func (l *workspaceLocks) lock(ctx context.Context, contextName, workspace string) (func(), error) {
+	ch := l.channel(contextName, workspace)
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-timer.C:
+		return nil, errWorkspaceBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// tryLock is lock without waiting: it fails with errWorkspaceBusy at once if
+// a run holds the lock.
+func (l *workspaceLocks) tryLock(contextName, workspace string) (func(), error) {
+	ch := l.channel(contextName, workspace)
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	default:
+		return nil, errWorkspaceBusy
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkspaceLocks(t *testing.T) {
+	tests := []struct {
+		name      string
+		workspace string // Locked while ws is held
+		cancelled bool   // Whether the waiting context is cancelled
+		wantErr   error
+	}{
+		{"other workspace", "other", false, nil},
+		{"same workspace times out", "ws", false, errWorkspaceBusy},
+		{"same workspace cancelled", "ws", true, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locks := newWorkspaceLocks(20 * time.Millisecond)
+			unlock, err := locks.lock(context.Background(), "ctx", "ws")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unlock()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancelled {
+				cancel()
+			}
+			defer cancel()
+			release, err := locks.lock(ctx, "ctx", tt.workspace)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("lock() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				release()
+			}
+			if _, err := locks.tryLock("ctx", "ws"); !errors.Is(err, errWorkspaceBusy) {
+				t.Errorf("tryLock() of the held workspace = %v, want %v", err, errWorkspaceBusy)
+			}
+		})
+	}
+}
+
+func TestWorkspaceLockReleased(t *testing.T) {
+	locks := newWorkspaceLocks(time.Second)
+	unlock, err := locks.lock(context.Background(), "ctx", "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		release, err := locks.lock(context.Background(), "ctx", "ws")
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	unlock()
+	if err := <-acquired; err != nil {
+		t.Errorf("waiting lock() = %v, want the lock once released", err)
+	}
+	release, err := locks.tryLock("ctx", "ws")
+	if err != nil {
+		t.Fatalf("tryLock() after release = %v", err)
+	}
+	release()
+}
+
+func TestBusyWorkspace(t *testing.T) {
+	s := newTestService(&Config{AdminToken: "admin"})
+	s.workspaceLocks = newWorkspaceLocks(10 * time.Millisecond)
+	executor := newFakeExecutor()
+	s.executorClient, s.generator = executor, &fakeGenerator{replies: []string{testCode}}
+	unlock, err := s.workspaceLocks.lock(context.Background(), "ctx", "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	tests := []struct {
+		name  string
+		req   *http.Request
+		serve func(http.ResponseWriter, *http.Request)
+	}{
+		{
+			name:  "terraform request",
+			req:   httptest.NewRequest(http.MethodPost, "/terraform", strings.NewReader(`{"action":"plan","context":"ctx","workspace":"ws","description":"a droplet"}`)),
+			serve: s.handleTerraformRequest,
+		},
+		{
+			name:  "workspace delete",
+			req:   httptest.NewRequest(http.MethodDelete, "/contexts/ctx/workspaces/ws", nil),
+			serve: s.handleWorkspaceDelete,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.SetPathValue("name", "ctx")
+			tt.req.SetPathValue("workspace", "ws")
+			tt.req.Header.Set("X-Admin-Token", "admin")
+			w := httptest.NewRecorder()
+			tt.serve(w, tt.req)
+			if w.Code != http.StatusConflict {
+				t.Errorf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+			}
+		})
+	}
+	if got := executor.called("Plan"); len(got) != 0 {
+		t.Errorf("plans = %v, want none while the workspace is busy", got)
+	}
+	if n := s.generator.(*fakeGenerator).calls(); n != 0 {
+		t.Errorf("generations = %d, want none before the workspace is locked", n)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	otellog "go.opentelemetry.io/otel/log"
+	pb "request-processor/api/proto"
+)
+
+// handleContexts lists the executor's contexts.
+func (s *Service) handleContexts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	resp, err := s.executorClient.ListContexts(r.Context(), &pb.ListContextsRequest{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to list contexts", err.Error())
+		return
+	}
+	if !resp.Success {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to list contexts", resp.Error)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"contexts": resp.Contexts,
+	})
+}
+
+// handleWorkspaces lists the workspaces of a context.
+func (s *Service) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+
+	contextName := r.PathValue("name")
+	resp, err := s.executorClient.ListWorkspaces(r.Context(), &pb.ListWorkspacesRequest{Context: contextName})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to list workspaces", err.Error())
+		return
+	}
+	if !resp.Success {
+		writeError(w, http.StatusNotFound, APIErrorNotFound, fmt.Sprintf("failed to list workspaces of context %s", contextName), resp.Error)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"context":    contextName,
+		"workspaces": resp.Workspaces,
+	})
+}
+
+// handleWorkspaceDelete deletes a workspace. It fails with 409 while a run
+// holds the workspace, or while the workspace still has resources in its
+// state, which would be left running without a workspace to destroy them.
+// Admin only.
+func (s *Service) handleWorkspaceDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, "Method not allowed", "")
+		return
+	}
+	if !s.isAdmin(r) {
+		writeError(w, http.StatusForbidden, APIErrorForbidden, "This endpoint requires a valid X-Admin-Token", "")
+		return
+	}
+
+	ctx := r.Context()
+	contextName, workspace := r.PathValue("name"), r.PathValue("workspace")
+	unlock, err := s.workspaceLocks.tryLock(contextName, workspace)
+	if err != nil {
+		writeError(w, http.StatusConflict, APIErrorWorkspaceBusy, err.Error(), "")
+		return
+	}
+	defer unlock()
+
+	state, err := s.executorClient.GetStateList(ctx, &pb.GetStateListRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to read workspace state", err.Error())
+		return
+	}
+	if resources := strings.TrimSpace(state.StateListOutput); state.Success && resources != "" {
+		writeError(w, http.StatusConflict, APIErrorWorkspaceNotEmpty, fmt.Sprintf("workspace %s/%s still manages %d resources; destroy them first", contextName, workspace, len(strings.Split(resources, "\n"))), "")
+		return
+	}
+
+	resp, err := s.executorClient.DeleteWorkspace(ctx, &pb.DeleteWorkspaceRequest{
+		Context:   contextName,
+		Workspace: workspace,
+	})
+	s.workspaceCache.invalidate(contextName, workspace, CacheEventDeleted)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to delete workspace", err.Error())
+		return
+	}
+	if !resp.Success {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to delete workspace", resp.Error)
+		return
+	}
+	if err := s.store.Delete(ctx, workspaceUsageNamespace, workspaceUsageKey(contextName, workspace)); err != nil && !errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, APIErrorInternal, "Workspace deleted, but failed to remove its usage record", err.Error())
+		return
+	}
+	s.emitEvent(ctx, otellog.SeverityWarn, "workspace_deleted", map[string]any{
+		"context":   contextName,
+		"workspace": workspace,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}